@@ -0,0 +1,82 @@
+// cmd/cli/approval.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/synapse/internal/agent"
+	"github.com/synapse/internal/tool"
+	"github.com/synapse/internal/ui"
+)
+
+// approvalPrompt 是一个从 agent goroutine 转交给主循环的审批请求。
+type approvalPrompt struct {
+	request agent.ApprovalRequest
+	reply   chan agent.ApprovalResponse
+}
+
+// cliApprover 实现了 agent.Approver。
+// 它不直接读写终端，而是把请求交给主循环处理，
+// 这样提示信息总是出现在之前的流式输出之后，并且只有一个 goroutine 读取 stdin。
+type cliApprover struct {
+	prompts chan approvalPrompt
+}
+
+func newCLIApprover() *cliApprover {
+	return &cliApprover{prompts: make(chan approvalPrompt)}
+}
+
+func (c *cliApprover) Approve(ctx context.Context, req agent.ApprovalRequest) (agent.ApprovalResponse, error) {
+	prompt := approvalPrompt{request: req, reply: make(chan agent.ApprovalResponse, 1)}
+	select {
+	case c.prompts <- prompt:
+	case <-ctx.Done():
+		return agent.ApprovalResponse{}, ctx.Err()
+	}
+	select {
+	case resp := <-prompt.reply:
+		return resp, nil
+	case <-ctx.Done():
+		return agent.ApprovalResponse{}, ctx.Err()
+	}
+}
+
+// askApproval 在终端展示待执行的工具调用，并读取用户的选择。
+func askApproval(scanner *bufio.Scanner, req agent.ApprovalRequest) agent.ApprovalResponse {
+	ui.StopSpinner()
+	ui.PrintApprovalRequest(req.ToolName, req.Access.String(), req.Arguments, req.Preview)
+
+	question := "Allow? [y] once / [a] always this session / [n] deny:"
+	switch {
+	case req.Access == tool.AccessDestructive:
+		// 破坏性操作不提供会话级授权
+		question = "Allow this destructive action? [y] yes / [n] deny:"
+	case req.AlwaysAsk:
+		question = "Allow? [y] yes / [n] deny:"
+	}
+	for {
+		fmt.Printf("%s ", ui.Yellow(question))
+		if !scanner.Scan() {
+			return agent.ApprovalResponse{Decision: agent.DecisionDeny, Reason: "no input available"}
+		}
+		switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+		case "y", "yes":
+			return agent.ApprovalResponse{Decision: agent.DecisionAllowOnce}
+		case "a", "always":
+			if req.Access == tool.AccessDestructive || req.AlwaysAsk {
+				continue
+			}
+			return agent.ApprovalResponse{Decision: agent.DecisionAllowSession}
+		case "n", "no":
+			fmt.Printf("%s ", ui.Yellow("Reason (optional, sent to the assistant):"))
+			reason := ""
+			if scanner.Scan() {
+				reason = strings.TrimSpace(scanner.Text())
+			}
+			return agent.ApprovalResponse{Decision: agent.DecisionDeny, Reason: reason}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// cmd/cli/approval_test.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/agent"
+	"github.com/synapse/internal/tool"
+)
+
+func TestAskApproval(t *testing.T) {
+	mutating := agent.ApprovalRequest{ToolName: "write_file", Access: tool.AccessMutating}
+	destructive := agent.ApprovalRequest{ToolName: "delete_file", Access: tool.AccessDestructive}
+	confirm := agent.ApprovalRequest{ToolName: "read_file", Access: tool.AccessReadOnly, AlwaysAsk: true}
+	tests := []struct {
+		name  string
+		req   agent.ApprovalRequest
+		input string
+		want  agent.ApprovalResponse
+	}{
+		{"yes", mutating, "y\n", agent.ApprovalResponse{Decision: agent.DecisionAllowOnce}},
+		{"yes ignores case and spaces", mutating, "  YES \n", agent.ApprovalResponse{Decision: agent.DecisionAllowOnce}},
+		{"always", mutating, "a\n", agent.ApprovalResponse{Decision: agent.DecisionAllowSession}},
+		{"unknown answers ask again", mutating, "maybe\n\nalways\n", agent.ApprovalResponse{Decision: agent.DecisionAllowSession}},
+		{"deny with a reason", mutating, "n\nwrong file\n", agent.ApprovalResponse{Decision: agent.DecisionDeny, Reason: "wrong file"}},
+		{"deny without a reason", mutating, "no\n", agent.ApprovalResponse{Decision: agent.DecisionDeny}},
+		// 破坏性操作和 require_confirm 的工具不接受会话级授权
+		{"always is refused for destructive tools", destructive, "a\ny\n", agent.ApprovalResponse{Decision: agent.DecisionAllowOnce}},
+		{"always is refused for require_confirm", confirm, "always\nn\n\n", agent.ApprovalResponse{Decision: agent.DecisionDeny}},
+		{"end of input denies", destructive, "a\n", agent.ApprovalResponse{Decision: agent.DecisionDeny, Reason: "no input available"}},
+		{"empty input denies", mutating, "", agent.ApprovalResponse{Decision: agent.DecisionDeny, Reason: "no input available"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := bufio.NewScanner(strings.NewReader(tt.input))
+			if got := askApproval(scanner, tt.req); got != tt.want {
+				t.Errorf("askApproval = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLIApprover(t *testing.T) {
+	c := newCLIApprover()
+	req := agent.ApprovalRequest{ToolName: "write_file", Access: tool.AccessMutating}
+
+	// 主循环收到请求并回复
+	go func() {
+		prompt := <-c.prompts
+		if prompt.request.ToolName != "write_file" {
+			t.Errorf("prompt for %q, want write_file", prompt.request.ToolName)
+		}
+		prompt.reply <- agent.ApprovalResponse{Decision: agent.DecisionAllowOnce}
+	}()
+	resp, err := c.Approve(context.Background(), req)
+	if err != nil || resp.Decision != agent.DecisionAllowOnce {
+		t.Errorf("Approve = %+v, %v; want allow once", resp, err)
+	}
+
+	// 没有人处理请求时，取消上下文会结束等待
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Approve(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Approve with a cancelled context error = %v, want context.Canceled", err)
+	}
+
+	// 请求已被接收但尚未回复时，取消上下文同样结束等待
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		<-c.prompts
+		cancel()
+	}()
+	if _, err := c.Approve(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Approve cancelled while waiting for a reply error = %v, want context.Canceled", err)
+	}
+}
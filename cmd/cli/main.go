@@ -7,14 +7,20 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"os/signal"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	"github.com/synapse/internal/agent"
 	"github.com/synapse/internal/config"
 	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/llm/anthropic"
 	"github.com/synapse/internal/llm/deepseek"
+	"github.com/synapse/internal/llm/gemini"
+	"github.com/synapse/internal/llm/ollama"
 	"github.com/synapse/internal/llm/openai"
+	"github.com/synapse/internal/mcp"
 	"github.com/synapse/internal/tool"
 	"github.com/synapse/internal/ui"
 
@@ -23,11 +29,21 @@ import (
 	"strings"
 )
 
+// mcpConnectTimeout 是连接一个 MCP 服务器并列出其工具的时间上限
+const mcpConnectTimeout = 30 * time.Second
+
 func main() {
 	configPath := flag.String("config", "", "Path to the configuration file")
 
 	flag.Parse()
-	finalConfigPath, err := findConfigPath(*configPath)
+	args := flag.Args()
+	serveMCP := len(args) >= 2 && args[0] == "mcp" && args[1] == "serve"
+	if len(args) > 0 && !serveMCP {
+		log.Fatalf("Unknown command: %s. Usage: synapse [--config path] [mcp serve [--transport stdio|http] [--address addr]]", strings.Join(args, " "))
+	}
+
+	// 作为 MCP 服务器运行时 stdin/stdout 属于协议，不能交互式地询问用户
+	finalConfigPath, err := findConfigPath(*configPath, !serveMCP)
 	if err != nil {
 		log.Fatalf("Could not find or create configuration: %v", err)
 	}
@@ -37,6 +53,19 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	workspace, err := tool.NewWorkspace(cfg.Workspace.Root, cfg.Workspace.AllowedDirs)
+	if err != nil {
+		log.Fatalf("Failed to set up workspace: %v", err)
+	}
+	log.Printf("Using workspace root: %s", workspace.Root())
+
+	if serveMCP {
+		if err := runMCPServer(cfg, workspace, args[2:]); err != nil {
+			log.Fatalf("MCP server failed: %v", err)
+		}
+		return
+	}
+
 	provider, err := createProvider(cfg)
 	if err != nil {
 		log.Fatalf("Failed to create LLM provider: %v", err)
@@ -44,8 +73,196 @@ func main() {
 	log.Printf("Using LLM provider: %s", provider.Name())
 
 	coreAgent := agent.New(provider)
+	configureSandbox(coreAgent.Tools(), cfg, workspace)
+	loadPlugins(coreAgent.Tools(), cfg.Tools, workspace.Root())
+	mcpClients := connectMCPServers(coreAgent.Tools(), cfg.MCPServers)
+	defer closeMCPClients(mcpClients)
+	configureToolTimeouts(coreAgent.Tools(), cfg.Tools)
+	if err := configureToolPolicy(coreAgent.Tools(), cfg.Tools, workspace.Root(), cfg.ActiveProvider); err != nil {
+		log.Fatalf("Invalid tool policy: %v", err)
+	}
+	coreAgent.SetMaxParallelTools(cfg.Tools.MaxParallel)
+	reasoningDisplay, err := agent.ParseReasoningDisplay(cfg.UI.Reasoning)
+	if err != nil {
+		log.Fatalf("Invalid ui config: %v", err)
+	}
+	coreAgent.SetReasoningDisplay(reasoningDisplay)
+	coreAgent.Tools().SetMaxResultBytes(cfg.Tools.MaxResultBytes)
+	approver := newCLIApprover()
+	coreAgent.SetApprover(approver)
+
+	runCLI(coreAgent, approver)
+}
+
+// loadPlugins 从插件目录加载外部工具。出错的插件被跳过，不影响启动。
+// 工作区中的插件来自仓库，只有在配置中信任它们时才会加载，并且总是需要确认。
+func loadPlugins(registry *tool.Registry, cfg config.ToolsConfig, workspaceRoot string) {
+	dirs := cfg.PluginDirs
+	if len(dirs) == 0 {
+		dirs = tool.DefaultPluginDirs()
+	}
+	loaded, err := registry.LoadPlugins(dirs)
+	if err != nil {
+		log.Printf("Some plugin tools could not be loaded: %v", err)
+	}
+	if cfg.TrustWorkspacePlugins {
+		workspaceLoaded, err := registry.LoadUntrustedPlugins([]string{tool.WorkspacePluginDir(workspaceRoot)})
+		if err != nil {
+			log.Printf("Some workspace plugin tools could not be loaded: %v", err)
+		}
+		loaded = append(loaded, workspaceLoaded...)
+	} else if _, err := os.Stat(tool.WorkspacePluginDir(workspaceRoot)); err == nil {
+		log.Printf("Skipping plugin tools in %s: set tools.trust_workspace_plugins to load them", tool.WorkspacePluginDir(workspaceRoot))
+	}
+	if len(loaded) > 0 {
+		log.Printf("Loaded plugin tools: %s", strings.Join(loaded, ", "))
+	}
+}
+
+// connectMCPServers 连接配置中的 MCP 服务器，并把它们的工具注册到注册表。
+// 服务器并发连接；连接失败的服务器被跳过，不影响启动。
+func connectMCPServers(registry *tool.Registry, servers map[string]config.MCPServerConfig) []*mcp.Client {
+	type connection struct {
+		name   string
+		client *mcp.Client
+		err    error
+	}
+	results := make(chan connection, len(servers))
+	for name, server := range servers {
+		if server.Disabled {
+			results <- connection{name: name}
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+			defer cancel()
+			client, err := mcp.Connect(ctx, name, mcpServerConfig(server))
+			results <- connection{name, client, err}
+		}()
+	}
+
+	var clients []*mcp.Client
+	for range servers {
+		conn := <-results
+		if conn.err != nil {
+			log.Printf("Skipping MCP server: %v", conn.err)
+			continue
+		}
+		if conn.client == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+		names, err := mcp.RegisterTools(ctx, registry, conn.client, servers[conn.name].TrustAnnotations)
+		cancel()
+		if err != nil {
+			log.Printf("%v", err)
+		}
+		if seconds := servers[conn.name].TimeoutSeconds; seconds > 0 {
+			for _, name := range names {
+				registry.SetTimeout(name, time.Duration(seconds)*time.Second)
+			}
+		}
+		log.Printf("Connected to MCP server '%s' with %d tools", conn.name, len(names))
+		clients = append(clients, conn.client)
+	}
+	return clients
+}
+
+// mcpServerConfig 把配置转换为 mcp.ServerConfig，并展开其中引用的环境变量。
+func mcpServerConfig(server config.MCPServerConfig) mcp.ServerConfig {
+	cfg := mcp.ServerConfig{
+		Command:   server.Command,
+		Args:      server.Args,
+		URL:       os.ExpandEnv(server.URL),
+		Transport: server.Transport,
+		Headers:   make(map[string]string, len(server.Headers)),
+	}
+	for k, v := range server.Env {
+		cfg.Env = append(cfg.Env, k+"="+os.ExpandEnv(v))
+	}
+	for k, v := range server.Headers {
+		cfg.Headers[k] = os.ExpandEnv(v)
+	}
+	return cfg
+}
+
+func closeMCPClients(clients []*mcp.Client) {
+	for _, client := range clients {
+		client.Close()
+	}
+}
 
-	runCLI(coreAgent)
+// configureToolPolicy 合并全局、当前项目和 provider 的工具策略，并应用到注册表。
+// provider 为空时（例如 MCP 服务器模式）忽略 provider 策略。
+func configureToolPolicy(registry *tool.Registry, cfg config.ToolsConfig, workspaceRoot, provider string) error {
+	policies := []config.ToolPolicyConfig{cfg.Policy}
+	for root, project := range cfg.Projects {
+		// 用与工作区相同的方式规范化项目路径，以便比较
+		ws, err := tool.NewWorkspace(root, nil)
+		if err == nil && ws.Root() == workspaceRoot {
+			policies = append(policies, project)
+		}
+	}
+
+	var policy tool.Policy
+	for _, p := range policies {
+		policy = policy.Merge(toolPolicy(p))
+		if provider != "" {
+			if providerPolicy, ok := p.Providers[provider]; ok {
+				policy = policy.Merge(toolPolicy(providerPolicy))
+			}
+		}
+	}
+	return registry.SetPolicy(policy)
+}
+
+func toolPolicy(cfg config.ToolPolicyConfig) tool.Policy {
+	policy := tool.Policy{
+		Enabled:        cfg.Enabled,
+		Disabled:       cfg.Disabled,
+		AutoApprove:    cfg.AutoApprove,
+		RequireConfirm: cfg.RequireConfirm,
+	}
+	for _, rule := range cfg.Paths {
+		policy.Paths = append(policy.Paths, tool.PathRule{Tools: rule.Tools, Deny: rule.Deny, Untargeted: tool.Untargeted(rule.Untargeted)})
+	}
+	return policy
+}
+
+// configureSandbox 设置注册表中的工具可以访问的工作区和 run_command 的命令策略。
+// 所有 provider 的 API key 环境变量和 MCP 服务器的 token 环境变量都不会传给命令和插件。
+func configureSandbox(registry *tool.Registry, cfg *config.Config, workspace *tool.Workspace) {
+	var hiddenEnv []string
+	for _, provider := range cfg.Providers {
+		if provider.APIKeyEnv != "" {
+			hiddenEnv = append(hiddenEnv, provider.APIKeyEnv)
+		}
+	}
+	if cfg.Server.MCP.TokenEnv != "" {
+		hiddenEnv = append(hiddenEnv, cfg.Server.MCP.TokenEnv)
+	}
+	registry.SetWorkspace(workspace)
+	registry.SetCommandPolicy(tool.CommandPolicy{
+		Allow:          cfg.Commands.Allow,
+		Deny:           cfg.Commands.Deny,
+		Timeout:        time.Duration(cfg.Commands.TimeoutSeconds) * time.Second,
+		MaxOutputBytes: cfg.Commands.MaxOutputBytes,
+		HiddenEnv:      hiddenEnv,
+	})
+}
+
+// configureToolTimeouts 把配置中的工具超时应用到注册表。
+func configureToolTimeouts(registry *tool.Registry, cfg config.ToolsConfig) {
+	registry.SetDefaultTimeout(time.Duration(cfg.DefaultTimeoutSeconds) * time.Second)
+	for name, seconds := range cfg.TimeoutSeconds {
+		timeout := tool.NoTimeout
+		if seconds > 0 {
+			timeout = time.Duration(seconds) * time.Second
+		}
+		if err := registry.SetTimeout(name, timeout); err != nil {
+			log.Printf("Ignoring timeout for unknown tool: %v", err)
+		}
+	}
 }
 
 func createProvider(cfg *config.Config) (llm.LLMProvider, error) {
@@ -59,12 +276,18 @@ func createProvider(cfg *config.Config) (llm.LLMProvider, error) {
 		return deepseek.New(providerConfig)
 	case "openai":
 		return openai.New(providerConfig)
+	case "anthropic":
+		return anthropic.New(providerConfig)
+	case "ollama":
+		return ollama.New(providerConfig)
+	case "gemini":
+		return gemini.New(providerConfig)
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", providerConfig.Name)
 	}
 }
 
-func runCLI(coreAgent *agent.Agent) {
+func runCLI(coreAgent *agent.Agent, approver *cliApprover) {
 	ui.PrintWelcomeMessage()
 	scanner := bufio.NewScanner(os.Stdin)
 
@@ -92,9 +315,11 @@ func runCLI(coreAgent *agent.Agent) {
 		// 在调用 agent 之前，启动加载动画
 		ui.StartSpinner("Thinking...")
 
-		ctx := context.Background()
+		// 处理消息期间按 Ctrl-C 会取消当前回合（包括正在运行的工具），而不是退出程序
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 		responseChan, err := coreAgent.ProcessUserMessage(ctx, userInput)
 		if err != nil {
+			stop()
 			//  如果 agent 立即返回错误，也要停止动画
 			ui.StopSpinner()
 			log.Printf(ui.Red("Error processing message: %v"), err)
@@ -107,18 +332,30 @@ func runCLI(coreAgent *agent.Agent) {
 		//  在循环从 channel 读取数据之前，停止动画
 		// 但是，我们需要确保在打印任何内容之前停止它。
 		// 最好的时机是在我们收到第一个 token 之后。
-		for token := range responseChan {
-			if !assistantPrefixPrinted {
-				// 这是我们收到的第一个 token
-				// 在打印它之前，停止动画并打印助手的前缀
-				ui.StopSpinner()
-				ui.PrintAssistantPrefix()
-				assistantPrefixPrinted = true
+	streamLoop:
+		for {
+			select {
+			case token, ok := <-responseChan:
+				if !ok {
+					break streamLoop
+				}
+				if !assistantPrefixPrinted {
+					// 这是我们收到的第一个 token
+					// 在打印它之前，停止动画并打印助手的前缀
+					ui.StopSpinner()
+					ui.PrintAssistantPrefix()
+					assistantPrefixPrinted = true
+				}
+				// 打印收到的 token
+				fmt.Print(ui.Green(token))
+			case prompt := <-approver.prompts:
+				// 工具调用需要用户确认，由主循环读取输入以避免与 stdin 竞争
+				prompt.reply <- askApproval(scanner, prompt.request)
 			}
-			// 打印收到的 token
-			fmt.Print(ui.Green(token))
 		}
 
+		stop()
+
 		// 确保即使 channel 为空（例如只有工具调用，没有文本输出），动画也能被停止
 		if !assistantPrefixPrinted {
 			ui.StopSpinner()
@@ -153,13 +390,62 @@ func handleLocalCommand(input string, coreAgent *agent.Agent) bool {
 		fmt.Println(ui.Green("✓ Conversation has been reset."))
 		return true
 
+	case "/models":
+		lister, ok := coreAgent.Provider().(llm.ModelLister)
+		if !ok {
+			fmt.Printf(ui.Yellow("Provider '%s' cannot list models.\n"), coreAgent.Provider().Name())
+			return true
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		models, err := lister.ListModels(ctx)
+		if err != nil {
+			fmt.Printf(ui.Red("Error listing models: %v\n"), err)
+			return true
+		}
+		fmt.Println(ui.Blue("--- Available Models ---"))
+		for _, m := range models {
+			fmt.Printf("  %s %s\n", ui.BrightCyan("•"), m)
+		}
+		fmt.Println(ui.Blue("------------------------"))
+		return true
+
+	case "/reasoning":
+		reasoning := coreAgent.LastReasoning()
+		if reasoning == "" {
+			fmt.Println(ui.Yellow("No reasoning was recorded for the last request."))
+			return true
+		}
+		ui.PrintReasoning(reasoning)
+		return true
+
 	case "/tools":
 		fmt.Println(ui.Blue("--- Available Tools ---"))
-		for _, t := range tool.GetDefaultTools() {
-			fmt.Printf("  %s %s: %s\n", ui.BrightCyan("•"), ui.Cyan(t.Function.Name), t.Function.Description)
+		for _, t := range coreAgent.Tools().Definitions() {
+			fmt.Printf("  %s %s: %s\n", ui.BrightCyan("•"), ui.Cyan(t.Name), t.Description)
 		}
 		fmt.Println(ui.Blue("-----------------------"))
 		return true
+	case "/undo":
+		restored, err := coreAgent.Undo()
+		if err != nil {
+			fmt.Printf(ui.Yellow("Cannot undo: %v\n"), err)
+			return true
+		}
+		fmt.Printf(ui.Green("✓ Reverted changes from %q:\n"), restored.Label)
+		printRestored(restored, "reverted")
+		return true
+
+	case "/redo":
+		restored, err := coreAgent.Redo()
+		if err != nil {
+			fmt.Printf(ui.Yellow("Cannot redo: %v\n"), err)
+			return true
+		}
+		fmt.Printf(ui.Green("✓ Re-applied changes from %q:\n"), restored.Label)
+		printRestored(restored, "re-applied")
+		return true
+
 	case "/exit":
 		fmt.Println(ui.BrightCyan("👋 Goodbye!"))
 		os.Exit(0)
@@ -171,8 +457,19 @@ func handleLocalCommand(input string, coreAgent *agent.Agent) bool {
 	return false
 }
 
-// findConfigPath 按优先级搜索配置文件路径
-func findConfigPath(explicitPath string) (string, error) {
+// printRestored 打印 /undo 或 /redo 恢复的路径，并提醒用户哪些工具的修改没有被恢复。
+func printRestored(restored agent.Restored, action string) {
+	for _, p := range restored.Paths {
+		fmt.Printf("  %s %s\n", ui.BrightCyan("•"), p)
+	}
+	if len(restored.Untracked) > 0 {
+		fmt.Printf(ui.Yellow("⚠ Changes made by %s in this turn are not tracked and were not %s.\n"), strings.Join(restored.Untracked, ", "), action)
+	}
+}
+
+// findConfigPath 按优先级搜索配置文件路径。
+// interactive 为 false 时找不到配置文件直接返回错误，而不是询问是否创建默认配置。
+func findConfigPath(explicitPath string, interactive bool) (string, error) {
 	// 1. 命令行标志具有最高优先级
 	if explicitPath != "" {
 		if _, err := os.Stat(explicitPath); err == nil {
@@ -197,7 +494,7 @@ func findConfigPath(explicitPath string) (string, error) {
 	}
 
 	// 4. 如果都找不到，则尝试自动创建默认配置
-	if currentUser != nil {
+	if currentUser != nil && interactive {
 		defaultConfigDir := filepath.Join(currentUser.HomeDir, ".synapse", "config")
 		defaultConfigPath := filepath.Join(defaultConfigDir, "config.yaml")
 
@@ -235,6 +532,87 @@ providers:
     api_key_env: "OPENAI_API_KEY"
     base_url: "https://api.openai.com/v1"
     default_model: "gpt-4-turbo"
+  anthropic:
+    name: "anthropic"
+    api_key_env: "ANTHROPIC_API_KEY"
+    base_url: "https://api.anthropic.com"
+    default_model: "claude-sonnet-4-5"
+    max_tokens: 16384
+    thinking_budget: 0 # tokens for extended thinking (at least 1024), 0 = off
+  gemini:
+    name: "gemini"
+    api_key_env: "GEMINI_API_KEY"
+    base_url: "https://generativelanguage.googleapis.com"
+    default_model: "gemini-2.5-pro"
+    thinking_budget: 0 # thought summaries with this token budget; -1 = let the model decide, 0 = off
+  ollama:
+    name: "ollama"
+    base_url: "http://localhost:11434"
+    default_model: "qwen2.5-coder:7b" # /models lists the installed models
+    keep_alive: "30m"                 # how long the model stays loaded; "-1" = forever, "0" = unload now
+    options:
+      num_ctx: 32768                  # Ollama's default context window is too small for tool use
+    text_tool_calls: false            # describe tools in the prompt instead of using native tool calling
+
+# How the model's reasoning (e.g. deepseek-reasoner's chain of thought) is shown:
+# "show" streams it dimmed, "collapse" prints a one-line summary (expand with /reasoning), "hide" omits it.
+ui:
+  reasoning: "show"
+
+# File tools can only access paths inside the workspace.
+workspace:
+  root: "" # defaults to the directory Synapse is launched from
+  allowed_dirs: []
+
+# Commands the assistant may run with the run_command tool (prefix match, deny wins).
+# Flags such as "go test -exec" or "git diff --output" are refused unless an entry spells them out.
+# timeout_seconds is also the longest timeout the assistant may request. Commands and
+# plugins do not see the api_key_env variables of the providers.
+commands:
+  allow: ["go build", "go test", "go vet", "go fmt", "gofmt", "go mod tidy", "git status", "git diff", "git log"]
+  deny: ["rm", "git push", "git reset"]
+  timeout_seconds: 120
+  max_output_bytes: 32768
+
+# Tool timeouts in seconds (0 = no limit). Press Ctrl-C to interrupt a running turn.
+tools:
+  default_timeout_seconds: 60
+  timeout_seconds: {}
+  max_parallel: 4 # independent tool calls run concurrently
+  max_result_bytes: 65536 # larger tool outputs are truncated in the middle
+  plugin_dirs: [] # defaults to ~/.synapse/tools
+  trust_workspace_plugins: false # also load ./.synapse/tools from the repository; they always need approval
+  # Which tools are offered and how they are approved. Tool names accept wildcards.
+  policy:
+    enabled: []         # when non-empty, only these tools are available
+    disabled: []
+    auto_approve: []    # run without asking, e.g. ["create_file"]
+    require_confirm: [] # ask every time, even for read-only tools
+    paths: # deny only covers tools that declare their paths; "untargeted: confirm|deny" handles the rest
+      - tools: ["create_file", "edit_file", "delete_file", "move_file", "apply_patch"]
+        deny: [".git/", "vendor/"]
+    providers: {}       # extra rules per provider, e.g. {deepseek: {disabled: ["run_command"]}}
+  projects: {}          # extra rules per workspace root, e.g. {"~/work/api": {disabled: ["run_command"]}}
+
+# "synapse mcp serve" exposes the tools above to other MCP clients over stdio,
+# or over Streamable HTTP on this address with "--transport http".
+server:
+  mcp:
+    address: "127.0.0.1:8765"
+    token_env: "SYNAPSE_MCP_TOKEN" # bearer token for --transport http; a random one is printed when unset
+    ask_synapse: false # also expose an ask_synapse tool backed by the active provider
+
+# MCP servers whose tools are offered to the model, prefixed with the server name
+# (e.g. "github__create_issue"). Use a command for stdio servers or a url for HTTP ones.
+mcp_servers: {}
+#  filesystem:
+#    command: npx
+#    args: ["-y", "@modelcontextprotocol/server-filesystem", "."]
+#    trust_annotations: true # honour the server's readOnlyHint instead of asking for every tool
+#  github:
+#    url: https://api.githubcopilot.com/mcp/
+#    headers:
+#      Authorization: "Bearer ${GITHUB_TOKEN}"
 `
 	err := os.WriteFile(path, []byte(strings.TrimSpace(defaultContent)), 0644)
 	if err != nil {
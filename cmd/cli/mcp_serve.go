@@ -0,0 +1,186 @@
+// cmd/cli/mcp_serve.go
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/synapse/internal/agent"
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/mcp"
+	"github.com/synapse/internal/tool"
+)
+
+// mcpShutdownTimeout 是 HTTP 服务器收到中断信号后等待进行中的请求完成的时间
+const mcpShutdownTimeout = 5 * time.Second
+
+// runMCPServer 实现 `synapse mcp serve`：通过 MCP 公开内置工具和插件工具，
+// 以及可选的 ask_synapse 工具。默认使用 stdio，--transport http 时在配置的地址上提供 Streamable HTTP。
+func runMCPServer(cfg *config.Config, workspace *tool.Workspace, args []string) error {
+	flags := flag.NewFlagSet("mcp serve", flag.ContinueOnError)
+	transport := flags.String("transport", "stdio", "Transport to serve on: stdio or http")
+	address := flags.String("address", cfg.Server.MCP.Address, "Address to listen on with --transport http")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	registry, err := newServedRegistry(cfg, workspace, "")
+	if err != nil {
+		return err
+	}
+	if cfg.Server.MCP.AskSynapse {
+		if err := registerAskSynapse(registry, cfg, workspace); err != nil {
+			return err
+		}
+	}
+	server := mcp.NewServer(registry, log.Default())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch *transport {
+	case "stdio":
+		log.Printf("Serving %d tools over MCP on stdio", len(registry.Names()))
+		return server.ServeStdio(ctx, os.Stdin, os.Stdout)
+	case "http":
+		token, err := mcpToken(cfg.Server.MCP.TokenEnv, *address)
+		if err != nil {
+			return err
+		}
+		server.SetBearerToken(token)
+		return serveMCPHTTP(ctx, server, *address, len(registry.Names()))
+	default:
+		return fmt.Errorf("unknown transport '%s': expected stdio or http", *transport)
+	}
+}
+
+// newServedRegistry 创建一个包含内置工具和插件工具的注册表，并应用工具策略。
+// 来自其他 MCP 服务器的工具不会被再次公开。provider 为空时只应用全局和项目策略。
+func newServedRegistry(cfg *config.Config, workspace *tool.Workspace, provider string) (*tool.Registry, error) {
+	registry := tool.NewBuiltinRegistry()
+	configureSandbox(registry, cfg, workspace)
+	loadPlugins(registry, cfg.Tools, workspace.Root())
+	configureToolTimeouts(registry, cfg.Tools)
+	registry.SetMaxResultBytes(cfg.Tools.MaxResultBytes)
+	if err := configureToolPolicy(registry, cfg.Tools, workspace.Root(), provider); err != nil {
+		return nil, fmt.Errorf("invalid tool policy: %w", err)
+	}
+	return registry, nil
+}
+
+// mcpToken 返回 Streamable HTTP 请求必须携带的 bearer token。token 从 tokenEnv 读取；
+// 没有设置时只允许监听本机地址，并生成一个随机 token 打印到日志中。
+func mcpToken(tokenEnv, address string) (string, error) {
+	if tokenEnv != "" {
+		if token := os.Getenv(tokenEnv); token != "" {
+			return token, nil
+		}
+	}
+	if !loopbackAddress(address) {
+		return "", fmt.Errorf("refusing to serve tools on non-loopback address '%s' without a token: set server.mcp.token_env and export the variable", address)
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	log.Printf("Generated MCP bearer token (set server.mcp.token_env to choose your own): %s", token)
+	return token, nil
+}
+
+// loopbackAddress 判断监听地址是否只能从本机访问。没有主机名的地址（例如 ":8765"）监听所有网卡。
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func serveMCPHTTP(ctx context.Context, server *mcp.Server, address string, toolCount int) error {
+	if address == "" {
+		return errors.New("no address to listen on: set server.mcp.address or pass --address")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", server)
+	httpServer := &http.Server{Addr: address, Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("Serving %d tools over MCP at http://%s/mcp", toolCount, address)
+		errs <- httpServer.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), mcpShutdownTimeout)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
+	}
+}
+
+// --- ask_synapse ---
+
+type askSynapseArgs struct {
+	Prompt string `json:"prompt" desc:"The question or task for Synapse, with any context it needs" required:"true"`
+}
+
+// registerAskSynapse 注册 ask_synapse 工具。每次调用都在一个新的会话中运行 Synapse agent，
+// agent 使用自己的工具注册表，除了策略中 auto_approve 的工具外只能执行只读工具：没有用户可以审批修改，
+// 需要修改文件时调用方应当直接使用公开的文件工具，由它自己的审批流程把关。
+func registerAskSynapse(registry *tool.Registry, cfg *config.Config, workspace *tool.Workspace) error {
+	provider, err := createProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("ask_synapse needs an LLM provider: %w", err)
+	}
+	agentTools, err := newServedRegistry(cfg, workspace, cfg.ActiveProvider)
+	if err != nil {
+		return err
+	}
+
+	err = tool.RegisterTyped(registry, tool.TypedTool[askSynapseArgs]{
+		Name:        "ask_synapse",
+		Description: "Ask the Synapse coding assistant a question about the workspace. It reads and searches files on its own and answers in text",
+		Access:      tool.AccessReadOnly,
+		Run: func(ctx context.Context, _ tool.Env, args askSynapseArgs) (tool.Result, error) {
+			a := agent.NewWithTools(provider, agentTools)
+			a.SetMaxParallelTools(cfg.Tools.MaxParallel)
+			a.SetApprover(readOnlyApprover{})
+			answer, err := a.Ask(ctx, args.Prompt)
+			if err != nil {
+				return tool.Result{}, err
+			}
+			return tool.Result{Text: answer, Summary: "answered by " + provider.Name()}, nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// 一次提问可能包含多轮模型调用，由 MCP 客户端决定何时取消
+	return registry.SetTimeout("ask_synapse", tool.NoTimeout)
+}
+
+// readOnlyApprover 拒绝所有需要审批的工具调用，使 ask_synapse 中的 agent 只能执行只读工具。
+type readOnlyApprover struct{}
+
+func (readOnlyApprover) Approve(context.Context, agent.ApprovalRequest) (agent.ApprovalResponse, error) {
+	return agent.ApprovalResponse{
+		Decision: agent.DecisionDeny,
+		Reason:   "only read-only tools are available when Synapse is used through ask_synapse; describe the change instead of making it",
+	}, nil
+}
@@ -0,0 +1,58 @@
+// cmd/cli/mcp_serve_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoopbackAddress(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8765":    true,
+		"localhost:8765":    true,
+		"[::1]:8765":        true,
+		"127.0.0.2:8765":    true,
+		":8765":             false,
+		"0.0.0.0:8765":      false,
+		"[::]:8765":         false,
+		"192.168.1.10:8765": false,
+		"example.com:8765":  false,
+		"localhost.evil:80": false,
+		"127.0.0.1":         false,
+		"":                  false,
+	}
+	for address, want := range tests {
+		if got := loopbackAddress(address); got != want {
+			t.Errorf("loopbackAddress(%q) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestMCPToken(t *testing.T) {
+	t.Setenv("SYNAPSE_TEST_MCP_TOKEN", "from-env")
+	token, err := mcpToken("SYNAPSE_TEST_MCP_TOKEN", "0.0.0.0:8765")
+	if err != nil || token != "from-env" {
+		t.Errorf("mcpToken with the variable set = %q, %v; want the variable's value", token, err)
+	}
+
+	// 没有 token 时拒绝监听非本机地址
+	t.Setenv("SYNAPSE_TEST_MCP_TOKEN", "")
+	for _, address := range []string{":8765", "0.0.0.0:8765"} {
+		if _, err := mcpToken("SYNAPSE_TEST_MCP_TOKEN", address); err == nil || !strings.Contains(err.Error(), "without a token") {
+			t.Errorf("mcpToken(%q) error = %v, want a refusal", address, err)
+		}
+	}
+
+	// 本机地址使用随机生成的 token
+	a, err := mcpToken("", "127.0.0.1:8765")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mcpToken("", "127.0.0.1:8765")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 48 || a == b {
+		t.Errorf("generated tokens %q and %q, want two different 48 character tokens", a, b)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/synapse
 go 1.24.1
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.9.1
 	github.com/fatih/color v1.18.0
 	github.com/sashabaranov/go-openai v1.40.2
 	gopkg.in/yaml.v3 v3.0.1
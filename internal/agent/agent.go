@@ -3,24 +3,89 @@ package agent
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"strings"
 
+	"github.com/synapse/internal/checkpoint"
 	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
 )
 
+// maxCheckpointLabel 是检查点标签（用户输入摘要）的最大长度。
+const maxCheckpointLabel = 60
+
 type Agent struct {
 	llmProvider llm.LLMProvider
+	tools       *tool.Registry
 	session     *Session
+	permissions *permissionGate
+	checkpoints *checkpoint.Store
+	// maxParallelTools 是同时执行的工具调用数的上限
+	maxParallelTools int
+	// reasoningDisplay 决定推理过程的展示方式，lastReasoning 保存最近一个用户回合中的推理过程
+	reasoningDisplay ReasoningDisplay
+	lastReasoning    []string
 }
 
+// New 创建一个拥有独立内置工具注册表的 Agent。
 func New(provider llm.LLMProvider) *Agent {
+	return NewWithTools(provider, tool.NewBuiltinRegistry())
+}
+
+// NewWithTools 创建一个使用指定工具注册表的 Agent。
+func NewWithTools(provider llm.LLMProvider, tools *tool.Registry) *Agent {
 	return &Agent{
 		llmProvider: provider,
+		tools:       tools,
 		session:     NewSession(),
+		permissions: newPermissionGate(tools),
+		checkpoints: checkpoint.New(),
+
+		maxParallelTools: defaultMaxParallelTools,
+		reasoningDisplay: ReasoningShow,
+	}
+}
+
+// Tools 返回 Agent 使用的工具注册表，可以在运行时增删或启停工具。
+func (a *Agent) Tools() *tool.Registry {
+	return a.tools
+}
+
+// Provider 返回 Agent 使用的 LLM provider。
+func (a *Agent) Provider() llm.LLMProvider {
+	return a.llmProvider
+}
+
+// SetMaxParallelTools 设置同时执行的工具调用数的上限。n <= 0 时使用默认值。
+func (a *Agent) SetMaxParallelTools(n int) {
+	if n <= 0 {
+		n = defaultMaxParallelTools
 	}
+	a.maxParallelTools = n
+}
+
+// SetReasoningDisplay 设置模型推理过程的展示方式。
+func (a *Agent) SetReasoningDisplay(display ReasoningDisplay) {
+	a.reasoningDisplay = display
+}
+
+// LastReasoning 返回最近一个用户回合中模型的推理过程，多次模型调用的推理以空行分隔。
+// 它不属于会话历史，只用于展示（例如展开被折叠的推理）。
+func (a *Agent) LastReasoning() string {
+	return strings.Join(a.lastReasoning, "\n\n")
+}
+
+// SetApprover 设置在执行会修改工作区的工具之前征求用户同意的 Approver。
+func (a *Agent) SetApprover(approver Approver) {
+	a.permissions.setApprover(approver)
 }
 
 func (a *Agent) ProcessUserMessage(ctx context.Context, userInput string) (<-chan string, error) {
 	a.session.AddUserMessage(userInput)
+	a.lastReasoning = nil
+	// 每个用户回合对应一个检查点，回合结束时在 handleStreaming 中提交
+	a.checkpoints.Begin(checkpointLabel(userInput))
 
 	outputChan := make(chan string)
 
@@ -29,6 +94,29 @@ func (a *Agent) ProcessUserMessage(ctx context.Context, userInput string) (<-cha
 	return outputChan, nil
 }
 
+// Ask 处理一条用户消息并等待整个回合结束，返回模型最终的文字回答。
+// 它供非交互的调用方使用（例如 MCP 的 ask_synapse 工具），回合中的流式输出和工具进度会被丢弃。
+func (a *Agent) Ask(ctx context.Context, prompt string) (string, error) {
+	output, err := a.ProcessUserMessage(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	var last string
+	for chunk := range output {
+		last = chunk
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	history := a.session.GetHistory()
+	if msg := history[len(history)-1]; msg.Role == "assistant" && len(msg.ToolCalls) == 0 && msg.Content != "" {
+		return msg.Content, nil
+	}
+	// 回合因错误或达到最大轮数而结束时，最后一段输出就是原因
+	return "", fmt.Errorf("the agent stopped without an answer: %s", strings.TrimSpace(last))
+}
+
 // AddFileToContext 是一个给 CLI 用的辅助方法
 func (a *Agent) AddFileToContext(path, content string) {
 	a.session.AddFileToContext(path, content)
@@ -36,4 +124,84 @@ func (a *Agent) AddFileToContext(path, content string) {
 
 func (a *Agent) ResetSession() {
 	a.session.Reset()
+	a.permissions.reset()
+	a.lastReasoning = nil
+}
+
+// Restored 描述 /undo 或 /redo 恢复的一个回合。
+type Restored struct {
+	Label string   // 回合的标签，即用户输入的摘要
+	Paths []string // 被恢复的路径（相对于工作区）
+	// Untracked 是回合中执行过、修改没有被记录的工具（例如 run_command、插件和 MCP 工具），
+	// 它们做出的修改没有被恢复。
+	Untracked []string
+}
+
+// Undo 把工作区恢复到上一个回合修改之前的状态，并在会话中告知模型。
+func (a *Agent) Undo() (Restored, error) {
+	cp, err := a.checkpoints.Undo()
+	if err != nil {
+		return Restored{}, err
+	}
+	restored := Restored{Label: cp.Label, Paths: a.relativePaths(cp.Paths()), Untracked: cp.Untracked()}
+	note := fmt.Sprintf("NOTE: The user ran /undo. The file changes made while handling %q were reverted", cp.Label)
+	if len(restored.Paths) > 0 {
+		note += fmt.Sprintf(", so these paths are back to their earlier state: %s", strings.Join(restored.Paths, ", "))
+	}
+	a.session.AddSystemNote(note + "." + restoreNote(restored, "reverted"))
+	return restored, nil
+}
+
+// Redo 重新应用最近一次被撤销的修改，并在会话中告知模型。
+func (a *Agent) Redo() (Restored, error) {
+	cp, err := a.checkpoints.Redo()
+	if err != nil {
+		return Restored{}, err
+	}
+	restored := Restored{Label: cp.Label, Paths: a.relativePaths(cp.Paths()), Untracked: cp.Untracked()}
+	note := fmt.Sprintf("NOTE: The user ran /redo. The file changes made while handling %q were re-applied", cp.Label)
+	if len(restored.Paths) > 0 {
+		note += fmt.Sprintf(" to: %s", strings.Join(restored.Paths, ", "))
+	}
+	a.session.AddSystemNote(note + "." + restoreNote(restored, "re-applied"))
+	return restored, nil
+}
+
+// restoreNote 告诉模型哪些工具的修改没有随 /undo 或 /redo 一起恢复，以及需要重新读取文件。
+func restoreNote(restored Restored, action string) string {
+	var note string
+	if len(restored.Untracked) > 0 {
+		note += fmt.Sprintf(" Changes made by %s are not tracked and were NOT %s.", strings.Join(restored.Untracked, ", "), action)
+	}
+	if len(restored.Paths) > 0 {
+		note += " Re-read them before making further edits."
+	}
+	return note
+}
+
+func checkpointLabel(userInput string) string {
+	label := strings.Join(strings.Fields(userInput), " ")
+	if runes := []rune(label); len(runes) > maxCheckpointLabel {
+		label = string(runes[:maxCheckpointLabel]) + "..."
+	}
+	return label
+}
+
+// toolEnv 返回本会话中工具调用的执行环境。
+func (a *Agent) toolEnv() tool.Env {
+	// 工具在修改文件前会把原始内容交给本 agent 的 checkpoints 保存；工作区和命令策略由注册表在执行时填入
+	return tool.Env{SessionID: a.session.ID(), Logger: log.Default(), Recorder: a.checkpoints}
+}
+
+// relativePaths 尽量把绝对路径转换为相对于工作区的路径，便于展示。
+func (a *Agent) relativePaths(paths []string) []string {
+	ws, err := a.tools.Workspace()
+	if err != nil {
+		return paths
+	}
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		rel[i] = ws.Rel(p)
+	}
+	return rel
 }
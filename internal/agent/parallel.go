@@ -0,0 +1,72 @@
+// internal/agent/parallel.go
+package agent
+
+import (
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+// defaultMaxParallelTools 是同时执行的工具调用数的默认上限。
+const defaultMaxParallelTools = 4
+
+// toolCallPlan 记录一次工具调用的调度信息和结果。
+type toolCallPlan struct {
+	call    llm.ToolCall
+	access  tool.Access
+	targets []string      // 调用访问的路径，nil 表示可能访问整个工作区
+	done    chan struct{} // 调用结束（或被拒绝、参数不合法）后关闭
+	result  string        // 写入会话的工具消息
+	// previewed 表示用户在审批时已经看到过变更预览，执行后不再重复展示 diff
+	previewed bool
+}
+
+func newToolCallPlan(tc llm.ToolCall) *toolCallPlan {
+	return &toolCallPlan{call: tc, done: make(chan struct{})}
+}
+
+// finish 在调用没有真正执行时（被拒绝或参数不合法）记录结果。
+func (p *toolCallPlan) finish(result string) {
+	p.result = result
+	close(p.done)
+}
+
+// dependencies 返回 earlier 中必须在 p 之前完成的调用。
+func (p *toolCallPlan) dependencies(earlier []*toolCallPlan) []*toolCallPlan {
+	var deps []*toolCallPlan
+	for _, other := range earlier {
+		if p.conflicts(other) {
+			deps = append(deps, other)
+		}
+	}
+	return deps
+}
+
+// conflicts 判断两个调用是否必须按原始顺序执行：只读调用之间总是可以并发；
+// 否则只要任一方访问的路径无法确定，或者双方的路径有重叠，就需要串行。
+func (p *toolCallPlan) conflicts(other *toolCallPlan) bool {
+	if p.access == tool.AccessReadOnly && other.access == tool.AccessReadOnly {
+		return false
+	}
+	if p.targets == nil || other.targets == nil {
+		return true
+	}
+	for _, a := range p.targets {
+		for _, b := range other.targets {
+			if pathsOverlap(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func waitAll(plans []*toolCallPlan) {
+	for _, p := range plans {
+		<-p.done
+	}
+}
+
+// pathsOverlap 判断两个绝对路径是否相同，或者一个位于另一个之下。
+func pathsOverlap(a, b string) bool {
+	return tool.IsWithin(a, b) || tool.IsWithin(b, a)
+}
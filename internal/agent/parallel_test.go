@@ -0,0 +1,233 @@
+// internal/agent/parallel_test.go
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+func TestToolCallPlanConflicts(t *testing.T) {
+	plan := func(access tool.Access, targets ...string) *toolCallPlan {
+		p := newToolCallPlan(llm.ToolCall{})
+		p.access = access
+		p.targets = targets
+		return p
+	}
+	ro, mut := tool.AccessReadOnly, tool.AccessMutating
+	tests := []struct {
+		name string
+		a, b *toolCallPlan
+		want bool
+	}{
+		{"reads never conflict", plan(ro, "/w/a"), plan(ro, "/w/a"), false},
+		{"reads without targets", plan(ro), plan(ro), false},
+		{"write without targets", plan(mut), plan(ro, "/w/a"), true},
+		{"read of an unknown path", plan(ro), plan(mut, "/w/a"), true},
+		{"same file", plan(mut, "/w/a"), plan(ro, "/w/a"), true},
+		{"different files", plan(mut, "/w/a"), plan(mut, "/w/b"), false},
+		{"file inside a directory", plan(mut, "/w/dir"), plan(ro, "/w/dir/a.go"), true},
+		{"shared prefix is not a parent", plan(mut, "/w/a"), plan(mut, "/w/ab"), false},
+		{"any overlapping target", plan(mut, "/w/a", "/w/b"), plan(mut, "/w/c", "/w/b"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.conflicts(tt.b); got != tt.want {
+				t.Errorf("a.conflicts(b) = %v, want %v", got, tt.want)
+			}
+			if got := tt.b.conflicts(tt.a); got != tt.want {
+				t.Errorf("b.conflicts(a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolCallPlanDependencies(t *testing.T) {
+	write := func(target string) *toolCallPlan {
+		p := newToolCallPlan(llm.ToolCall{})
+		p.access = tool.AccessMutating
+		p.targets = []string{target}
+		return p
+	}
+	a, b, c := write("/w/a"), write("/w/b"), write("/w/a/x")
+	deps := c.dependencies([]*toolCallPlan{a, b})
+	if len(deps) != 1 || deps[0] != a {
+		t.Errorf("dependencies = %v, want only the write to /w/a", deps)
+	}
+}
+
+// schedulerProbe 记录工具调用的并发情况和开始、结束顺序。
+type schedulerProbe struct {
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+	events     []string
+	// arrived 用于让两个 "meet" 调用互相等待，证明它们确实是并发执行的
+	arrived chan struct{}
+}
+
+func (p *schedulerProbe) index(event string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, e := range p.events {
+		if e == event {
+			return i
+		}
+	}
+	return -1
+}
+
+// newSchedulerAgent 返回一个注册了 read、meet 和 write 三个测试工具的 Agent。
+// read 和 meet 是只读的；write 修改 path 参数指定的文件。
+func newSchedulerAgent(t *testing.T, maxParallel int) (*Agent, *schedulerProbe) {
+	t.Helper()
+	probe := &schedulerProbe{arrived: make(chan struct{}, 2)}
+	r := tool.NewRegistry()
+	ws, err := tool.NewWorkspace(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetWorkspace(ws)
+
+	params := json.RawMessage(`{"type": "object", "properties": {"id": {"type": "string"}, "path": {"type": "string"}}, "required": ["id"]}`)
+	run := func(meet bool) tool.ToolFunc {
+		return func(ctx context.Context, _ tool.Env, arguments string) (tool.Result, error) {
+			var args struct{ ID string }
+			json.Unmarshal([]byte(arguments), &args)
+
+			probe.mu.Lock()
+			probe.running++
+			probe.maxRunning = max(probe.maxRunning, probe.running)
+			probe.events = append(probe.events, "start "+args.ID)
+			probe.mu.Unlock()
+
+			if meet {
+				// 等待另一个 meet 调用也开始执行
+				probe.arrived <- struct{}{}
+				deadline := time.After(5 * time.Second)
+				for len(probe.arrived) < 2 {
+					select {
+					case <-deadline:
+						return tool.Result{}, fmt.Errorf("%s never ran at the same time as the other meet call", args.ID)
+					case <-time.After(time.Millisecond):
+					}
+				}
+			} else {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			probe.mu.Lock()
+			probe.running--
+			probe.events = append(probe.events, "end "+args.ID)
+			probe.mu.Unlock()
+			return tool.TextResult("result " + args.ID), nil
+		}
+	}
+	r.MustRegister(llm.Tool{Name: "read", Parameters: params}, run(false), tool.AccessReadOnly)
+	r.MustRegister(llm.Tool{Name: "meet", Parameters: params}, run(true), tool.AccessReadOnly)
+	r.MustRegister(llm.Tool{Name: "write", Parameters: params}, run(false), tool.AccessMutating)
+	r.MustRegisterTargets("write", func(arguments string) []string {
+		var args struct{ Path string }
+		json.Unmarshal([]byte(arguments), &args)
+		return []string{args.Path}
+	})
+
+	a := NewWithTools(nil, r)
+	a.SetMaxParallelTools(maxParallel)
+	return a, probe
+}
+
+// runToolCalls 执行 calls 并返回写入会话的工具消息。
+func runToolCalls(a *Agent, calls []llm.ToolCall) []llm.Message {
+	output := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range output {
+		}
+	}()
+	a.executeToolCalls(context.Background(), calls, output)
+	close(output)
+	<-done
+
+	var messages []llm.Message
+	for _, msg := range a.session.GetHistory() {
+		if msg.Role == "tool" {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func call(id, name, args string) llm.ToolCall {
+	return llm.ToolCall{ID: id, Name: name, Arguments: args}
+}
+
+func TestExecuteToolCallsOrderAndConcurrency(t *testing.T) {
+	a, probe := newSchedulerAgent(t, 2)
+	calls := []llm.ToolCall{
+		call("1", "meet", `{"id": "m1"}`),
+		call("2", "meet", `{"id": "m2"}`),
+		call("3", "write", `{"id": "w1", "path": "a.txt"}`),
+		call("4", "read", `{"id": "r1"}`),
+		call("5", "write", `{"id": "w2", "path": "a.txt"}`),
+		call("6", "write", `{"id": "w3", "path": "b.txt"}`),
+		call("7", "missing", `{}`),
+		call("8", "read", `{"path": "no id"}`),
+		call("9", "read", `{"id": "r2"}`),
+	}
+	messages := runToolCalls(a, calls)
+
+	if len(messages) != len(calls) {
+		t.Fatalf("got %d tool messages, want %d", len(messages), len(calls))
+	}
+	for i, msg := range messages {
+		if msg.ToolCallID != calls[i].ID {
+			t.Errorf("message %d answers call %s, want %s", i, msg.ToolCallID, calls[i].ID)
+		}
+	}
+	for i, want := range map[int]string{0: "result m1", 1: "result m2", 2: "result w1", 4: "result w2", 5: "result w3", 8: "result r2"} {
+		if messages[i].Content != want {
+			t.Errorf("message %d = %q, want %q", i, messages[i].Content, want)
+		}
+	}
+	// 不存在的工具和不合法的参数不会执行，错误按原位置写入会话
+	if !strings.Contains(messages[6].Content, "'missing' not found") {
+		t.Errorf("message 6 = %q, want an unknown tool error", messages[6].Content)
+	}
+	if !strings.Contains(messages[7].Content, "id: missing required field") {
+		t.Errorf("message 7 = %q, want an argument error", messages[7].Content)
+	}
+
+	if probe.maxRunning > 2 {
+		t.Errorf("%d tool calls ran at once, want at most 2", probe.maxRunning)
+	}
+	// 写同一个文件的调用按原始顺序执行
+	if end, start := probe.index("end w1"), probe.index("start w2"); end < 0 || start < end {
+		t.Errorf("w2 started before w1 finished: %q", probe.events)
+	}
+}
+
+func TestExecuteToolCallsSerialWithOneWorker(t *testing.T) {
+	a, probe := newSchedulerAgent(t, 1)
+	var calls []llm.ToolCall
+	for i := range 6 {
+		calls = append(calls, call(fmt.Sprint(i), "read", fmt.Sprintf(`{"id": "r%d"}`, i)))
+	}
+	messages := runToolCalls(a, calls)
+	if probe.maxRunning != 1 {
+		t.Errorf("%d tool calls ran at once, want 1", probe.maxRunning)
+	}
+	for i, msg := range messages {
+		if want := fmt.Sprintf("result r%d", i); msg.Content != want {
+			t.Errorf("message %d = %q, want %q", i, msg.Content, want)
+		}
+	}
+}
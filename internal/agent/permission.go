@@ -0,0 +1,133 @@
+// internal/agent/permission.go
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+// Decision 是用户对一次工具调用审批的结果。
+type Decision int
+
+const (
+	// DecisionDeny 拒绝本次调用。
+	DecisionDeny Decision = iota
+	// DecisionAllowOnce 仅允许本次调用。
+	DecisionAllowOnce
+	// DecisionAllowSession 允许本次调用，并在当前会话中不再询问同名工具。
+	// 对破坏性工具它等同于 DecisionAllowOnce。
+	DecisionAllowSession
+)
+
+// ApprovalRequest 描述一个等待用户确认的工具调用。
+type ApprovalRequest struct {
+	ToolName  string
+	Arguments string
+	Access    tool.Access
+	// Preview 是工具即将做出的变更描述（例如 diff），可能为空。
+	Preview string
+	// AlwaysAsk 表示策略要求每次调用都确认，会话级授权对它无效。
+	AlwaysAsk bool
+}
+
+// ApprovalResponse 是用户针对 ApprovalRequest 给出的答复。
+type ApprovalResponse struct {
+	Decision Decision
+	// Reason 是用户拒绝时给出的理由，会作为工具结果反馈给模型。
+	Reason string
+}
+
+// Approver 负责向用户展示待执行的变更并收集决定。
+// 它在 agent 的后台 goroutine 中被调用，实现者需要自行处理与 UI 的同步。
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) (ApprovalResponse, error)
+}
+
+// permissionGate 位于 agent 循环与 tool.Execute 之间，
+// 只读工具直接放行，会修改工作区的工具需要经过 Approver 确认。
+// 工具策略可以让某些工具免于确认（auto_approve），或者要求每次都确认（require_confirm）。
+type permissionGate struct {
+	mu             sync.Mutex
+	tools          *tool.Registry
+	approver       Approver
+	sessionAllowed map[string]bool
+}
+
+func newPermissionGate(tools *tool.Registry) *permissionGate {
+	return &permissionGate{tools: tools, sessionAllowed: make(map[string]bool)}
+}
+
+func (g *permissionGate) setApprover(approver Approver) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.approver = approver
+}
+
+// reset 清除本会话中“始终允许”的授权。
+func (g *permissionGate) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sessionAllowed = make(map[string]bool)
+}
+
+// check 判断工具调用是否可以执行。被拒绝时返回一段写给模型的说明。
+// prompted 表示是否向用户展示过审批请求（以及其中的变更预览）。
+// 没有设置 Approver 时所有调用都会被放行。
+func (g *permissionGate) check(ctx context.Context, tc llm.ToolCall) (allowed, prompted bool, denial string) {
+	name := tc.Name
+	access := g.tools.Access(name)
+	approval := g.tools.Approval(name)
+	if approval == tool.ApprovalAuto || (access == tool.AccessReadOnly && approval != tool.ApprovalConfirm) {
+		return true, false, ""
+	}
+	alwaysAsk := access == tool.AccessDestructive || approval == tool.ApprovalConfirm
+
+	g.mu.Lock()
+	approver := g.approver
+	sessionAllowed := g.sessionAllowed[name] && !alwaysAsk
+	g.mu.Unlock()
+	if approver == nil || sessionAllowed {
+		return true, false, ""
+	}
+
+	preview, err := g.tools.Preview(name, tc.Arguments)
+	if err != nil {
+		// 预览失败通常意味着调用本身也会失败，仍然交给用户决定，但要说明原因。
+		preview = fmt.Sprintf("(preview unavailable: %v)", err)
+	}
+
+	resp, err := approver.Approve(ctx, ApprovalRequest{
+		ToolName:  name,
+		Arguments: tc.Arguments,
+		Access:    access,
+		Preview:   preview,
+		AlwaysAsk: approval == tool.ApprovalConfirm,
+	})
+	if err != nil {
+		return false, true, fmt.Sprintf("Tool '%s' was not executed: approval failed: %v", name, err)
+	}
+
+	switch resp.Decision {
+	case DecisionAllowSession:
+		// 破坏性工具和策略要求确认的工具每次都要确认，“始终允许”只对本次调用生效
+		if !alwaysAsk {
+			g.mu.Lock()
+			g.sessionAllowed[name] = true
+			g.mu.Unlock()
+		}
+		return true, true, ""
+	case DecisionAllowOnce:
+		return true, true, ""
+	default:
+		msg := fmt.Sprintf("The user denied permission to run tool '%s'.", name)
+		if resp.Reason != "" {
+			msg += fmt.Sprintf(" Reason: %s", resp.Reason)
+		}
+		msg += " Do not retry the same change; adjust your plan or ask the user how to proceed."
+		return false, true, msg
+	}
+}
@@ -0,0 +1,169 @@
+// internal/agent/permission_test.go
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+// fakeApprover 按顺序返回预设的答复，并记录收到的请求。
+type fakeApprover struct {
+	responses []ApprovalResponse
+	err       error
+	requests  []ApprovalRequest
+}
+
+func (f *fakeApprover) Approve(_ context.Context, req ApprovalRequest) (ApprovalResponse, error) {
+	f.requests = append(f.requests, req)
+	if f.err != nil {
+		return ApprovalResponse{}, f.err
+	}
+	if len(f.responses) == 0 {
+		return ApprovalResponse{Decision: DecisionDeny, Reason: "unexpected prompt"}, nil
+	}
+	resp := f.responses[0]
+	f.responses = f.responses[1:]
+	return resp, nil
+}
+
+// newTestGate 返回一个注册了只读、修改和破坏性工具各一个的权限检查器。
+func newTestGate(t *testing.T, policy tool.Policy, approver *fakeApprover) *permissionGate {
+	t.Helper()
+	r := tool.NewRegistry()
+	noop := func(context.Context, tool.Env, string) (tool.Result, error) { return tool.TextResult("ok"), nil }
+	r.MustRegister(llm.Tool{Name: "read"}, noop, tool.AccessReadOnly)
+	r.MustRegister(llm.Tool{Name: "write"}, noop, tool.AccessMutating)
+	r.MustRegister(llm.Tool{Name: "delete"}, noop, tool.AccessDestructive)
+	r.MustRegisterPreview("write", func(tool.Env, string) (string, error) { return "--- a\n+++ b", nil })
+	if err := r.SetPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	g := newPermissionGate(r)
+	if approver != nil {
+		g.setApprover(approver)
+	}
+	return g
+}
+
+func TestPermissionGate(t *testing.T) {
+	allowOnce := ApprovalResponse{Decision: DecisionAllowOnce}
+	allowSession := ApprovalResponse{Decision: DecisionAllowSession}
+	tests := []struct {
+		name      string
+		policy    tool.Policy
+		responses []ApprovalResponse
+		calls     []string // 依次检查的工具
+		want      []bool   // 每次调用是否被允许
+		prompts   int      // 期望的审批次数
+	}{
+		{name: "read-only tools are not asked", calls: []string{"read", "read"}, want: []bool{true, true}},
+		{
+			name:      "allow once asks again",
+			responses: []ApprovalResponse{allowOnce, allowOnce},
+			calls:     []string{"write", "write"}, want: []bool{true, true}, prompts: 2,
+		},
+		{
+			name:      "always for this session",
+			responses: []ApprovalResponse{allowSession},
+			calls:     []string{"write", "write", "write"}, want: []bool{true, true, true}, prompts: 1,
+		},
+		{
+			name:      "session approval is per tool",
+			responses: []ApprovalResponse{allowSession, {Decision: DecisionDeny}},
+			calls:     []string{"write", "delete"}, want: []bool{true, false}, prompts: 2,
+		},
+		{
+			name:      "destructive tools are always asked",
+			responses: []ApprovalResponse{allowSession, allowSession},
+			calls:     []string{"delete", "delete"}, want: []bool{true, true}, prompts: 2,
+		},
+		{
+			name:      "require_confirm is always asked",
+			policy:    tool.Policy{RequireConfirm: []string{"write"}},
+			responses: []ApprovalResponse{allowSession, allowSession},
+			calls:     []string{"write", "write"}, want: []bool{true, true}, prompts: 2,
+		},
+		{
+			name:      "require_confirm covers read-only tools",
+			policy:    tool.Policy{RequireConfirm: []string{"read"}},
+			responses: []ApprovalResponse{allowOnce},
+			calls:     []string{"read"}, want: []bool{true}, prompts: 1,
+		},
+		{
+			name:   "auto_approve skips the prompt",
+			policy: tool.Policy{AutoApprove: []string{"write", "delete"}},
+			calls:  []string{"write", "delete"}, want: []bool{true, true},
+		},
+		{
+			name:      "require_confirm wins over auto_approve",
+			policy:    tool.Policy{AutoApprove: []string{"*"}, RequireConfirm: []string{"delete"}},
+			responses: []ApprovalResponse{{Decision: DecisionDeny}},
+			calls:     []string{"write", "delete"}, want: []bool{true, false}, prompts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approver := &fakeApprover{responses: tt.responses}
+			g := newTestGate(t, tt.policy, approver)
+			for i, name := range tt.calls {
+				allowed, prompted, _ := g.check(context.Background(), llm.ToolCall{Name: name, Arguments: "{}"})
+				if allowed != tt.want[i] {
+					t.Errorf("call %d (%s): allowed = %v, want %v", i, name, allowed, tt.want[i])
+				}
+				if prompted && len(approver.requests) == 0 {
+					t.Errorf("call %d (%s) reported a prompt that did not happen", i, name)
+				}
+			}
+			if len(approver.requests) != tt.prompts {
+				t.Errorf("asked %d times, want %d", len(approver.requests), tt.prompts)
+			}
+		})
+	}
+}
+
+func TestPermissionGateRequest(t *testing.T) {
+	approver := &fakeApprover{responses: []ApprovalResponse{{Decision: DecisionDeny, Reason: "wrong file"}}}
+	g := newTestGate(t, tool.Policy{RequireConfirm: []string{"write"}}, approver)
+	allowed, prompted, denial := g.check(context.Background(), llm.ToolCall{Name: "write", Arguments: `{"x": 1}`})
+	if allowed || !prompted {
+		t.Fatalf("allowed = %v, prompted = %v; want a prompted denial", allowed, prompted)
+	}
+	if !strings.Contains(denial, "denied permission to run tool 'write'") || !strings.Contains(denial, "Reason: wrong file") {
+		t.Errorf("denial = %q", denial)
+	}
+	req := approver.requests[0]
+	if req.ToolName != "write" || req.Arguments != `{"x": 1}` || req.Access != tool.AccessMutating || req.Preview != "--- a\n+++ b" || !req.AlwaysAsk {
+		t.Errorf("request = %+v", req)
+	}
+}
+
+func TestPermissionGateReset(t *testing.T) {
+	approver := &fakeApprover{responses: []ApprovalResponse{{Decision: DecisionAllowSession}, {Decision: DecisionAllowOnce}}}
+	g := newTestGate(t, tool.Policy{}, approver)
+	g.check(context.Background(), llm.ToolCall{Name: "write"})
+	g.reset()
+	g.check(context.Background(), llm.ToolCall{Name: "write"})
+	if len(approver.requests) != 2 {
+		t.Errorf("asked %d times, want the session approval to be cleared", len(approver.requests))
+	}
+}
+
+func TestPermissionGateErrors(t *testing.T) {
+	// 没有 Approver 时放行所有调用
+	g := newTestGate(t, tool.Policy{}, nil)
+	if allowed, prompted, _ := g.check(context.Background(), llm.ToolCall{Name: "delete"}); !allowed || prompted {
+		t.Errorf("without an approver: allowed = %v, prompted = %v", allowed, prompted)
+	}
+
+	approver := &fakeApprover{err: errors.New("terminal closed")}
+	g = newTestGate(t, tool.Policy{}, approver)
+	allowed, _, denial := g.check(context.Background(), llm.ToolCall{Name: "write"})
+	if allowed || !strings.Contains(denial, "approval failed: terminal closed") {
+		t.Errorf("allowed = %v, denial = %q; want a denial explaining the failure", allowed, denial)
+	}
+}
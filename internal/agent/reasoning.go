@@ -0,0 +1,86 @@
+// internal/agent/reasoning.go
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/synapse/internal/ui"
+)
+
+// ReasoningDisplay 决定模型的推理过程（例如 DeepSeek 的 reasoning_content）在输出中如何展示。
+// 推理内容只用于展示，不会写入会话历史，也不会发送回 API。
+type ReasoningDisplay string
+
+const (
+	// ReasoningShow 以暗色实时输出完整的推理过程
+	ReasoningShow ReasoningDisplay = "show"
+	// ReasoningCollapse 只输出一行摘要，完整内容可以通过 LastReasoning 查看（CLI 中的 /reasoning）
+	ReasoningCollapse ReasoningDisplay = "collapse"
+	// ReasoningHide 不输出推理过程
+	ReasoningHide ReasoningDisplay = "hide"
+)
+
+// ParseReasoningDisplay 解析配置中的推理展示方式，空字符串表示 ReasoningShow。
+func ParseReasoningDisplay(value string) (ReasoningDisplay, error) {
+	switch d := ReasoningDisplay(strings.ToLower(strings.TrimSpace(value))); d {
+	case "":
+		return ReasoningShow, nil
+	case ReasoningShow, ReasoningCollapse, ReasoningHide:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown reasoning display '%s' (expected show, collapse or hide)", value)
+	}
+}
+
+// reasoningBlock 跟踪一次模型回复中的推理过程，并按展示方式把它写入输出。
+// 推理总是在回复的文本和工具调用之前到达，因此在第一个其他事件到达时结束。
+type reasoningBlock struct {
+	display ReasoningDisplay
+	out     chan<- string
+	text    strings.Builder
+	start   time.Time
+	open    bool
+}
+
+func newReasoningBlock(display ReasoningDisplay, out chan<- string) *reasoningBlock {
+	return &reasoningBlock{display: display, out: out}
+}
+
+// add 追加一段推理内容。
+func (b *reasoningBlock) add(text string) {
+	if text == "" {
+		return
+	}
+	if !b.open {
+		b.open = true
+		b.start = time.Now()
+		if b.display == ReasoningShow {
+			b.out <- "\n" + ui.FormatReasoningHeader("Thinking...") + "\n"
+		}
+	}
+	b.text.WriteString(text)
+	if b.display == ReasoningShow {
+		b.out <- ui.FormatReasoning(text)
+	}
+}
+
+// close 结束推理过程并返回它的完整内容，没有推理时返回空字符串。
+func (b *reasoningBlock) close() string {
+	if !b.open {
+		return ""
+	}
+	b.open = false
+	text := strings.TrimSpace(b.text.String())
+	b.text.Reset()
+	elapsed := time.Since(b.start).Round(100 * time.Millisecond)
+	switch b.display {
+	case ReasoningShow:
+		b.out <- "\n\n"
+	case ReasoningCollapse:
+		summary := fmt.Sprintf("Thought for %s (%d words) - /reasoning to expand", elapsed, len(strings.Fields(text)))
+		b.out <- "\n" + ui.FormatReasoningHeader(summary) + "\n"
+	}
+	return text
+}
@@ -0,0 +1,153 @@
+// internal/agent/reasoning_test.go
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+// scriptedProvider 依次为每个请求返回预设的事件，并记录收到的请求。
+type scriptedProvider struct {
+	replies  [][]llm.Event
+	requests []llm.Request
+}
+
+func (p *scriptedProvider) Name() string         { return "scripted" }
+func (p *scriptedProvider) GetTools() []llm.Tool { return nil }
+
+func (p *scriptedProvider) CreateStream(_ context.Context, req llm.Request) (llm.Stream, error) {
+	p.requests = append(p.requests, req)
+	var events []llm.Event
+	if len(p.requests) <= len(p.replies) {
+		events = p.replies[len(p.requests)-1]
+	}
+	return &scriptedStream{events: events}, nil
+}
+
+type scriptedStream struct{ events []llm.Event }
+
+func (s *scriptedStream) Recv() (llm.Event, error) {
+	if len(s.events) == 0 {
+		return llm.Event{}, io.EOF
+	}
+	ev := s.events[0]
+	s.events = s.events[1:]
+	return ev, nil
+}
+
+func (s *scriptedStream) Close() error { return nil }
+
+// newReasoningAgent 返回一个 Agent：第一次回复先推理再调用只读工具，第二次回复先推理再给出答案。
+func newReasoningAgent(t *testing.T, display ReasoningDisplay) (*Agent, *scriptedProvider) {
+	t.Helper()
+	provider := &scriptedProvider{replies: [][]llm.Event{
+		{
+			{Type: llm.EventReasoning, Text: "I should "},
+			{Type: llm.EventReasoning, Text: "look first."},
+			{Type: llm.EventToolCall, ToolCall: &llm.ToolCall{ID: "1", Name: "look", Arguments: "{}"}},
+			{Type: llm.EventFinish, FinishReason: llm.FinishToolCalls},
+		},
+		{
+			{Type: llm.EventReasoning, Text: "Now I know."},
+			{Type: llm.EventText, Text: "The answer."},
+			{Type: llm.EventFinish, FinishReason: llm.FinishStop},
+		},
+	}}
+	r := tool.NewRegistry()
+	look := func(context.Context, tool.Env, string) (tool.Result, error) { return tool.TextResult("seen"), nil }
+	r.MustRegister(llm.Tool{Name: "look", Parameters: json.RawMessage(`{"type": "object"}`)}, look, tool.AccessReadOnly)
+	a := NewWithTools(provider, r)
+	a.SetReasoningDisplay(display)
+	return a, provider
+}
+
+// runTurn 处理一条用户消息并返回全部输出。
+func runTurn(t *testing.T, a *Agent, input string) string {
+	t.Helper()
+	output, err := a.ProcessUserMessage(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	for s := range output {
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+func TestReasoningIsKeptOutOfHistory(t *testing.T) {
+	a, provider := newReasoningAgent(t, ReasoningShow)
+	runTurn(t, a, "question")
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("made %d requests, want 2", len(provider.requests))
+	}
+	// 第二次请求带回了第一次回复的工具调用，但没有带回推理内容
+	for _, msg := range provider.requests[1].Messages {
+		if strings.Contains(msg.Content, "look first") {
+			t.Errorf("request history contains reasoning: %+v", msg)
+		}
+	}
+	for _, msg := range a.session.GetHistory() {
+		if strings.Contains(msg.Content, "look first") || strings.Contains(msg.Content, "Now I know") {
+			t.Errorf("session history contains reasoning: %+v", msg)
+		}
+	}
+	if want := "I should look first.\n\nNow I know."; a.LastReasoning() != want {
+		t.Errorf("LastReasoning = %q, want %q", a.LastReasoning(), want)
+	}
+
+	// 新的用户回合和重置会话都会清空上一回合的推理
+	a.ResetSession()
+	if a.LastReasoning() != "" {
+		t.Errorf("LastReasoning after reset = %q, want empty", a.LastReasoning())
+	}
+}
+
+func TestReasoningDisplay(t *testing.T) {
+	tests := []struct {
+		display     ReasoningDisplay
+		wantContent bool // 输出中是否包含推理内容
+		wantSummary bool // 输出中是否包含折叠后的摘要
+	}{
+		{ReasoningShow, true, false},
+		{ReasoningCollapse, false, true},
+		{ReasoningHide, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.display), func(t *testing.T) {
+			a, _ := newReasoningAgent(t, tt.display)
+			output := runTurn(t, a, "question")
+			if got := strings.Contains(output, "look first."); got != tt.wantContent {
+				t.Errorf("output contains the reasoning = %v, want %v:\n%s", got, tt.wantContent, output)
+			}
+			if got := strings.Contains(output, "/reasoning to expand"); got != tt.wantSummary {
+				t.Errorf("output contains the summary = %v, want %v:\n%s", got, tt.wantSummary, output)
+			}
+			if !strings.Contains(output, "The answer.") {
+				t.Errorf("output is missing the answer:\n%s", output)
+			}
+			// 隐藏时推理仍然被记录，可以用 /reasoning 查看
+			if a.LastReasoning() == "" {
+				t.Error("LastReasoning is empty")
+			}
+		})
+	}
+}
+
+func TestParseReasoningDisplay(t *testing.T) {
+	for value, want := range map[string]ReasoningDisplay{"": ReasoningShow, "show": ReasoningShow, " Collapse ": ReasoningCollapse, "HIDE": ReasoningHide} {
+		if got, err := ParseReasoningDisplay(value); err != nil || got != want {
+			t.Errorf("ParseReasoningDisplay(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseReasoningDisplay("verbose"); err == nil || !strings.Contains(err.Error(), "unknown reasoning display 'verbose'") {
+		t.Errorf("ParseReasoningDisplay(verbose) error = %v", err)
+	}
+}
@@ -2,6 +2,8 @@
 package agent
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"sync"
 
@@ -25,9 +27,17 @@ const (
 	You have direct access to the local filesystem through a set of secure functions.
 	
 	**[Tool Manifest]**
-	*   read_file(file_path: string): To understand the content of a single file. **Always read before you write or edit.**
+	*   list_directory(path?: string, depth?: integer, include_hidden?: boolean, respect_gitignore?: boolean): To discover the layout of a directory. Start here when you don't know where things live.
+	*   glob_files(pattern: string, path?: string, max_results?: integer): To find files by name pattern (e.g. "**/*.go"), newest first.
+	*   grep_search(pattern: string, path?: string, include?: string[], exclude?: string[], case_insensitive?: boolean, context_lines?: integer, max_results?: integer): To find where a symbol or text occurs across the project without reading every file.
+	*   read_file(file_path: string, offset?: integer, limit?: integer): To understand the content of a single file. Output lines are prefixed with line numbers (not part of the file); large files are paged, so follow the continuation hint to read more. **Always read before you write or edit.**
 	*   create_file(file_path: string, content: string): To create a new file or completely overwrite an existing one. Use with caution.
-	*   edit_file(file_path: string, original_snippet: string, new_snippet: string): For making precise, targeted changes. This is your preferred method for modification. Ensure the **original_snippet** is unique enough to avoid ambiguity.
+	*   edit_file(file_path: string, original_snippet?: string, new_snippet?: string, replace_all?: boolean, start_line?: integer, end_line?: integer, edits?: array): For making precise, targeted changes. This is your preferred method for modification. Ensure the **original_snippet** is unique enough to avoid ambiguity, or set replace_all. Use start_line/end_line to replace a line range, and batch several changes to the same file into one call with **edits**.
+	*   delete_file(file_path: string, recursive?: boolean), move_file(source: string, destination: string, overwrite?: boolean), create_directory(path: string): To restructure the project. These are destructive and always require the user's confirmation; use move_file instead of re-creating a file under a new name.
+	*   apply_patch(patch: string): To apply a unified diff across one or more files, including creating, deleting and renaming files. Prefer this for multi-hunk or multi-file changes. The patch is all-or-nothing; if it fails, read the reported hunk errors, re-read the files and send a corrected patch.
+	*   run_command(command: string, workdir?: string, timeout_seconds?: integer): To build, test or lint the project (e.g. "go test ./..."). Commands run without a shell, one at a time, and only if allowed by the user's configuration.
+
+	Tools that modify files require the user's approval before they run. If the user denies a call, the tool result tells you why; respect that decision and do not retry the same change.
 	
 	**[Interaction Workflow]**
 	1.  **Analyze & Plan:** Upon receiving a request, first formulate a high-level plan. Announce this plan to the user. (e.g., "Okay, I understand. My plan is to: 1. Read **main.go** to see the current structure. 2. Add a new function **handleRequest**. 3. Update the main function to call it. I'll start by reading the file.")
@@ -43,17 +53,26 @@ const (
 
 type Session struct {
 	mu      sync.RWMutex
+	id      string
 	History []llm.Message
 }
 
 func NewSession() *Session {
 	return &Session{
+		id: newSessionID(),
 		History: []llm.Message{
 			{Role: "system", Content: systemPrompt},
 		},
 	}
 }
 
+// ID 返回会话的唯一标识，Reset 之后会生成新的 ID。
+func (s *Session) ID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.id
+}
+
 func (s *Session) AddMessage(msg llm.Message) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -106,6 +125,7 @@ func (s *Session) TrimHistory() {
 func (s *Session) Reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.id = newSessionID()
 
 	// 确保历史记录不为空，并且第一个是系统消息
 	if len(s.History) > 0 && s.History[0].Role == "system" {
@@ -118,6 +138,12 @@ func (s *Session) Reset() {
 		}
 	}
 }
+
+// AddSystemNote 向历史中追加一条系统消息，用于告知模型会话之外发生的事情（例如撤销）。
+func (s *Session) AddSystemNote(content string) {
+	s.AddMessage(llm.Message{Role: "system", Content: content})
+}
+
 func (s *Session) AddFileToContext(path, content string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -127,3 +153,9 @@ func (s *Session) AddFileToContext(path, content string) {
 		Content: fmt.Sprintf("CONTEXT: The content of file '%s' has been provided:\n\n---\n%s\n---", path, content),
 	})
 }
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
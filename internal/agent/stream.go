@@ -7,32 +7,42 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/synapse/internal/llm"
 	"github.com/synapse/internal/tool"
 	"github.com/synapse/internal/ui"
-
-	"github.com/sashabaranov/go-openai" // 需要这个来获取 openai.ToolTypeFunction
 )
 
+// maxDiffLines 限制工具执行后在 UI 中展示的 diff 行数。
+const maxDiffLines = 40
+
 // handleStreaming 是 agent 的核心循环
 func (a *Agent) handleStreaming(ctx context.Context, outputChan chan<- string) {
 	defer close(outputChan)
+	defer a.checkpoints.Commit()
 
 	// 循环直到获得最终的文本响应，或者发生不可恢复的错误
 	// 添加一个循环次数限制，防止无限循环
 	const maxTurns = 10
 	for i := 0; i < maxTurns; i++ {
+		if ctx.Err() != nil {
+			outputChan <- ui.Yellow("\nInterrupted.")
+			return
+		}
 		a.session.TrimHistory()
-		req := llm.ChatCompletionRequest{
+		req := llm.Request{
 			// Model 字段不在这里设置，让 provider 来决定默认值
 			Messages: a.session.GetHistory(),
-			Tools:    a.llmProvider.GetTools(),
-			Stream:   true,
+			Tools:    a.tools.DefinitionsFor(a.llmProvider.Name()),
 		}
 
-		stream, err := a.llmProvider.CreateChatCompletionStream(ctx, req)
+		stream, err := a.llmProvider.CreateStream(ctx, req)
 		if err != nil {
+			if ctx.Err() != nil {
+				outputChan <- ui.Yellow("\nInterrupted.")
+				return
+			}
 			// **修复 #1: 使用 fmt.Sprintf 然后发送到 channel**
 			errorMsg := fmt.Sprintf("API Error: %v", err)
 			outputChan <- ui.Red(errorMsg) // 使用 UI 包来给错误上色
@@ -40,14 +50,22 @@ func (a *Agent) handleStreaming(ctx context.Context, outputChan chan<- string) {
 		}
 
 		var fullResponse strings.Builder
-		var accumulatedToolCalls []llm.ToolCall
+		var toolCalls []llm.ToolCall
+		var finishReason llm.FinishReason
+		// 推理过程只展示给用户，不写入历史：DeepSeek 等 API 不接受在请求中返回推理内容
+		reasoning := newReasoningBlock(a.reasoningDisplay, outputChan)
 
 		for {
-			response, err := stream.Recv()
+			event, err := stream.Recv()
 			if errors.Is(err, io.EOF) {
 				break
 			}
 			if err != nil {
+				if ctx.Err() != nil {
+					outputChan <- ui.Yellow("\nInterrupted.")
+					stream.Close()
+					return
+				}
 				// **修复 #2: 使用 fmt.Sprintf 然后发送到 channel**
 				errorMsg := fmt.Sprintf("Stream Error: %v", err)
 				outputChan <- ui.Red(errorMsg)
@@ -55,24 +73,49 @@ func (a *Agent) handleStreaming(ctx context.Context, outputChan chan<- string) {
 				return
 			}
 
-			delta := response.Choices[0].Delta
-			if delta.Content != "" {
-				fullResponse.WriteString(delta.Content)
-				// 将正常的 token 直接发送出去
-				outputChan <- delta.Content
+			if event.Type != llm.EventReasoning {
+				a.endReasoning(reasoning)
 			}
-			if len(delta.ToolCalls) > 0 {
-				accumulatedToolCalls = accumulateToolCalls(accumulatedToolCalls, delta.ToolCalls)
+			switch event.Type {
+			case llm.EventReasoning:
+				reasoning.add(event.Text)
+			case llm.EventText:
+				fullResponse.WriteString(event.Text)
+				// 将正常的 token 直接发送出去
+				outputChan <- event.Text
+			case llm.EventToolCall:
+				toolCalls = append(toolCalls, *event.ToolCall)
+			case llm.EventFinish:
+				finishReason = event.FinishReason
 			}
 		}
 		stream.Close()
+		a.endReasoning(reasoning)
+
+		// 修复模型生成的参数中无害的格式错误（例如代码块包裹、多余的逗号），避免错误的参数被写入历史；
+		// 被截断的参数不会被修复，执行前的校验会拒绝它们
+		for i := range toolCalls {
+			if fixed, repaired := tool.RepairJSON(toolCalls[i].Arguments); repaired {
+				toolCalls[i].Arguments = fixed
+			}
+		}
 
 		// 记录助手的回复，即使是空的，也要记录工具调用
-		a.session.AddAssistantMessage(fullResponse.String(), accumulatedToolCalls)
+		a.session.AddAssistantMessage(fullResponse.String(), toolCalls)
+
+		if finishReason == llm.FinishLength {
+			outputChan <- ui.Yellow("\nWarning: The response was cut off at the output token limit.")
+			if len(toolCalls) > 0 {
+				// 回复被截断时工具调用的参数可能不完整，不执行它们，让模型用更小的调用重试
+				a.rejectToolCalls(toolCalls, "your response hit the output token limit, so its arguments may be truncated. Retry with smaller calls, e.g. write a large file with several smaller edits", outputChan)
+				continue
+			}
+			return
+		}
 
-		if len(accumulatedToolCalls) > 0 {
+		if len(toolCalls) > 0 {
 			// 如果有工具调用，执行它们并继续循环
-			executeToolCalls(a.session, accumulatedToolCalls, outputChan)
+			a.executeToolCalls(ctx, toolCalls, outputChan)
 			continue
 		}
 
@@ -84,55 +127,111 @@ func (a *Agent) handleStreaming(ctx context.Context, outputChan chan<- string) {
 	outputChan <- ui.Yellow("\nWarning: Maximum conversation turns reached.")
 }
 
-// accumulateToolCalls 从流式响应中逐步构建完整的工具调用列表
-func accumulateToolCalls(existing, delta []llm.ToolCall) []llm.ToolCall {
-	for _, tcDelta := range delta {
-		if tcDelta.Index == nil {
-			continue
-		}
-		idx := *tcDelta.Index
-		for len(existing) <= idx {
-			existing = append(existing, llm.ToolCall{})
-		}
-		if tcDelta.ID != "" {
-			existing[idx].ID = tcDelta.ID
-		}
-		if tcDelta.Type != "" {
-			existing[idx].Type = openai.ToolTypeFunction
-		}
-		if tcDelta.Function.Name != "" {
-			existing[idx].Function.Name += tcDelta.Function.Name
-		}
-		if tcDelta.Function.Arguments != "" {
-			existing[idx].Function.Arguments += tcDelta.Function.Arguments
-		}
+// endReasoning 结束一段推理过程，并把它记录为本回合的推理。
+func (a *Agent) endReasoning(reasoning *reasoningBlock) {
+	if text := reasoning.close(); text != "" {
+		a.lastReasoning = append(a.lastReasoning, text)
 	}
-	return existing
 }
 
 // executeToolCalls 执行工具并将结果添加到会话中
 // **新增 outputChan 参数，用于在工具执行时提供反馈**
-func executeToolCalls(session *Session, toolCalls []llm.ToolCall, outputChan chan<- string) {
+// 会修改工作区的工具在执行前需要通过权限检查，被拒绝的理由会作为工具结果反馈给模型。
+// 互不冲突的调用（例如多个只读调用，或修改不同文件的调用）会并发执行，
+// 访问同一路径的调用按原始顺序串行执行；工具消息总是按调用顺序写入会话。
+func (a *Agent) executeToolCalls(ctx context.Context, toolCalls []llm.ToolCall, outputChan chan<- string) {
+	session := a.session
+	env := a.toolEnv()
 	outputChan <- fmt.Sprintf("\n%s", ui.BrightCyan(fmt.Sprintf("⚡ Executing %d function call(s)...", len(toolCalls))))
 
-	for _, tc := range toolCalls {
+	plans := make([]*toolCallPlan, len(toolCalls))
+	workers := make(chan struct{}, a.maxParallelTools)
+	var wg sync.WaitGroup
+	for i, tc := range toolCalls {
+		plan := newToolCallPlan(tc)
+		plans[i] = plan
 		// 为了更好的用户体验，将工具调用的信息也发送到 UI
-		outputChan <- fmt.Sprintf("\n%s %s", ui.Blue("→ Calling tool:"), ui.Cyan(tc.Function.Name))
-
-		result, err := tool.Execute(tc.Function.Name, tc.Function.Arguments)
+		outputChan <- fmt.Sprintf("\n%s %s", ui.Blue("→ Calling tool:"), ui.Cyan(tc.Name))
 
+		// 在请求用户确认之前校验参数，不合法的调用直接把错误反馈给模型
+		arguments, err := a.tools.ValidateArguments(tc.Name, tc.Arguments)
 		if err != nil {
-			errorMsg := fmt.Sprintf("Error executing tool '%s': %v", tc.Function.Name, err)
-			// 将错误信息发送到 UI
-			outputChan <- fmt.Sprintf("\n%s", ui.Red(errorMsg))
-			// 并记录到会话历史中
-			session.AddToolMessage(tc.ID, errorMsg)
-		} else {
-			// 工具成功执行，记录结果
-			session.AddToolMessage(tc.ID, result)
-			// 也可以选择性地将成功信息发送到 UI
-			outputChan <- fmt.Sprintf("\n%s", ui.Green("✓ Tool finished."))
+			outputChan <- fmt.Sprintf("\n%s", ui.Red(fmt.Sprintf("✗ Invalid arguments for tool '%s'.", tc.Name)))
+			plan.finish(err.Error())
+			continue
 		}
+		// 被策略禁用的工具或路径不需要再征求用户同意
+		if err := a.tools.CheckPolicy(tc.Name, arguments); err != nil {
+			outputChan <- fmt.Sprintf("\n%s", ui.Yellow("✗ Tool call blocked by policy."))
+			plan.finish(err.Error())
+			continue
+		}
+		plan.call.Arguments = arguments
+		plan.access = a.tools.Access(tc.Name)
+		plan.targets = a.tools.Targets(tc.Name, arguments)
+		deps := plan.dependencies(plans[:i])
+
+		if plan.access != tool.AccessReadOnly || a.tools.Approval(tc.Name) == tool.ApprovalConfirm {
+			// 等待冲突的调用完成，使审批时看到的预览反映它们写入后的状态
+			waitAll(deps)
+			allowed, prompted, denial := a.permissions.check(ctx, plan.call)
+			if !allowed {
+				outputChan <- fmt.Sprintf("\n%s", ui.Yellow("✗ Tool call denied."))
+				plan.finish(denial)
+				continue
+			}
+			plan.previewed = prompted
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(plan.done)
+			waitAll(deps)
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			plan.result = a.runToolCall(ctx, env, plan, outputChan)
+		}()
+	}
+	wg.Wait()
+
+	for _, plan := range plans {
+		session.AddToolMessage(plan.call.ID, plan.result)
 	}
 	outputChan <- fmt.Sprintf("\n%s", ui.BrightCyan("🔄 Resuming conversation..."))
 }
+
+// rejectToolCalls 不执行 toolCalls，而是把 reason 作为每个调用的结果反馈给模型。
+func (a *Agent) rejectToolCalls(toolCalls []llm.ToolCall, reason string, outputChan chan<- string) {
+	outputChan <- fmt.Sprintf("\n%s", ui.Yellow(fmt.Sprintf("✗ Skipped %d function call(s).", len(toolCalls))))
+	for _, tc := range toolCalls {
+		a.session.AddToolMessage(tc.ID, fmt.Sprintf("Tool '%s' was not executed: %s.", tc.Name, reason))
+	}
+}
+
+// runToolCall 执行一个已经通过检查的工具调用，返回写入会话的工具消息。
+// UI 中只展示结果的摘要，以及用户尚未在审批时看到过的 diff。
+func (a *Agent) runToolCall(ctx context.Context, env tool.Env, plan *toolCallPlan, outputChan chan<- string) string {
+	tc := plan.call
+	result, err := a.tools.Execute(ctx, env, tc.Name, tc.Arguments)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Error executing tool '%s': %v", tc.Name, err)
+		// 将错误信息发送到 UI
+		outputChan <- fmt.Sprintf("\n%s", ui.Red(errorMsg))
+		return errorMsg
+	}
+	// run_command、插件和 MCP 工具的修改不经过 Recorder，记下来以便 /undo 时提醒用户
+	if plan.access != tool.AccessReadOnly && !a.tools.RecordsChanges(tc.Name) {
+		a.checkpoints.NoteUntracked(tc.Name)
+	}
+
+	summary := result.Summary
+	if summary == "" {
+		summary = "finished"
+	}
+	outputChan <- fmt.Sprintf("\n%s %s", ui.Green(fmt.Sprintf("✓ %s:", tc.Name)), summary)
+	if result.Diff != "" && !plan.previewed {
+		outputChan <- "\n" + ui.FormatDiff(result.Diff, maxDiffLines)
+	}
+	return result.Text
+}
@@ -0,0 +1,321 @@
+// internal/checkpoint/checkpoint.go
+package checkpoint
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// maxCheckpoints 是保留的可撤销回合数上限。
+const maxCheckpoints = 50
+
+// ErrNothingToUndo 和 ErrNothingToRedo 表示对应的栈为空。
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// snapshot 是某个路径在某一时刻的状态。
+type snapshot struct {
+	exists  bool
+	isDir   bool
+	mode    fs.FileMode
+	content []byte
+	link    string // 符号链接的目标，非链接时为空
+}
+
+// Checkpoint 保存了一个用户回合中所有被修改路径在修改前的状态。
+type Checkpoint struct {
+	// Label 描述产生这个检查点的回合，通常是用户输入的摘要。
+	Label string
+	files map[string]snapshot
+	// untracked 是回合中执行过、但修改不经过 Record 的工具（例如 run_command），
+	// 它们做出的修改无法被撤销或重做。
+	untracked map[string]bool
+}
+
+// Paths 返回检查点涉及的所有路径（已排序）。
+func (c *Checkpoint) Paths() []string {
+	paths := make([]string, 0, len(c.files))
+	for p := range c.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Untracked 返回回合中执行过、但修改没有被记录的工具名称（已排序）。
+func (c *Checkpoint) Untracked() []string {
+	names := make([]string, 0, len(c.untracked))
+	for name := range c.untracked {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Store 按用户回合记录文件修改前的内容，支持撤销与重做。
+// 工具在修改文件前调用 Record，agent 在每个回合开始和结束时调用 Begin 与 Commit。
+type Store struct {
+	mu      sync.Mutex
+	current *Checkpoint
+	undo    []*Checkpoint
+	redo    []*Checkpoint
+}
+
+// New 创建一个空的 Store。
+func New() *Store {
+	return &Store{}
+}
+
+// Begin 开始一个新的回合。之前未提交的回合会被先提交。
+func (s *Store) Begin(label string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commitLocked()
+	s.current = &Checkpoint{Label: label, files: make(map[string]snapshot), untracked: make(map[string]bool)}
+}
+
+// Commit 结束当前回合。如果回合中有文件被修改或执行过未记录修改的工具，
+// 它会成为新的撤销点，并清空重做栈。
+func (s *Store) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commitLocked()
+}
+
+func (s *Store) commitLocked() {
+	if s.current == nil {
+		return
+	}
+	if len(s.current.files) > 0 || len(s.current.untracked) > 0 {
+		s.undo = append(s.undo, s.current)
+		if len(s.undo) > maxCheckpoints {
+			s.undo = s.undo[len(s.undo)-maxCheckpoints:]
+		}
+		s.redo = nil
+	}
+	s.current = nil
+}
+
+// Record 在 path 被修改之前保存它的状态。同一回合中只有第一次记录生效。
+// 目录会连同其中的所有文件一起记录；对于不存在的路径，
+// 还会记录最上层缺失的父目录，以便撤销时清理由 MkdirAll 创建的目录。
+// 不在回合中时 Record 什么也不做。
+func (s *Store) Record(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return nil
+	}
+
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return s.recordMissing(path)
+	}
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return s.recordOne(p)
+	})
+}
+
+// NoteUntracked 记录当前回合执行了一个修改不经过 Record 的工具，
+// 撤销这个回合时调用方可以据此提醒用户哪些修改没有被恢复。不在回合中时什么也不做。
+func (s *Store) NoteUntracked(tool string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		s.current.untracked[tool] = true
+	}
+}
+
+// recordMissing 记录 path 以及它最上层不存在的祖先目录。
+func (s *Store) recordMissing(path string) error {
+	if err := s.recordOne(path); err != nil {
+		return err
+	}
+	top := path
+	for {
+		parent := filepath.Dir(top)
+		if parent == top {
+			break
+		}
+		if _, err := os.Lstat(parent); err == nil {
+			break
+		}
+		top = parent
+	}
+	if top != path {
+		return s.recordOne(top)
+	}
+	return nil
+}
+
+func (s *Store) recordOne(path string) error {
+	if _, seen := s.current.files[path]; seen {
+		return nil
+	}
+	snap, err := take(path)
+	if err != nil {
+		return err
+	}
+	s.current.files[path] = snap
+	return nil
+}
+
+// Undo 把工作区恢复到最近一个检查点之前的状态，并返回被撤销的检查点。
+func (s *Store) Undo() (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commitLocked()
+	if len(s.undo) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	cp := s.undo[len(s.undo)-1]
+	inverse, err := swap(cp)
+	if err != nil {
+		return nil, err
+	}
+	s.undo = s.undo[:len(s.undo)-1]
+	s.redo = append(s.redo, inverse)
+	return cp, nil
+}
+
+// Redo 重新应用最近一次被撤销的检查点，并返回它。
+func (s *Store) Redo() (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commitLocked()
+	if len(s.redo) == 0 {
+		return nil, ErrNothingToRedo
+	}
+	cp := s.redo[len(s.redo)-1]
+	inverse, err := swap(cp)
+	if err != nil {
+		return nil, err
+	}
+	s.redo = s.redo[:len(s.redo)-1]
+	s.undo = append(s.undo, inverse)
+	return cp, nil
+}
+
+// swap 记录检查点中所有路径的当前状态，然后把它们恢复为检查点中保存的状态。
+// 返回的检查点保存了恢复前的状态，可以用来反向操作。
+func swap(cp *Checkpoint) (*Checkpoint, error) {
+	inverse := &Checkpoint{Label: cp.Label, files: make(map[string]snapshot, len(cp.files)), untracked: cp.untracked}
+	for path := range cp.files {
+		snap, err := take(path)
+		if err != nil {
+			return nil, err
+		}
+		inverse.files[path] = snap
+	}
+	if err := restore(cp.files); err != nil {
+		return nil, err
+	}
+	return inverse, nil
+}
+
+func take(path string) (snapshot, error) {
+	info, err := os.Lstat(path)
+	// 父目录已经变成文件时路径同样不存在
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return snapshot{}, nil
+	}
+	if err != nil {
+		return snapshot{}, err
+	}
+	snap := snapshot{exists: true, isDir: info.IsDir(), mode: info.Mode().Perm()}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		snap.link, err = os.Readlink(path)
+		return snap, err
+	}
+	if info.Mode().IsRegular() {
+		snap.content, err = os.ReadFile(path)
+		if err != nil {
+			return snapshot{}, err
+		}
+	}
+	return snap, nil
+}
+
+// restore 把每个路径恢复为快照中的状态：先从最深处删除原本不存在的路径，
+// 再从最浅处重新创建原本存在的目录和文件，最后恢复目录的权限，
+// 以免只读目录妨碍恢复其中的文件。
+func restore(files map[string]snapshot) error {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+
+	for _, p := range paths {
+		if !files[p].exists {
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(paths) - 1; i >= 0; i-- {
+		p := paths[i]
+		snap := files[p]
+		if !snap.exists {
+			continue
+		}
+		// 目标位置可能已经变成了另一种类型（例如目录变成了文件），先移除它
+		if info, err := os.Lstat(p); err == nil && !sameKind(info, snap) {
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+		if snap.isDir {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if snap.link != "" {
+			if err := os.Symlink(snap.link, p); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.WriteFile(p, snap.content, snap.mode); err != nil {
+			return err
+		}
+		// WriteFile 不会改变已存在文件的权限
+		if err := os.Chmod(p, snap.mode); err != nil {
+			return err
+		}
+	}
+	for _, p := range paths {
+		if snap := files[p]; snap.exists && snap.isDir {
+			if err := os.Chmod(p, snap.mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sameKind 判断 info 描述的路径与快照是否为同一种类型（目录、符号链接或普通文件）。
+// 同为符号链接时目标可能不同，仍然需要重新创建。
+func sameKind(info fs.FileInfo, snap snapshot) bool {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0 || snap.link != "":
+		return false
+	case snap.isDir:
+		return info.IsDir()
+	default:
+		return info.Mode().IsRegular()
+	}
+}
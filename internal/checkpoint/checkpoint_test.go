@@ -0,0 +1,305 @@
+// internal/checkpoint/checkpoint_test.go
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// state 返回 dir 下所有文件、目录和链接的内容，用于比较撤销前后的工作区。
+func state(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		switch {
+		case d.Type()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			files[rel] = "link:" + target
+			return err
+		case d.IsDir():
+			files[rel] = "dir"
+		default:
+			data, err := os.ReadFile(p)
+			files[rel] = string(data)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "edit.txt"), "before")
+	write(t, filepath.Join(dir, "delete.txt"), "deleted")
+	write(t, filepath.Join(dir, "tree", "a.txt"), "a")
+	before := state(t, dir)
+
+	s := New()
+	s.Begin("change everything")
+	// 修改文件、创建嵌套目录中的新文件、删除文件和整个目录
+	record := func(path string) {
+		t.Helper()
+		if err := s.Record(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(filepath.Join(dir, "edit.txt"))
+	write(t, filepath.Join(dir, "edit.txt"), "after")
+	record(filepath.Join(dir, "edit.txt")) // 同一回合中只有第一次记录生效
+	write(t, filepath.Join(dir, "edit.txt"), "after again")
+	record(filepath.Join(dir, "new", "deep", "file.txt"))
+	write(t, filepath.Join(dir, "new", "deep", "file.txt"), "created")
+	record(filepath.Join(dir, "delete.txt"))
+	os.Remove(filepath.Join(dir, "delete.txt"))
+	record(filepath.Join(dir, "tree"))
+	os.RemoveAll(filepath.Join(dir, "tree"))
+	s.Commit()
+	after := state(t, dir)
+
+	cp, err := s.Undo()
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if cp.Label != "change everything" {
+		t.Errorf("Label = %q", cp.Label)
+	}
+	if got := state(t, dir); !reflect.DeepEqual(got, before) {
+		t.Errorf("after undo:\n got %v\nwant %v", got, before)
+	}
+	if _, err := s.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("second Undo error = %v, want ErrNothingToUndo", err)
+	}
+
+	if _, err := s.Redo(); err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	if got := state(t, dir); !reflect.DeepEqual(got, after) {
+		t.Errorf("after redo:\n got %v\nwant %v", got, after)
+	}
+	if _, err := s.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("second Redo error = %v, want ErrNothingToRedo", err)
+	}
+
+	// 重做之后可以再次撤销
+	if _, err := s.Undo(); err != nil {
+		t.Fatalf("Undo after redo: %v", err)
+	}
+	if got := state(t, dir); !reflect.DeepEqual(got, before) {
+		t.Errorf("after the second undo:\n got %v\nwant %v", got, before)
+	}
+}
+
+func TestUndoOrderAndRedoInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	write(t, path, "v0")
+
+	s := New()
+	for _, content := range []string{"v1", "v2"} {
+		s.Begin("write " + content)
+		s.Record(path)
+		write(t, path, content)
+		s.Commit()
+	}
+
+	for _, want := range []string{"v1", "v0"} {
+		if _, err := s.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if got := state(t, dir)["file.txt"]; got != want {
+			t.Errorf("after undo file = %q, want %q", got, want)
+		}
+	}
+
+	// 一个新的修改回合会清空重做栈
+	s.Begin("write v3")
+	s.Record(path)
+	write(t, path, "v3")
+	s.Commit()
+	if _, err := s.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo after a new change error = %v, want ErrNothingToRedo", err)
+	}
+}
+
+func TestEmptyTurnsAreNotCheckpoints(t *testing.T) {
+	s := New()
+	s.Begin("just chatting")
+	s.Commit()
+	if _, err := s.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo error = %v, want ErrNothingToUndo", err)
+	}
+
+	// 不在回合中时 Record 和 NoteUntracked 什么也不做
+	if err := s.Record(filepath.Join(t.TempDir(), "x")); err != nil {
+		t.Fatal(err)
+	}
+	s.NoteUntracked("run_command")
+	if _, err := s.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo error = %v, want ErrNothingToUndo", err)
+	}
+}
+
+func TestUntrackedTools(t *testing.T) {
+	s := New()
+	s.Begin("run tests")
+	s.NoteUntracked("run_command")
+	s.NoteUntracked("github__create_issue")
+	s.NoteUntracked("run_command")
+	// 下一个回合开始时，未提交的回合被先提交
+	s.Begin("next")
+
+	cp, err := s.Undo()
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if want := []string{"github__create_issue", "run_command"}; !reflect.DeepEqual(cp.Untracked(), want) {
+		t.Errorf("Untracked = %v, want %v", cp.Untracked(), want)
+	}
+	if len(cp.Paths()) != 0 {
+		t.Errorf("Paths = %v, want none", cp.Paths())
+	}
+	redone, err := s.Redo()
+	if err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	if !reflect.DeepEqual(redone.Untracked(), cp.Untracked()) {
+		t.Errorf("redone Untracked = %v, want %v", redone.Untracked(), cp.Untracked())
+	}
+}
+
+func TestSymlinksAreRestored(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("target.txt", link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	write(t, filepath.Join(dir, "target.txt"), "target")
+	before := state(t, dir)
+
+	s := New()
+	s.Begin("replace the link")
+	s.Record(link)
+	os.Remove(link)
+	write(t, link, "a regular file now")
+	s.Commit()
+
+	if _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := state(t, dir); !reflect.DeepEqual(got, before) {
+		t.Errorf("after undo:\n got %v\nwant %v", got, before)
+	}
+}
+
+func TestCheckpointLimit(t *testing.T) {
+	dir := t.TempDir()
+	s := New()
+	for i := 0; i < maxCheckpoints+5; i++ {
+		s.Begin("turn")
+		s.Record(filepath.Join(dir, "file.txt"))
+		write(t, filepath.Join(dir, "file.txt"), "x")
+		s.Commit()
+	}
+	undone := 0
+	for {
+		if _, err := s.Undo(); err != nil {
+			if !errors.Is(err, ErrNothingToUndo) {
+				t.Fatal(err)
+			}
+			break
+		}
+		undone++
+	}
+	if undone != maxCheckpoints {
+		t.Errorf("undid %d turns, want %d", undone, maxCheckpoints)
+	}
+}
+
+func TestModesAreRestored(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "run.sh")
+	write(t, script, "echo hi")
+
+	s := New()
+	s.Begin("make it executable")
+	s.Record(script)
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s.Commit()
+
+	mode := func() os.FileMode {
+		t.Helper()
+		info, err := os.Stat(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+	if _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mode(); got != 0o644 {
+		t.Errorf("mode after undo = %v, want %v", got, os.FileMode(0o644))
+	}
+	if _, err := s.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mode(); got != 0o755 {
+		t.Errorf("mode after redo = %v, want %v", got, os.FileMode(0o755))
+	}
+}
+
+func TestKindChangesAreRestored(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "pkg", "a.txt"), "a")
+	write(t, filepath.Join(dir, "notes"), "notes")
+	before := state(t, dir)
+
+	s := New()
+	s.Begin("swap files and directories")
+	// 目录变成文件，文件变成目录
+	s.Record(filepath.Join(dir, "pkg"))
+	os.RemoveAll(filepath.Join(dir, "pkg"))
+	write(t, filepath.Join(dir, "pkg"), "now a file")
+	s.Record(filepath.Join(dir, "notes"))
+	os.Remove(filepath.Join(dir, "notes"))
+	s.Record(filepath.Join(dir, "notes", "todo.txt"))
+	write(t, filepath.Join(dir, "notes", "todo.txt"), "todo")
+	s.Commit()
+	after := state(t, dir)
+
+	if _, err := s.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if got := state(t, dir); !reflect.DeepEqual(got, before) {
+		t.Errorf("after undo:\n got %v\nwant %v", got, before)
+	}
+	if _, err := s.Redo(); err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	if got := state(t, dir); !reflect.DeepEqual(got, after) {
+		t.Errorf("after redo:\n got %v\nwant %v", got, after)
+	}
+}
@@ -13,19 +13,115 @@ type ProviderConfig struct {
 	BaseURL      string `yaml:"base_url"`
 	DefaultModel string `yaml:"default_model"`
 	APIKey       string `yaml:"-"` // 不从文件读取，从 env 加载
+
+	// 以下字段只用于原生 API 的 provider（例如 anthropic、ollama）
+	MaxTokens      int            `yaml:"max_tokens"`      // 每次回复的最大 token 数，0 表示使用 provider 的默认值
+	ThinkingBudget int            `yaml:"thinking_budget"` // anthropic、gemini：思考的 token 预算，0 表示不启用（gemini 中 -1 表示由模型决定）
+	KeepAlive      string         `yaml:"keep_alive"`      // ollama：请求结束后模型保留在内存中的时间，例如 "30m"；"-1" 表示一直保留，"0" 表示立即卸载
+	Options        map[string]any `yaml:"options"`         // ollama：模型参数，例如 num_ctx、temperature
+	TextToolCalls  bool           `yaml:"text_tool_calls"` // ollama：总是在文本中描述和解析工具调用，用于不支持原生工具调用的模型
 }
 
+// ServerConfig 控制 `synapse mcp serve` 模式。
 type ServerConfig struct {
 	MCP struct {
-		Address string `yaml:"address"`
+		Address string `yaml:"address"` // Streamable HTTP 的监听地址，例如 "127.0.0.1:8765"
+		// TokenEnv 是保存 Streamable HTTP bearer token 的环境变量。变量未设置时生成一个随机 token 并在启动时打印；
+		// 监听非本机地址时必须设置
+		TokenEnv   string `yaml:"token_env"`
+		AskSynapse bool   `yaml:"ask_synapse"` // 是否额外公开把问题交给 Synapse agent 处理的 ask_synapse 工具
 	} `yaml:"mcp"`
 }
 
+// UIConfig 控制交互式界面中的展示。
+type UIConfig struct {
+	// Reasoning 决定模型推理过程（例如 deepseek-reasoner 的 reasoning_content）的展示方式：
+	// "show"（默认）以暗色实时输出，"collapse" 只输出一行摘要，"hide" 不输出
+	Reasoning string `yaml:"reasoning"`
+}
+
+// WorkspaceConfig 定义文件工具可以访问的范围。
+type WorkspaceConfig struct {
+	Root        string   `yaml:"root"`         // 工作区根目录，为空时使用启动时的当前工作目录
+	AllowedDirs []string `yaml:"allowed_dirs"` // 工作区之外额外允许访问的目录
+}
+
+// CommandsConfig 控制 run_command 工具可以执行的命令。
+// allow 和 deny 中的每一项都是命令前缀（如 "go test"）；deny 优先，
+// allow 非空时只有匹配其中一项的命令才能执行。timeout_seconds 同时是模型可以请求的最长超时。
+type CommandsConfig struct {
+	Allow          []string `yaml:"allow"`
+	Deny           []string `yaml:"deny"`
+	TimeoutSeconds int      `yaml:"timeout_seconds"`
+	MaxOutputBytes int      `yaml:"max_output_bytes"`
+}
+
+// ToolsConfig 控制工具的执行。超时以秒为单位，0 表示不限制。
+// 互不冲突的工具调用会并发执行，max_parallel 限制同时执行的数量。
+// run_command 默认使用 commands.timeout_seconds，只有在 timeout_seconds 中单独配置时才受这里限制。
+type ToolsConfig struct {
+	DefaultTimeoutSeconds int            `yaml:"default_timeout_seconds"` // 所有工具的默认超时
+	TimeoutSeconds        map[string]int `yaml:"timeout_seconds"`         // 按工具名称覆盖默认超时
+	MaxParallel           int            `yaml:"max_parallel"`            // 同时执行的工具调用数上限，0 表示使用默认值
+	MaxResultBytes        int            `yaml:"max_result_bytes"`        // 发送给模型的单个工具结果的大小上限，超出部分从中间截断
+	// PluginDirs 是加载外部插件工具的目录，为空时使用 ~/.synapse/tools
+	PluginDirs []string `yaml:"plugin_dirs"`
+	// TrustWorkspacePlugins 为 true 时还会加载工作区中 .synapse/tools 的插件。
+	// 这些插件来自仓库，它们声明的 read-only 访问级别会被忽略，执行前总是需要确认。
+	TrustWorkspacePlugins bool `yaml:"trust_workspace_plugins"`
+	// Policy 是对所有项目生效的工具策略
+	Policy ToolPolicyConfig `yaml:"policy"`
+	// Projects 以项目根目录为键，为该工作区追加工具策略
+	Projects map[string]ToolPolicyConfig `yaml:"projects"`
+}
+
+// ToolPolicyConfig 声明哪些工具可用、哪些无需确认、哪些每次都要确认，以及禁止访问的路径。
+// 工具名支持通配符（例如 "github__*"）。disabled 优先于 enabled，require_confirm 优先于 auto_approve。
+// providers 中的策略只在对应的 provider 处于激活状态时追加生效。
+type ToolPolicyConfig struct {
+	Enabled        []string                    `yaml:"enabled"` // 非空时只启用这些工具
+	Disabled       []string                    `yaml:"disabled"`
+	AutoApprove    []string                    `yaml:"auto_approve"`
+	RequireConfirm []string                    `yaml:"require_confirm"`
+	Paths          []PathRuleConfig            `yaml:"paths"`
+	Providers      map[string]ToolPolicyConfig `yaml:"providers"`
+}
+
+// PathRuleConfig 禁止工具访问匹配的路径（相对于工作区根目录，支持 "**"，以 "/" 结尾表示整个目录）。
+// deny 只能检查声明了访问路径的工具（文件工具、apply_patch 和设置了 path_args 的插件）；
+// run_command、MCP 工具和其他插件不受 deny 约束，需要用 untargeted 把它们改为 "confirm" 或 "deny"。
+type PathRuleConfig struct {
+	Tools      []string `yaml:"tools"` // 为空表示所有工具
+	Deny       []string `yaml:"deny"`
+	Untargeted string   `yaml:"untargeted"` // 匹配的工具没有声明访问路径时："confirm" 每次确认，"deny" 禁止执行；为空表示不约束
+}
+
+// MCPServerConfig 描述一个提供工具的 MCP 服务器。设置 command 时以子进程方式通过 stdio 连接，
+// 否则连接 url。env 和 headers 的值中可以使用 ${VAR} 引用环境变量，以免把密钥写入配置文件。
+type MCPServerConfig struct {
+	Command        string            `yaml:"command"`
+	Args           []string          `yaml:"args"`
+	Env            map[string]string `yaml:"env"`
+	URL            string            `yaml:"url"`
+	Transport      string            `yaml:"transport"` // "http" 或 "sse"，为空时自动选择
+	Headers        map[string]string `yaml:"headers"`
+	TimeoutSeconds int               `yaml:"timeout_seconds"` // 该服务器上工具的超时，0 表示使用 tools.default_timeout_seconds
+	Disabled       bool              `yaml:"disabled"`
+	// TrustAnnotations 为 true 时按服务器的 readOnlyHint 让只读工具免于确认。
+	// 默认不信任：注解由服务器自己声明，每个工具至少被视为会修改工作区。
+	TrustAnnotations bool `yaml:"trust_annotations"`
+}
+
 type Config struct {
-	LogLevel       string                    `yaml:"log_level"`
-	Providers      map[string]ProviderConfig `yaml:"providers"`
-	ActiveProvider string                    `yaml:"active_provider"`
-	Server         ServerConfig              `yaml:"server"`
+	LogLevel       string                     `yaml:"log_level"`
+	Providers      map[string]ProviderConfig  `yaml:"providers"`
+	ActiveProvider string                     `yaml:"active_provider"`
+	Server         ServerConfig               `yaml:"server"`
+	UI             UIConfig                   `yaml:"ui"`
+	Workspace      WorkspaceConfig            `yaml:"workspace"`
+	Commands       CommandsConfig             `yaml:"commands"`
+	Tools          ToolsConfig                `yaml:"tools"`
+	MCPServers     map[string]MCPServerConfig `yaml:"mcp_servers"` // 以服务器名称为键，名称用作其工具的前缀
 }
 
 func Load(path string) (*Config, error) {
@@ -0,0 +1,191 @@
+// internal/llm/anthropic/anthropic.go
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+const (
+	defaultBaseURL = "https://api.anthropic.com"
+	// apiVersion 是请求头 anthropic-version 的值
+	apiVersion = "2023-06-01"
+	// defaultMaxTokens 是没有配置 max_tokens 时每次回复的最大 token 数（Messages API 要求必须提供）
+	defaultMaxTokens = 8192
+	// minThinkingBudget 是 API 接受的最小思考预算
+	minThinkingBudget = 1024
+	// maxRememberedThinking 是为后续请求保留的思考块的助手回合数
+	maxRememberedThinking = 16
+)
+
+// AnthropicProvider 实现了 llm.LLMProvider 接口，直接使用 Anthropic 的 Messages API，
+// 在会话的消息与 Messages API 的内容块之间转换。
+type AnthropicProvider struct {
+	client *http.Client
+	config config.ProviderConfig
+
+	// 启用扩展思考时，API 要求在工具调用循环中原样返回上一个助手回合的思考块（包括签名）。
+	// 会话中的消息无法保存签名，因此在这里按回合中第一个 tool_use 的 ID 记住它们。
+	mu       sync.Mutex
+	thinking map[string][]contentBlock
+	order    []string
+}
+
+// New 创建并返回一个新的 AnthropicProvider 实例。
+func New(cfg config.ProviderConfig) (llm.LLMProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("API key for anthropic is not set (env var: %s)", cfg.APIKeyEnv)
+	}
+	if cfg.ThinkingBudget > 0 {
+		if cfg.ThinkingBudget < minThinkingBudget {
+			return nil, fmt.Errorf("thinking_budget must be at least %d tokens, got %d", minThinkingBudget, cfg.ThinkingBudget)
+		}
+		if cfg.MaxTokens > 0 && cfg.MaxTokens <= cfg.ThinkingBudget {
+			return nil, fmt.Errorf("max_tokens (%d) must be greater than thinking_budget (%d)", cfg.MaxTokens, cfg.ThinkingBudget)
+		}
+	}
+	return &AnthropicProvider{
+		client:   &http.Client{},
+		config:   cfg,
+		thinking: make(map[string][]contentBlock),
+	}, nil
+}
+
+// Name 返回提供商的名称。
+func (p *AnthropicProvider) Name() string {
+	return p.config.Name
+}
+
+// CreateStream 把请求转换为 Messages API 的格式并发起流式请求，
+// 返回的流把 Anthropic 的事件转换为统一的事件：文本块、tool_use 块和思考块分别是文本、工具调用和推理事件。
+func (p *AnthropicProvider) CreateStream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	body, err := json.Marshal(p.newRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("x-api-key", p.config.APIKey)
+	httpReq.Header.Set("anthropic-version", apiVersion)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, readAPIError(resp)
+	}
+	return newStream(resp.Body, p.rememberThinking), nil
+}
+
+// GetTools 返回所有默认的可用工具。
+func (p *AnthropicProvider) GetTools() []llm.Tool {
+	return tool.GetDefaultTools()
+}
+
+// newRequest 把请求转换为 Messages API 的请求。
+func (p *AnthropicProvider) newRequest(req llm.Request) *request {
+	system, messages := p.convertMessages(req.Messages)
+	r := &request{
+		Model:         req.Model,
+		MaxTokens:     p.maxTokens(req),
+		System:        system,
+		Messages:      messages,
+		Tools:         convertTools(req.Tools),
+		StopSequences: req.Stop,
+		Stream:        true,
+	}
+	if r.Model == "" {
+		r.Model = p.config.DefaultModel
+	}
+	if p.config.ThinkingBudget > 0 {
+		// 启用思考时 API 不接受自定义 temperature
+		r.Thinking = &thinkingConfig{Type: "enabled", BudgetTokens: p.config.ThinkingBudget}
+	} else if req.Temperature != 0 {
+		r.Temperature = &req.Temperature
+	}
+	return r
+}
+
+func (p *AnthropicProvider) maxTokens(req llm.Request) int {
+	switch {
+	case req.MaxTokens > 0:
+		return req.MaxTokens
+	case p.config.MaxTokens > 0:
+		return p.config.MaxTokens
+	case p.config.ThinkingBudget > 0:
+		// max_tokens 包含思考预算，必须比它大
+		return p.config.ThinkingBudget + defaultMaxTokens
+	default:
+		return defaultMaxTokens
+	}
+}
+
+// endpoint 返回 Messages API 的地址。base_url 可以带也可以不带 "/v1"。
+func (p *AnthropicProvider) endpoint() string {
+	base := p.config.BaseURL
+	if base == "" {
+		base = defaultBaseURL
+	}
+	base = strings.TrimSuffix(strings.TrimSuffix(base, "/"), "/v1")
+	return base + "/v1/messages"
+}
+
+// rememberThinking 记住一个以工具调用结束的助手回合中的思考块，只保留最近的几个回合。
+func (p *AnthropicProvider) rememberThinking(toolUseID string, blocks []contentBlock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.thinking[toolUseID]; !ok {
+		p.order = append(p.order, toolUseID)
+	}
+	p.thinking[toolUseID] = blocks
+	for len(p.order) > maxRememberedThinking {
+		delete(p.thinking, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+func (p *AnthropicProvider) rememberedThinking(toolUseID string) []contentBlock {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.thinking[toolUseID]
+}
+
+// APIError 是 Messages API 返回的错误，可能来自 HTTP 响应，也可能是流中的 error 事件。
+type APIError struct {
+	StatusCode int    // 流中的错误为 0
+	Type       string // 例如 "overloaded_error"、"invalid_request_error"
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("anthropic API error %d (%s): %s", e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("anthropic API error (%s): %s", e.Type, e.Message)
+}
+
+// readAPIError 从非 200 的响应中读取错误。
+func readAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body errorBody
+	if err := json.Unmarshal(data, &body); err != nil || body.Error.Message == "" {
+		return &APIError{StatusCode: resp.StatusCode, Type: "http_error", Message: strings.TrimSpace(string(data))}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Type: body.Error.Type, Message: body.Error.Message}
+}
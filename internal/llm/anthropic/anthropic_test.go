@@ -0,0 +1,374 @@
+// internal/llm/anthropic/anthropic_test.go
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/llm"
+)
+
+// sse 把 (事件类型, JSON 数据) 对拼接为一段 SSE 响应。
+func sse(events ...string) string {
+	var sb strings.Builder
+	for i := 0; i+1 < len(events); i += 2 {
+		fmt.Fprintf(&sb, "event: %s\ndata: %s\n\n", events[i], events[i+1])
+	}
+	return sb.String()
+}
+
+// newTestProvider 返回一个连接到 httptest 服务器的 provider。服务器对每个请求返回 transcript，
+// 并把收到的请求体写入 got。
+func newTestProvider(t *testing.T, cfg config.ProviderConfig, transcript string, got *request) *AnthropicProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") != apiVersion {
+			http.Error(w, `{"type":"error","error":{"type":"authentication_error","message":"bad headers"}}`, http.StatusUnauthorized)
+			return
+		}
+		if got != nil {
+			if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, transcript)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg.Name = "anthropic"
+	cfg.APIKey = "test-key"
+	cfg.BaseURL = server.URL + "/v1"
+	if cfg.DefaultModel == "" {
+		cfg.DefaultModel = "claude-test"
+	}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p.(*AnthropicProvider)
+}
+
+// collect 读取流中的所有事件，返回事件和结束时的错误（正常结束时为 nil）。
+func collect(t *testing.T, p *AnthropicProvider, req llm.Request) ([]llm.Event, error) {
+	t.Helper()
+	stream, err := p.CreateStream(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var events []llm.Event
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestStreamText(t *testing.T) {
+	transcript := sse(
+		"message_start", `{"type":"message_start","message":{"id":"msg_1","model":"claude-test","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		"ping", `{"type":"ping"}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":", world"}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":0}`,
+		"message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+		"message_stop", `{"type":"message_stop"}`,
+	)
+	var got request
+	p := newTestProvider(t, config.ProviderConfig{}, transcript, &got)
+	events, err := collect(t, p, llm.Request{
+		Messages:    []llm.Message{{Role: llm.RoleSystem, Content: "Be brief."}, {Role: llm.RoleUser, Content: "Hi"}},
+		Temperature: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	want := []llm.Event{
+		{Type: llm.EventText, Text: "Hello"},
+		{Type: llm.EventText, Text: ", world"},
+		{Type: llm.EventFinish, FinishReason: llm.FinishStop, Usage: &llm.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if got.Model != "claude-test" || got.System != "Be brief." || !got.Stream || got.MaxTokens != defaultMaxTokens {
+		t.Errorf("request = %+v", got)
+	}
+	if got.Temperature == nil || *got.Temperature != 0.5 {
+		t.Errorf("temperature = %v, want 0.5", got.Temperature)
+	}
+}
+
+func TestStreamToolUse(t *testing.T) {
+	transcript := sse(
+		"message_start", `{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":3}}}`,
+		"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":"Reading it."}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":0}`,
+		"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"read_file","input":{}}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"file_path\": \"ma"}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"in.go\"}"}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":1}`,
+		"content_block_start", `{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"list_directory","input":{}}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":2}`,
+		"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		"message_stop", `{"type":"message_stop"}`,
+	)
+	p := newTestProvider(t, config.ProviderConfig{}, transcript, nil)
+	events, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Read main.go"}}})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	want := []llm.Event{
+		{Type: llm.EventText, Text: "Reading it."},
+		{Type: llm.EventToolCall, ToolCall: &llm.ToolCall{ID: "toolu_1", Name: "read_file", Arguments: `{"file_path": "main.go"}`}},
+		{Type: llm.EventToolCall, ToolCall: &llm.ToolCall{ID: "toolu_2", Name: "list_directory", Arguments: "{}"}},
+		{Type: llm.EventFinish, FinishReason: llm.FinishToolCalls, Usage: &llm.Usage{PromptTokens: 3, CompletionTokens: 20, TotalTokens: 23}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestStreamThinkingRoundTrip(t *testing.T) {
+	transcript := sse(
+		"message_start", `{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":3}}}`,
+		"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Need the "}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"file."}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig=="}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":0}`,
+		"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"opaque"}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":1}`,
+		"content_block_start", `{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"read_file","input":{}}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"file_path\":\"a.go\"}"}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":2}`,
+		"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+		"message_stop", `{"type":"message_stop"}`,
+	)
+	var got request
+	p := newTestProvider(t, config.ProviderConfig{ThinkingBudget: 2048}, transcript, &got)
+	events, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Read a.go"}}, Temperature: 0.3})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	var reasoning string
+	for _, ev := range events {
+		if ev.Type == llm.EventReasoning {
+			reasoning += ev.Text
+		}
+	}
+	if reasoning != "Need the file." {
+		t.Errorf("reasoning = %q, want %q", reasoning, "Need the file.")
+	}
+	if got.Thinking == nil || got.Thinking.BudgetTokens != 2048 || got.Temperature != nil {
+		t.Errorf("thinking request = %+v, temperature = %v", got.Thinking, got.Temperature)
+	}
+	if got.MaxTokens != 2048+defaultMaxTokens {
+		t.Errorf("max_tokens = %d, want %d", got.MaxTokens, 2048+defaultMaxTokens)
+	}
+
+	// 下一次请求中，同一个工具调用循环的助手消息必须原样带回思考块和签名
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "Read a.go"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "toolu_1", Name: "read_file", Arguments: `{"file_path":"a.go"}`}}},
+		{Role: llm.RoleTool, ToolCallID: "toolu_1", Content: "package a"},
+	}
+	_, messages := p.convertMessages(history)
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	blocks := messages[1].Content
+	wantTypes := []string{"thinking", "redacted_thinking", "tool_use"}
+	if types := blockTypes(blocks); !reflect.DeepEqual(types, wantTypes) {
+		t.Fatalf("assistant blocks = %v, want %v", types, wantTypes)
+	}
+	if blocks[0].Thinking != "Need the file." || blocks[0].Signature != "sig==" || blocks[1].Data != "opaque" {
+		t.Errorf("thinking blocks = %+v", blocks[:2])
+	}
+
+	// 之后的助手回合不再带回更早的思考块
+	history = append(history,
+		llm.Message{Role: llm.RoleAssistant, Content: "It is package a."},
+		llm.Message{Role: llm.RoleUser, Content: "Thanks"},
+	)
+	_, messages = p.convertMessages(history)
+	if types := blockTypes(messages[1].Content); !reflect.DeepEqual(types, []string{"tool_use"}) {
+		t.Errorf("earlier assistant blocks = %v, want [tool_use]", types)
+	}
+}
+
+func TestStreamErrorEvent(t *testing.T) {
+	transcript := sse(
+		"message_start", `{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":3}}}`,
+		"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Partial"}}`,
+		"error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	)
+	p := newTestProvider(t, config.ProviderConfig{}, transcript, nil)
+	events, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Type != "overloaded_error" || apiErr.Message != "Overloaded" || apiErr.StatusCode != 0 {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if len(events) != 1 || events[0].Text != "Partial" {
+		t.Errorf("events before the error = %+v", events)
+	}
+}
+
+func TestStreamUnexpectedEOF(t *testing.T) {
+	transcript := sse(
+		"message_start", `{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":3}}}`,
+		"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Cut"}}`,
+	)
+	p := newTestProvider(t, config.ProviderConfig{}, transcript, nil)
+	_, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("err = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens is too large"}}`)
+	}))
+	defer server.Close()
+	p, err := New(config.ProviderConfig{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.CreateStream(context.Background(), llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Type != "invalid_request_error" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
+
+func TestConvertMessages(t *testing.T) {
+	p := &AnthropicProvider{thinking: make(map[string][]contentBlock)}
+	history := []llm.Message{
+		{Role: llm.RoleSystem, Content: "You are Synapse."},
+		{Role: llm.RoleSystem, Content: "Workspace: /tmp/x"},
+		{Role: llm.RoleUser, Content: "Fix the bug"},
+		{Role: llm.RoleUser, Content: "   "},
+		{Role: llm.RoleAssistant, Content: "Looking.", ToolCalls: []llm.ToolCall{
+			{ID: "t1", Name: "read_file", Arguments: `{"file_path":"a.go"}`},
+			{ID: "t2", Name: "broken", Arguments: `not json`},
+		}},
+		{Role: llm.RoleTool, ToolCallID: "t1", Content: "package a"},
+		{Role: llm.RoleTool, ToolCallID: "t2", Content: "error"},
+		{Role: llm.RoleSystem, Content: "Files were restored by /undo."},
+		{Role: llm.RoleUser, Parts: []llm.ContentPart{
+			{Type: llm.PartText, Text: "See this"},
+			{Type: llm.PartImage, ImageURL: "data:image/png;base64,AAAA"},
+			{Type: llm.PartImage, ImageURL: "https://example.com/a.png"},
+		}},
+		{Role: llm.RoleAssistant, Content: ""},
+		{Role: llm.RoleAssistant, Content: "Done."},
+	}
+	system, messages := p.convertMessages(history)
+
+	if system != "You are Synapse.\n\nWorkspace: /tmp/x" {
+		t.Errorf("system = %q", system)
+	}
+	var roles []string
+	for _, m := range messages {
+		roles = append(roles, m.Role)
+	}
+	if want := []string{"user", "assistant", "user", "assistant"}; !reflect.DeepEqual(roles, want) {
+		t.Fatalf("roles = %v, want %v", roles, want)
+	}
+
+	if types := blockTypes(messages[0].Content); !reflect.DeepEqual(types, []string{"text"}) {
+		t.Errorf("first user blocks = %v, want [text]", types)
+	}
+	assistant := messages[1].Content
+	if types := blockTypes(assistant); !reflect.DeepEqual(types, []string{"text", "tool_use", "tool_use"}) {
+		t.Fatalf("assistant blocks = %v", types)
+	}
+	if string(assistant[1].Input) != `{"file_path":"a.go"}` || string(assistant[2].Input) != "{}" {
+		t.Errorf("tool_use inputs = %s, %s", assistant[1].Input, assistant[2].Input)
+	}
+
+	// 工具结果、对话中间的系统消息和下一条用户消息被合并为一条用户消息
+	user := messages[2].Content
+	wantTypes := []string{"tool_result", "tool_result", "text", "text", "image", "image"}
+	if types := blockTypes(user); !reflect.DeepEqual(types, wantTypes) {
+		t.Fatalf("user blocks = %v, want %v", types, wantTypes)
+	}
+	if user[0].ToolUseID != "t1" || user[0].Content != "package a" {
+		t.Errorf("tool_result = %+v", user[0])
+	}
+	if user[2].Text != "<system>\nFiles were restored by /undo.\n</system>" {
+		t.Errorf("system note = %q", user[2].Text)
+	}
+	if src := user[4].Source; src.Type != "base64" || src.MediaType != "image/png" || src.Data != "AAAA" {
+		t.Errorf("data URL image = %+v", src)
+	}
+	if src := user[5].Source; src.Type != "url" || src.URL != "https://example.com/a.png" {
+		t.Errorf("URL image = %+v", src)
+	}
+
+	if len(messages[3].Content) != 1 || messages[3].Content[0].Text != "Done." {
+		t.Errorf("last assistant = %+v", messages[3].Content)
+	}
+}
+
+func TestNewValidatesThinkingBudget(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ProviderConfig
+		ok   bool
+	}{
+		{"no key", config.ProviderConfig{}, false},
+		{"budget too small", config.ProviderConfig{APIKey: "k", ThinkingBudget: 100}, false},
+		{"max tokens below budget", config.ProviderConfig{APIKey: "k", ThinkingBudget: 2048, MaxTokens: 2048}, false},
+		{"valid", config.ProviderConfig{APIKey: "k", ThinkingBudget: 2048, MaxTokens: 4096}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if (err == nil) != tt.ok {
+				t.Errorf("New error = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func blockTypes(blocks []contentBlock) []string {
+	types := make([]string, len(blocks))
+	for i, b := range blocks {
+		types[i] = b.Type
+	}
+	return types
+}
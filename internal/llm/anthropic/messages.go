@@ -0,0 +1,195 @@
+// internal/llm/anthropic/messages.go
+package anthropic
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/synapse/internal/llm"
+)
+
+// request 是 Messages API 的请求体。
+type request struct {
+	Model         string          `json:"model"`
+	MaxTokens     int             `json:"max_tokens"`
+	System        string          `json:"system,omitempty"`
+	Messages      []message       `json:"messages"`
+	Tools         []toolDef       `json:"tools,omitempty"`
+	Thinking      *thinkingConfig `json:"thinking,omitempty"`
+	Temperature   *float32        `json:"temperature,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stream        bool            `json:"stream"`
+}
+
+type thinkingConfig struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type toolDef struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// message 是 Messages API 中的一条消息，角色只有 "user" 和 "assistant"。
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+// contentBlock 是消息中的一个内容块。不同类型使用不同的字段：
+// text 使用 Text；tool_use 使用 ID、Name 和 Input；tool_result 使用 ToolUseID 和 Content；
+// thinking 使用 Thinking 和 Signature；redacted_thinking 使用 Data；image 使用 Source。
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	Data      string          `json:"data,omitempty"`
+	Source    *imageSource    `json:"source,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"` // "base64" 或 "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type errorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// convertMessages 把会话历史转换为 Messages API 的 system 和消息列表：
+//   - 开头的系统消息合并为 system；之后的系统消息（例如撤销通知、添加的文件）作为用户消息中的文本发送，
+//     因为 Messages API 不支持在对话中间插入系统消息
+//   - 助手的工具调用转换为 tool_use 块，工具结果转换为用户消息中的 tool_result 块
+//   - 相邻的同角色消息被合并，使用户和助手严格交替
+func (p *AnthropicProvider) convertMessages(history []llm.Message) (string, []message) {
+	var (
+		system   []string
+		messages []message
+	)
+	add := func(role string, blocks ...contentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+			return
+		}
+		messages = append(messages, message{Role: role, Content: blocks})
+	}
+
+	for i, msg := range history {
+		switch msg.Role {
+		case llm.RoleSystem:
+			if len(messages) == 0 {
+				system = append(system, msg.Content)
+				continue
+			}
+			add(llm.RoleUser, textBlocks("<system>\n"+msg.Content+"\n</system>")...)
+		case llm.RoleUser:
+			add(llm.RoleUser, userBlocks(msg)...)
+		case llm.RoleAssistant:
+			var blocks []contentBlock
+			if len(msg.ToolCalls) > 0 && isLastAssistant(history, i) {
+				blocks = append(blocks, p.rememberedThinking(msg.ToolCalls[0].ID)...)
+			}
+			blocks = append(blocks, textBlocks(msg.Content)...)
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, contentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Name,
+					Input: toolInput(call.Arguments),
+				})
+			}
+			add(llm.RoleAssistant, blocks...)
+		case llm.RoleTool:
+			add(llm.RoleUser, contentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		}
+	}
+	return strings.Join(system, "\n\n"), messages
+}
+
+// isLastAssistant 判断 history[i] 是否是最后一条助手消息。
+// 只有当前工具调用循环中的思考块需要返回给 API，更早的会被忽略。
+func isLastAssistant(history []llm.Message, i int) bool {
+	for _, msg := range history[i+1:] {
+		if msg.Role == llm.RoleAssistant {
+			return false
+		}
+	}
+	return true
+}
+
+// userBlocks 转换用户消息，包括多模态消息中的图片。
+func userBlocks(msg llm.Message) []contentBlock {
+	if len(msg.Parts) == 0 {
+		return textBlocks(msg.Content)
+	}
+	var blocks []contentBlock
+	for _, part := range msg.Parts {
+		switch part.Type {
+		case llm.PartText:
+			blocks = append(blocks, textBlocks(part.Text)...)
+		case llm.PartImage:
+			blocks = append(blocks, contentBlock{Type: "image", Source: imageSourceFor(part.ImageURL)})
+		}
+	}
+	return blocks
+}
+
+// imageSourceFor 把 data URL 转换为 base64 图片，其他 URL 原样引用。
+func imageSourceFor(url string) *imageSource {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if meta, data, ok := strings.Cut(rest, ","); ok && strings.HasSuffix(meta, ";base64") {
+			return &imageSource{Type: "base64", MediaType: strings.TrimSuffix(meta, ";base64"), Data: data}
+		}
+	}
+	return &imageSource{Type: "url", URL: url}
+}
+
+// textBlocks 返回包含 text 的文本块。API 不接受空的文本块，因此 text 为空时返回 nil。
+func textBlocks(text string) []contentBlock {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	return []contentBlock{{Type: "text", Text: text}}
+}
+
+// toolInput 把工具调用的 JSON 参数转换为 tool_use 块的 input，它必须是一个对象。
+func toolInput(arguments string) json.RawMessage {
+	var input map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil || input == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// convertTools 把工具转换为 Messages API 的工具定义。
+func convertTools(tools []llm.Tool) []toolDef {
+	defs := make([]toolDef, 0, len(tools))
+	for _, t := range tools {
+		schema := t.Parameters
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = json.RawMessage(`{"type": "object", "properties": {}}`)
+		}
+		defs = append(defs, toolDef{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: schema,
+		})
+	}
+	return defs
+}
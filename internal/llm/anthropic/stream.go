@@ -0,0 +1,219 @@
+// internal/llm/anthropic/stream.go
+package anthropic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/synapse/internal/llm"
+)
+
+// streamEvent 是流中的一个事件。type 决定哪些字段有值。
+type streamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	Message      *startMessage `json:"message"`
+	ContentBlock *contentBlock `json:"content_block"`
+	Delta        *eventDelta   `json:"delta"`
+	Usage        *usage        `json:"usage"`
+	Error        *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type startMessage struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+	Usage usage  `json:"usage"`
+}
+
+// eventDelta 是 content_block_delta 或 message_delta 事件中的增量。
+type eventDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	PartialJSON string `json:"partial_json"`
+	Thinking    string `json:"thinking"`
+	Signature   string `json:"signature"`
+	StopReason  string `json:"stop_reason"`
+}
+
+type usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// blockState 记录一个正在接收的内容块。
+type blockState struct {
+	block     contentBlock
+	arguments strings.Builder // tool_use 块的参数，以 JSON 片段的形式到达
+}
+
+// stream 把 Messages API 的流式事件转换为统一的事件。
+type stream struct {
+	body     io.ReadCloser
+	events   *llm.SSEReader
+	remember func(toolUseID string, thinking []contentBlock)
+
+	usage     usage
+	blocks    map[int]*blockState // 以内容块的 index 为键
+	thinking  []contentBlock      // 已完成的思考块，按顺序排列
+	firstTool string              // 第一个 tool_use 块的 ID
+	done      bool
+}
+
+func newStream(body io.ReadCloser, remember func(string, []contentBlock)) *stream {
+	return &stream{
+		body:     body,
+		events:   llm.NewSSEReader(body),
+		remember: remember,
+		blocks:   make(map[int]*blockState),
+	}
+}
+
+// Recv 返回下一个事件。没有对应事件的 SSE 事件（例如 ping）被跳过。
+func (s *stream) Recv() (llm.Event, error) {
+	for {
+		if s.done {
+			return llm.Event{}, io.EOF
+		}
+		ev, err := s.events.Next()
+		if errors.Is(err, io.EOF) {
+			return llm.Event{}, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return llm.Event{}, err
+		}
+		var event streamEvent
+		if err := json.Unmarshal([]byte(ev.Data), &event); err != nil {
+			return llm.Event{}, fmt.Errorf("invalid stream event '%s': %w", ev.Event, err)
+		}
+		out, ok, err := s.handle(&event)
+		if err != nil {
+			return llm.Event{}, err
+		}
+		if ok {
+			return out, nil
+		}
+	}
+}
+
+// Close 关闭响应体。
+func (s *stream) Close() error {
+	return s.body.Close()
+}
+
+// handle 处理一个 SSE 事件。它对应一个统一的事件时 ok 为 true。
+func (s *stream) handle(event *streamEvent) (out llm.Event, ok bool, err error) {
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			s.usage = event.Message.Usage
+		}
+
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			return out, false, errors.New("content_block_start event without a content block")
+		}
+		state := &blockState{block: *event.ContentBlock}
+		s.blocks[event.Index] = state
+		switch state.block.Type {
+		case "text":
+			if state.block.Text != "" {
+				return llm.Event{Type: llm.EventText, Text: state.block.Text}, true, nil
+			}
+		case "thinking":
+			if state.block.Thinking != "" {
+				return llm.Event{Type: llm.EventReasoning, Text: state.block.Thinking}, true, nil
+			}
+		case "tool_use":
+			if s.firstTool == "" {
+				s.firstTool = state.block.ID
+			}
+		}
+
+	case "content_block_delta":
+		state, found := s.blocks[event.Index]
+		if !found || event.Delta == nil {
+			return out, false, nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			return llm.Event{Type: llm.EventText, Text: event.Delta.Text}, true, nil
+		case "thinking_delta":
+			state.block.Thinking += event.Delta.Thinking
+			return llm.Event{Type: llm.EventReasoning, Text: event.Delta.Thinking}, true, nil
+		case "signature_delta":
+			state.block.Signature += event.Delta.Signature
+		case "input_json_delta":
+			state.arguments.WriteString(event.Delta.PartialJSON)
+		}
+
+	case "content_block_stop":
+		state, found := s.blocks[event.Index]
+		if !found {
+			return out, false, nil
+		}
+		delete(s.blocks, event.Index)
+		switch state.block.Type {
+		case "thinking", "redacted_thinking":
+			s.thinking = append(s.thinking, state.block)
+		case "tool_use":
+			// 没有参数的工具调用不会收到 input_json_delta
+			arguments := state.arguments.String()
+			if arguments == "" {
+				arguments = "{}"
+			}
+			call := &llm.ToolCall{ID: state.block.ID, Name: state.block.Name, Arguments: arguments}
+			return llm.Event{Type: llm.EventToolCall, ToolCall: call}, true, nil
+		}
+
+	case "message_delta":
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+		}
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			return llm.Event{
+				Type:         llm.EventFinish,
+				FinishReason: finishReason(event.Delta.StopReason),
+				Usage: &llm.Usage{
+					PromptTokens:     s.usage.InputTokens,
+					CompletionTokens: s.usage.OutputTokens,
+					TotalTokens:      s.usage.InputTokens + s.usage.OutputTokens,
+				},
+			}, true, nil
+		}
+
+	case "message_stop":
+		s.done = true
+		if s.firstTool != "" && len(s.thinking) > 0 && s.remember != nil {
+			s.remember(s.firstTool, s.thinking)
+		}
+
+	case "error":
+		apiErr := &APIError{Type: "stream_error", Message: "unknown error"}
+		if event.Error != nil {
+			apiErr.Type, apiErr.Message = event.Error.Type, event.Error.Message
+		}
+		return out, false, apiErr
+	}
+	// ping 和未知的事件类型被忽略，API 可能会增加新的事件类型
+	return out, false, nil
+}
+
+// finishReason 转换 Messages API 的 stop_reason。
+func finishReason(stopReason string) llm.FinishReason {
+	switch stopReason {
+	case "tool_use":
+		return llm.FinishToolCalls
+	case "max_tokens":
+		return llm.FinishLength
+	case "refusal":
+		return llm.FinishContentFilter
+	default: // end_turn、stop_sequence、pause_turn
+		return llm.FinishStop
+	}
+}
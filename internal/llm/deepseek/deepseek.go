@@ -7,6 +7,7 @@ import (
 
 	"github.com/synapse/internal/config"
 	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/llm/openaicompat"
 	"github.com/synapse/internal/tool"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -35,11 +36,8 @@ func (p *DeepSeekProvider) Name() string {
 	return p.config.Name
 }
 
-func (p *DeepSeekProvider) CreateChatCompletionStream(ctx context.Context, req llm.ChatCompletionRequest) (*llm.ChatCompletionStream, error) {
-	if req.Model == "" {
-		req.Model = p.config.DefaultModel
-	}
-	return p.client.CreateChatCompletionStream(ctx, req)
+func (p *DeepSeekProvider) CreateStream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	return openaicompat.CreateStream(ctx, p.client, req, p.config.DefaultModel)
 }
 
 func (p *DeepSeekProvider) GetTools() []llm.Tool {
@@ -0,0 +1,83 @@
+// internal/llm/deepseek/deepseek_test.go
+package deepseek
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/llm"
+)
+
+func TestStreamReasoning(t *testing.T) {
+	transcript := strings.Join([]string{
+		`data: {"id":"1","choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"The user "}}]}`,
+		`data: {"id":"1","choices":[{"index":0,"delta":{"reasoning_content":"greets me."}}]}`,
+		`data: {"id":"1","choices":[{"index":0,"delta":{"content":"Hello!"}}]}`,
+		`data: {"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, transcript)
+	}))
+	t.Cleanup(server.Close)
+
+	p, err := New(config.ProviderConfig{Name: "deepseek", APIKey: "test-key", BaseURL: server.URL, DefaultModel: "deepseek-reasoner"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// 历史中上一轮的助手回复只有文本，推理内容不会随请求发回
+	stream, err := p.CreateStream(context.Background(), llm.Request{Messages: []llm.Message{
+		{Role: llm.RoleUser, Content: "Hi"},
+		{Role: llm.RoleAssistant, Content: "Hello!"},
+		{Role: llm.RoleUser, Content: "Hi again"},
+	}})
+	if err != nil {
+		t.Fatalf("CreateStream: %v", err)
+	}
+	defer stream.Close()
+	var events []llm.Event
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		events = append(events, ev)
+	}
+
+	// 推理内容作为单独的事件返回，不混入回复文本
+	want := []llm.Event{
+		{Type: llm.EventReasoning, Text: "The user "},
+		{Type: llm.EventReasoning, Text: "greets me."},
+		{Type: llm.EventText, Text: "Hello!"},
+		{Type: llm.EventFinish, FinishReason: llm.FinishStop},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if strings.Contains(string(body), "reasoning_content") {
+		t.Errorf("request carries reasoning content: %s", body)
+	}
+	if !strings.Contains(string(body), `"model":"deepseek-reasoner"`) {
+		t.Errorf("request does not use the default model: %s", body)
+	}
+}
+
+func TestNewRequiresAPIKey(t *testing.T) {
+	_, err := New(config.ProviderConfig{Name: "deepseek", APIKeyEnv: "DEEPSEEK_API_KEY"})
+	if err == nil || !strings.Contains(err.Error(), "DEEPSEEK_API_KEY") {
+		t.Errorf("New without a key error = %v, want one naming the variable", err)
+	}
+}
@@ -0,0 +1,177 @@
+// internal/llm/gemini/gemini.go
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+const (
+	defaultBaseURL = "https://generativelanguage.googleapis.com"
+	// maxRememberedSignatures 是为后续请求保留的函数调用思考签名的数量
+	maxRememberedSignatures = 64
+)
+
+// GeminiProvider 实现了 llm.LLMProvider 接口，使用 Gemini API 的 streamGenerateContent 接口，
+// 在会话的消息与 Gemini 的 contents/parts 之间转换。
+type GeminiProvider struct {
+	client *http.Client
+	config config.ProviderConfig
+
+	// 思考模型的函数调用带有 thoughtSignature，在函数调用循环中必须原样返回。
+	// 会话中的消息无法保存签名，因此在这里按我们生成的工具调用 ID 记住它们。
+	mu         sync.Mutex
+	signatures map[string]string
+	order      []string
+}
+
+// New 创建并返回一个新的 GeminiProvider 实例。
+func New(cfg config.ProviderConfig) (llm.LLMProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("API key for gemini is not set (env var: %s)", cfg.APIKeyEnv)
+	}
+	return &GeminiProvider{
+		client:     &http.Client{},
+		config:     cfg,
+		signatures: make(map[string]string),
+	}, nil
+}
+
+// Name 返回提供商的名称。
+func (p *GeminiProvider) Name() string {
+	return p.config.Name
+}
+
+// CreateStream 把请求转换为 generateContent 的格式并发起流式请求，
+// 返回的流把 Gemini 的响应转换为统一的事件：文本、functionCall 和思考摘要分别是文本、工具调用和推理事件。
+func (p *GeminiProvider) CreateStream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	model := strings.TrimPrefix(req.Model, "models/")
+	if model == "" {
+		model = strings.TrimPrefix(p.config.DefaultModel, "models/")
+	}
+	if model == "" {
+		return nil, errors.New("no model configured for gemini: set default_model")
+	}
+	body, err := json.Marshal(p.newRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint(model), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.config.APIKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, readAPIError(resp)
+	}
+	return newStream(resp.Body, p.rememberSignature), nil
+}
+
+// GetTools 返回所有默认的可用工具。
+func (p *GeminiProvider) GetTools() []llm.Tool {
+	return tool.GetDefaultTools()
+}
+
+// newRequest 把请求转换为 generateContent 的请求。
+func (p *GeminiProvider) newRequest(req llm.Request) *request {
+	system, contents := p.convertMessages(req.Messages)
+	r := &request{
+		SystemInstruction: system,
+		Contents:          contents,
+		Tools:             convertTools(req.Tools),
+	}
+
+	gen := generationConfig{StopSequences: req.Stop}
+	gen.MaxOutputTokens = req.MaxTokens
+	if gen.MaxOutputTokens == 0 {
+		gen.MaxOutputTokens = p.config.MaxTokens
+	}
+	if req.Temperature != 0 {
+		gen.Temperature = &req.Temperature
+	}
+	if p.config.ThinkingBudget != 0 {
+		gen.ThinkingConfig = &thinkingConfig{ThinkingBudget: p.config.ThinkingBudget, IncludeThoughts: true}
+	}
+	r.GenerationConfig = &gen
+	return r
+}
+
+// endpoint 返回模型的流式接口地址。base_url 可以带也可以不带 "/v1beta"。
+func (p *GeminiProvider) endpoint(model string) string {
+	base := p.config.BaseURL
+	if base == "" {
+		base = defaultBaseURL
+	}
+	base = strings.TrimSuffix(strings.TrimSuffix(base, "/"), "/v1beta")
+	return base + "/v1beta/models/" + url.PathEscape(model) + ":streamGenerateContent?alt=sse"
+}
+
+// rememberSignature 记住一个函数调用的思考签名，只保留最近的一些。
+func (p *GeminiProvider) rememberSignature(callID, signature string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.signatures[callID]; !ok {
+		p.order = append(p.order, callID)
+	}
+	p.signatures[callID] = signature
+	for len(p.order) > maxRememberedSignatures {
+		delete(p.signatures, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+func (p *GeminiProvider) rememberedSignature(callID string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.signatures[callID]
+}
+
+// APIError 是 Gemini API 返回的错误。
+type APIError struct {
+	StatusCode int    // 流中的错误为 0
+	Status     string // 例如 "INVALID_ARGUMENT"、"RESOURCE_EXHAUSTED"
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("gemini API error %d (%s): %s", e.StatusCode, e.Status, e.Message)
+	}
+	return fmt.Sprintf("gemini API error (%s): %s", e.Status, e.Message)
+}
+
+// readAPIError 从非 200 的响应中读取错误。错误响应可能是一个对象，也可能是只有一个对象的数组。
+func readAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var bodies []errorBody
+		if json.Unmarshal(data, &bodies) == nil && len(bodies) > 0 {
+			data, _ = json.Marshal(bodies[0])
+		}
+	}
+	var body errorBody
+	if err := json.Unmarshal(data, &body); err != nil || body.Error.Message == "" {
+		return &APIError{StatusCode: resp.StatusCode, Status: http.StatusText(resp.StatusCode), Message: string(data)}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Status: body.Error.Status, Message: body.Error.Message}
+}
@@ -0,0 +1,327 @@
+// internal/llm/gemini/gemini_test.go
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/llm"
+)
+
+// sse 把每个 JSON 响应作为一个 SSE 事件。
+func sse(responses ...string) string {
+	var sb strings.Builder
+	for _, r := range responses {
+		sb.WriteString("data: " + r + "\n\n")
+	}
+	return sb.String()
+}
+
+// newTestProvider 返回一个连接到 httptest 服务器的 provider。服务器对每个请求返回 transcript，
+// 并把收到的请求体写入 got。
+func newTestProvider(t *testing.T, cfg config.ProviderConfig, transcript string, got *request) *GeminiProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `[{"error":{"code":401,"message":"API key not valid","status":"UNAUTHENTICATED"}}]`)
+			return
+		}
+		if got != nil {
+			if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, transcript)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg.Name = "gemini"
+	cfg.BaseURL = server.URL + "/v1beta"
+	if cfg.APIKey == "" {
+		cfg.APIKey = "test-key"
+	}
+	cfg.DefaultModel = "models/gemini-test"
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p.(*GeminiProvider)
+}
+
+// collect 读取流中的所有事件，返回事件和结束时的错误（正常结束时为 nil）。
+func collect(t *testing.T, p *GeminiProvider, req llm.Request) ([]llm.Event, error) {
+	t.Helper()
+	stream, err := p.CreateStream(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var events []llm.Event
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestStreamText(t *testing.T) {
+	transcript := sse(
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":2,"totalTokenCount":10}}`,
+	)
+	var got request
+	p := newTestProvider(t, config.ProviderConfig{MaxTokens: 512}, transcript, &got)
+	events, err := collect(t, p, llm.Request{
+		Messages:    []llm.Message{{Role: llm.RoleSystem, Content: "Be brief."}, {Role: llm.RoleUser, Content: "Hi"}},
+		Temperature: 0.4,
+		Stop:        []string{"END"},
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	want := []llm.Event{
+		{Type: llm.EventText, Text: "Hel"},
+		{Type: llm.EventText, Text: "lo"},
+		{Type: llm.EventFinish, FinishReason: llm.FinishStop, Usage: &llm.Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if got.SystemInstruction == nil || got.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("systemInstruction = %+v", got.SystemInstruction)
+	}
+	gen := got.GenerationConfig
+	if gen == nil || gen.MaxOutputTokens != 512 || gen.Temperature == nil || *gen.Temperature != 0.4 || !reflect.DeepEqual(gen.StopSequences, []string{"END"}) {
+		t.Errorf("generationConfig = %+v", gen)
+	}
+	if gen != nil && gen.ThinkingConfig != nil {
+		t.Errorf("thinkingConfig = %+v, want none", gen.ThinkingConfig)
+	}
+}
+
+func TestStreamFunctionCallsAndThoughts(t *testing.T) {
+	transcript := sse(
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Which file?","thought":true}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"read_file","args":{"file_path":"a.go"}},"thoughtSignature":"sig-1"},{"functionCall":{"id":"fc_2","name":"list_directory"}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":4,"thoughtsTokenCount":6,"totalTokenCount":15}}`,
+	)
+	var got request
+	p := newTestProvider(t, config.ProviderConfig{ThinkingBudget: -1}, transcript, &got)
+	events, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Read a.go"}}})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4: %+v", len(events), events)
+	}
+	if events[0].Type != llm.EventReasoning || events[0].Text != "Which file?" {
+		t.Errorf("reasoning event = %+v", events[0])
+	}
+	first, second := events[1].ToolCall, events[2].ToolCall
+	if first == nil || first.Name != "read_file" || first.Arguments != `{"file_path":"a.go"}` || first.ID == "" {
+		t.Errorf("first tool call = %+v", first)
+	}
+	if second == nil || second.ID != "fc_2" || second.Arguments != "{}" {
+		t.Errorf("second tool call = %+v", second)
+	}
+	wantUsage := &llm.Usage{PromptTokens: 5, CompletionTokens: 10, TotalTokens: 15}
+	if events[3].FinishReason != llm.FinishToolCalls || !reflect.DeepEqual(events[3].Usage, wantUsage) {
+		t.Errorf("finish event = %+v", events[3])
+	}
+	if tc := got.GenerationConfig.ThinkingConfig; tc == nil || tc.ThinkingBudget != -1 || !tc.IncludeThoughts {
+		t.Errorf("thinkingConfig = %+v", tc)
+	}
+
+	// 下一次请求中，函数调用必须带回它的思考签名，函数结果按函数名对应
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "Read a.go"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{*first, *second}},
+		{Role: llm.RoleTool, ToolCallID: first.ID, Content: "package a"},
+		{Role: llm.RoleTool, ToolCallID: second.ID, Content: "a.go"},
+	}
+	_, contents := p.convertMessages(history)
+	if len(contents) != 3 {
+		t.Fatalf("got %d contents, want 3", len(contents))
+	}
+	calls := contents[1].Parts
+	if calls[0].ThoughtSignature != "sig-1" || calls[1].ThoughtSignature != "" {
+		t.Errorf("thought signatures = %q, %q", calls[0].ThoughtSignature, calls[1].ThoughtSignature)
+	}
+	results := contents[2].Parts
+	if len(results) != 2 || results[0].FunctionResponse.Name != "read_file" || results[1].FunctionResponse.Name != "list_directory" {
+		t.Fatalf("function responses = %+v", results)
+	}
+	if results[0].FunctionResponse.Response["result"] != "package a" {
+		t.Errorf("function response = %+v", results[0].FunctionResponse.Response)
+	}
+}
+
+func TestStreamFinishReasonsAndErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcript string
+		wantFinish llm.FinishReason
+		wantErr    func(error) bool
+	}{
+		{
+			name:       "max tokens",
+			transcript: sse(`{"candidates":[{"content":{"parts":[{"text":"abc"}]},"finishReason":"MAX_TOKENS"}]}`),
+			wantFinish: llm.FinishLength,
+		},
+		{
+			name:       "safety",
+			transcript: sse(`{"candidates":[{"content":{"parts":[]},"finishReason":"SAFETY"}]}`),
+			wantFinish: llm.FinishContentFilter,
+		},
+		{
+			name:       "eof before finish",
+			transcript: sse(`{"candidates":[{"content":{"parts":[{"text":"abc"}]}}]}`),
+			wantErr:    func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) },
+		},
+		{
+			name:       "error in stream",
+			transcript: sse(`{"error":{"code":503,"message":"The model is overloaded.","status":"UNAVAILABLE"}}`),
+			wantErr: func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && apiErr.Status == "UNAVAILABLE" && apiErr.StatusCode == 0
+			},
+		},
+		{
+			name:       "blocked prompt",
+			transcript: sse(`{"promptFeedback":{"blockReason":"SAFETY"}}`),
+			wantErr: func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && apiErr.Status == "SAFETY"
+			},
+		},
+		{
+			name:       "malformed function call",
+			transcript: sse(`{"candidates":[{"content":{"parts":[]},"finishReason":"MALFORMED_FUNCTION_CALL"}]}`),
+			wantErr: func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && apiErr.Status == "MALFORMED_FUNCTION_CALL"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t, config.ProviderConfig{}, tt.transcript, nil)
+			events, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}})
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("err = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stream: %v", err)
+			}
+			last := events[len(events)-1]
+			if last.Type != llm.EventFinish || last.FinishReason != tt.wantFinish {
+				t.Errorf("last event = %+v, want finish %s", last, tt.wantFinish)
+			}
+		})
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	p := newTestProvider(t, config.ProviderConfig{APIKey: "wrong-key"}, "", nil)
+	_, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Status != "UNAUTHENTICATED" || apiErr.Message != "API key not valid" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
+
+func TestConvertMessages(t *testing.T) {
+	p := &GeminiProvider{signatures: make(map[string]string)}
+	history := []llm.Message{
+		{Role: llm.RoleSystem, Content: "You are Synapse."},
+		{Role: llm.RoleSystem, Content: "   "},
+		{Role: llm.RoleUser, Content: "Look at this"},
+		{Role: llm.RoleUser, Parts: []llm.ContentPart{
+			{Type: llm.PartImage, ImageURL: "data:image/jpeg;base64,BBBB"},
+			{Type: llm.PartImage, ImageURL: "gs://bucket/a.png"},
+		}},
+		{Role: llm.RoleAssistant, Content: "Checking.", ToolCalls: []llm.ToolCall{{ID: "c1", Name: "grep_search", Arguments: "not json"}}},
+		{Role: llm.RoleTool, ToolCallID: "c1", Content: "no matches"},
+		{Role: llm.RoleSystem, Content: "Files were restored by /undo."},
+		{Role: llm.RoleAssistant, Content: "OK."},
+	}
+	system, contents := p.convertMessages(history)
+	if system == nil || len(system.Parts) != 1 || system.Parts[0].Text != "You are Synapse." {
+		t.Errorf("systemInstruction = %+v", system)
+	}
+
+	var roles []string
+	for _, c := range contents {
+		roles = append(roles, c.Role)
+	}
+	if want := []string{"user", "model", "user", "model"}; !reflect.DeepEqual(roles, want) {
+		t.Fatalf("roles = %v, want %v", roles, want)
+	}
+	user := contents[0].Parts
+	if len(user) != 3 || user[0].Text != "Look at this" {
+		t.Fatalf("user parts = %+v", user)
+	}
+	if user[1].InlineData == nil || user[1].InlineData.MimeType != "image/jpeg" || user[1].InlineData.Data != "BBBB" {
+		t.Errorf("inline image = %+v", user[1].InlineData)
+	}
+	if user[2].FileData == nil || user[2].FileData.FileURI != "gs://bucket/a.png" {
+		t.Errorf("file image = %+v", user[2].FileData)
+	}
+	model := contents[1].Parts
+	if len(model) != 2 || model[0].Text != "Checking." || string(model[1].FunctionCall.Args) != "{}" {
+		t.Errorf("model parts = %+v", model)
+	}
+	results := contents[2].Parts
+	if len(results) != 2 || results[0].FunctionResponse == nil || results[0].FunctionResponse.Name != "grep_search" {
+		t.Fatalf("tool result parts = %+v", results)
+	}
+	if results[1].Text != "<system>\nFiles were restored by /undo.\n</system>" {
+		t.Errorf("system note = %q", results[1].Text)
+	}
+
+	if system, _ := p.convertMessages([]llm.Message{{Role: llm.RoleUser, Content: "Hi"}}); system != nil {
+		t.Errorf("systemInstruction without system messages = %+v", system)
+	}
+}
+
+func TestConvertTools(t *testing.T) {
+	if tools := convertTools(nil); tools != nil {
+		t.Errorf("convertTools(nil) = %+v, want nil", tools)
+	}
+	tools := convertTools([]llm.Tool{
+		{Name: "read_file", Description: "Read a file", Parameters: json.RawMessage(`{"type":"object"}`)},
+		{Name: "now", Parameters: json.RawMessage("null")},
+	})
+	if len(tools) != 1 || len(tools[0].FunctionDeclarations) != 2 {
+		t.Fatalf("tools = %+v", tools)
+	}
+	decls := tools[0].FunctionDeclarations
+	if string(decls[0].ParametersJSONSchema) != `{"type":"object"}` || decls[1].ParametersJSONSchema != nil {
+		t.Errorf("declarations = %+v", decls)
+	}
+}
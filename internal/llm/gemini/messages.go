@@ -0,0 +1,203 @@
+// internal/llm/gemini/messages.go
+package gemini
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/synapse/internal/llm"
+)
+
+// request 是 generateContent 的请求体。
+type request struct {
+	SystemInstruction *content          `json:"systemInstruction,omitempty"`
+	Contents          []content         `json:"contents"`
+	Tools             []toolDef         `json:"tools,omitempty"`
+	GenerationConfig  *generationConfig `json:"generationConfig,omitempty"`
+}
+
+type generationConfig struct {
+	MaxOutputTokens int             `json:"maxOutputTokens,omitempty"`
+	Temperature     *float32        `json:"temperature,omitempty"`
+	StopSequences   []string        `json:"stopSequences,omitempty"`
+	ThinkingConfig  *thinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// thinkingConfig 控制思考模型。ThinkingBudget 为 -1 表示由模型决定预算。
+type thinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts"`
+}
+
+// toolDef 包含一组函数声明。
+type toolDef struct {
+	FunctionDeclarations []functionDeclaration `json:"functionDeclarations"`
+}
+
+// functionDeclaration 描述一个工具。参数使用 parametersJsonSchema，
+// 它接受完整的 JSON Schema，而 parameters 只接受 OpenAPI 的一个子集。
+type functionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+// content 是一条消息，角色只有 "user" 和 "model"。
+type content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []part `json:"parts"`
+}
+
+// part 是消息的一部分，只有一个字段有值。
+type part struct {
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"` // 文本是思考摘要
+	ThoughtSignature string            `json:"thoughtSignature,omitempty"`
+	InlineData       *blob             `json:"inlineData,omitempty"`
+	FileData         *fileData         `json:"fileData,omitempty"`
+	FunctionCall     *functionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *functionResponse `json:"functionResponse,omitempty"`
+}
+
+type blob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+type fileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type functionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// functionResponse 是工具的执行结果。Response 必须是一个 JSON 对象。
+type functionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type errorBody struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// convertMessages 把会话历史转换为 systemInstruction 和 contents：
+//   - 开头的系统消息合并为 systemInstruction；之后的系统消息作为用户消息中的文本发送
+//   - 助手的工具调用转换为 functionCall，工具结果转换为用户消息中的 functionResponse。
+//     Gemini 通过函数名对应调用和结果，因此从之前的助手消息中查找每个调用 ID 对应的函数名
+//   - 相邻的同角色消息被合并，使一次调用的所有结果在同一条消息中
+func (p *GeminiProvider) convertMessages(history []llm.Message) (*content, []content) {
+	var (
+		system   []part
+		contents []content
+	)
+	names := make(map[string]string)
+	add := func(role string, parts ...part) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			return
+		}
+		contents = append(contents, content{Role: role, Parts: parts})
+	}
+
+	for _, msg := range history {
+		switch msg.Role {
+		case llm.RoleSystem:
+			if len(contents) == 0 {
+				system = append(system, textParts(msg.Content)...)
+				continue
+			}
+			add("user", textParts("<system>\n"+msg.Content+"\n</system>")...)
+		case llm.RoleUser:
+			add("user", userParts(msg)...)
+		case llm.RoleAssistant:
+			parts := textParts(msg.Content)
+			for _, call := range msg.ToolCalls {
+				names[call.ID] = call.Name
+				parts = append(parts, part{
+					FunctionCall:     &functionCall{Name: call.Name, Args: functionArgs(call.Arguments)},
+					ThoughtSignature: p.rememberedSignature(call.ID),
+				})
+			}
+			add("model", parts...)
+		case llm.RoleTool:
+			add("user", part{FunctionResponse: &functionResponse{
+				Name:     names[msg.ToolCallID],
+				Response: map[string]any{"result": msg.Content},
+			}})
+		}
+	}
+
+	if len(system) == 0 {
+		return nil, contents
+	}
+	return &content{Parts: system}, contents
+}
+
+// userParts 转换用户消息，包括多模态消息中的图片。
+func userParts(msg llm.Message) []part {
+	if len(msg.Parts) == 0 {
+		return textParts(msg.Content)
+	}
+	var parts []part
+	for _, p := range msg.Parts {
+		switch p.Type {
+		case llm.PartText:
+			parts = append(parts, textParts(p.Text)...)
+		case llm.PartImage:
+			if rest, ok := strings.CutPrefix(p.ImageURL, "data:"); ok {
+				if meta, data, ok := strings.Cut(rest, ","); ok && strings.HasSuffix(meta, ";base64") {
+					parts = append(parts, part{InlineData: &blob{MimeType: strings.TrimSuffix(meta, ";base64"), Data: data}})
+				}
+				continue
+			}
+			parts = append(parts, part{FileData: &fileData{FileURI: p.ImageURL}})
+		}
+	}
+	return parts
+}
+
+// textParts 返回包含 text 的文本部分，text 为空时返回 nil。
+func textParts(text string) []part {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	return []part{{Text: text}}
+}
+
+// functionArgs 把工具调用的 JSON 参数转换为 functionCall 的 args，它必须是一个对象。
+func functionArgs(arguments string) json.RawMessage {
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// convertTools 把工具转换为函数声明。
+func convertTools(tools []llm.Tool) []toolDef {
+	var decls []functionDeclaration
+	for _, t := range tools {
+		decl := functionDeclaration{Name: t.Name, Description: t.Description}
+		if len(t.Parameters) > 0 && string(t.Parameters) != "null" {
+			decl.ParametersJSONSchema = t.Parameters
+		}
+		decls = append(decls, decl)
+	}
+	if len(decls) == 0 {
+		return nil
+	}
+	return []toolDef{{FunctionDeclarations: decls}}
+}
@@ -0,0 +1,174 @@
+// internal/llm/gemini/stream.go
+package gemini
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/synapse/internal/llm"
+)
+
+// response 是流中的一个 GenerateContentResponse。文本是增量，函数调用总是完整的。
+type response struct {
+	Candidates []struct {
+		Content      content `json:"content"`
+		FinishReason string  `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+	Error        *struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// stream 把 streamGenerateContent 的 SSE 响应转换为统一的事件。
+// 一个响应中可能包含多个部分，它们转换出的事件依次返回。
+type stream struct {
+	body     io.ReadCloser
+	events   *llm.SSEReader
+	remember func(callID, signature string)
+
+	callID    string // 本次回复中工具调用 ID 的前缀，Gemini API 通常不提供调用 ID
+	toolCount int
+	pending   []llm.Event
+	finished  bool // 是否收到了 finishReason
+	done      bool
+}
+
+func newStream(body io.ReadCloser, remember func(string, string)) *stream {
+	return &stream{body: body, events: llm.NewSSEReader(body), remember: remember, callID: newCallID()}
+}
+
+// Recv 返回下一个事件。Gemini 在最后一个响应之后直接关闭流，没有结束事件。
+func (s *stream) Recv() (llm.Event, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return llm.Event{}, io.EOF
+		}
+		ev, err := s.events.Next()
+		if errors.Is(err, io.EOF) {
+			s.done = true
+			if !s.finished {
+				return llm.Event{}, io.ErrUnexpectedEOF
+			}
+			continue
+		}
+		if err != nil {
+			return llm.Event{}, err
+		}
+		var resp response
+		if err := json.Unmarshal([]byte(ev.Data), &resp); err != nil {
+			return llm.Event{}, fmt.Errorf("invalid stream event: %w", err)
+		}
+		if err := s.handle(&resp); err != nil {
+			return llm.Event{}, err
+		}
+	}
+	event := s.pending[0]
+	s.pending = s.pending[1:]
+	return event, nil
+}
+
+// Close 关闭响应体。
+func (s *stream) Close() error {
+	return s.body.Close()
+}
+
+// handle 把一个响应转换为事件，加入待返回的队列。
+func (s *stream) handle(resp *response) error {
+	if resp.Error != nil {
+		return &APIError{Status: resp.Error.Status, Message: resp.Error.Message}
+	}
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		return &APIError{Status: resp.PromptFeedback.BlockReason, Message: "the prompt was blocked"}
+	}
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	candidate := resp.Candidates[0]
+	if candidate.FinishReason == "MALFORMED_FUNCTION_CALL" {
+		return &APIError{Status: candidate.FinishReason, Message: "the model generated an invalid function call"}
+	}
+
+	for _, p := range candidate.Content.Parts {
+		switch {
+		case p.FunctionCall != nil:
+			call := s.toolCall(p.FunctionCall)
+			if p.ThoughtSignature != "" && s.remember != nil {
+				s.remember(call.ID, p.ThoughtSignature)
+			}
+			s.pending = append(s.pending, llm.Event{Type: llm.EventToolCall, ToolCall: call})
+		case p.Text == "":
+		case p.Thought:
+			s.pending = append(s.pending, llm.Event{Type: llm.EventReasoning, Text: p.Text})
+		default:
+			s.pending = append(s.pending, llm.Event{Type: llm.EventText, Text: p.Text})
+		}
+	}
+
+	if candidate.FinishReason != "" {
+		s.finished = true
+		finish := llm.Event{Type: llm.EventFinish, FinishReason: s.finishReason(candidate.FinishReason)}
+		if u := resp.UsageMetadata; u != nil {
+			finish.Usage = &llm.Usage{
+				PromptTokens:     u.PromptTokenCount,
+				CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+				TotalTokens:      u.TotalTokenCount,
+			}
+		}
+		s.pending = append(s.pending, finish)
+	}
+	return nil
+}
+
+// toolCall 把一个 functionCall 转换为完整的工具调用。
+func (s *stream) toolCall(call *functionCall) *llm.ToolCall {
+	index := s.toolCount
+	s.toolCount++
+	id := call.ID
+	if id == "" {
+		id = fmt.Sprintf("call_%s_%d", s.callID, index)
+	}
+	args := string(call.Args)
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+	return &llm.ToolCall{ID: id, Name: call.Name, Arguments: args}
+}
+
+// finishReason 转换 Gemini 的 finishReason。
+func (s *stream) finishReason(reason string) llm.FinishReason {
+	switch reason {
+	case "STOP":
+		if s.toolCount > 0 {
+			return llm.FinishToolCalls
+		}
+		return llm.FinishStop
+	case "MAX_TOKENS":
+		return llm.FinishLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return llm.FinishContentFilter
+	default:
+		return llm.FinishStop
+	}
+}
+
+func newCallID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,127 @@
+// internal/llm/ollama/messages.go
+package ollama
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/synapse/internal/llm"
+)
+
+// chatRequest 是 /api/chat 的请求体。
+type chatRequest struct {
+	Model     string         `json:"model"`
+	Messages  []chatMessage  `json:"messages"`
+	Tools     []toolDef      `json:"tools,omitempty"`
+	Stream    bool           `json:"stream"`
+	KeepAlive any            `json:"keep_alive,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
+}
+
+// toolDef 是工具定义，格式与 OpenAI 的函数工具相同。
+type toolDef struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type chatMessage struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    []string   `json:"images,omitempty"` // base64 编码的图片
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"` // 工具结果对应的工具
+}
+
+// toolCall 是 Ollama 格式的工具调用。与 OpenAI 不同，参数是 JSON 对象而不是字符串，并且没有 ID。
+type toolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// chatResponse 是流中的一行。最后一行的 Done 为 true，并带有统计信息。
+type chatResponse struct {
+	Model           string      `json:"model"`
+	Message         chatMessage `json:"message"`
+	Done            bool        `json:"done"`
+	DoneReason      string      `json:"done_reason"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	EvalCount       int         `json:"eval_count"`
+	Error           string      `json:"error"`
+}
+
+// convertMessages 把会话历史转换为 /api/chat 的消息。Ollama 的工具结果通过工具名而不是调用 ID 对应，
+// 因此从之前的助手消息中查找每个调用 ID 对应的工具名。
+func convertMessages(history []llm.Message) []chatMessage {
+	names := make(map[string]string)
+	messages := make([]chatMessage, 0, len(history))
+	for _, msg := range history {
+		out := chatMessage{Role: msg.Role, Content: msg.Content}
+		switch msg.Role {
+		case llm.RoleUser:
+			out.Content, out.Images = userContent(msg)
+		case llm.RoleAssistant:
+			for _, call := range msg.ToolCalls {
+				names[call.ID] = call.Name
+				var tc toolCall
+				tc.Function.Name = call.Name
+				tc.Function.Arguments = toolArguments(call.Arguments)
+				out.ToolCalls = append(out.ToolCalls, tc)
+			}
+		case llm.RoleTool:
+			out.ToolName = names[msg.ToolCallID]
+		}
+		messages = append(messages, out)
+	}
+	return messages
+}
+
+// userContent 返回用户消息的文本和 base64 图片。Ollama 只接受内联的图片，其他 URL 被忽略。
+func userContent(msg llm.Message) (string, []string) {
+	if len(msg.Parts) == 0 {
+		return msg.Content, nil
+	}
+	var (
+		text   []string
+		images []string
+	)
+	for _, part := range msg.Parts {
+		switch part.Type {
+		case llm.PartText:
+			text = append(text, part.Text)
+		case llm.PartImage:
+			if _, data, ok := strings.Cut(part.ImageURL, ";base64,"); ok && strings.HasPrefix(part.ImageURL, "data:") {
+				images = append(images, data)
+			}
+		}
+	}
+	return strings.Join(text, "\n"), images
+}
+
+// toolArguments 把 JSON 字符串形式的参数转换为对象，不合法时使用空对象。
+func toolArguments(arguments string) json.RawMessage {
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// convertTools 把工具转换为 /api/chat 的工具定义。
+func convertTools(tools []llm.Tool) []toolDef {
+	defs := make([]toolDef, 0, len(tools))
+	for _, t := range tools {
+		def := toolDef{Type: "function"}
+		def.Function.Name = t.Name
+		def.Function.Description = t.Description
+		def.Function.Parameters = t.Parameters
+		defs = append(defs, def)
+	}
+	return defs
+}
@@ -0,0 +1,244 @@
+// internal/llm/ollama/ollama.go
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+const defaultBaseURL = "http://localhost:11434"
+
+// OllamaProvider 实现了 llm.LLMProvider 接口，使用 Ollama 原生的 /api/chat 接口，
+// 而不是它兼容 OpenAI 的 /v1 接口，从而可以设置 keep_alive 和模型参数。
+// 对于不支持原生工具调用的模型，工具调用改为在文本中描述和解析（见 texttools.go）。
+type OllamaProvider struct {
+	client *http.Client
+	config config.ProviderConfig
+
+	mu        sync.Mutex
+	textTools map[string]bool // 已知不支持原生工具调用的模型
+}
+
+// New 创建并返回一个新的 OllamaProvider 实例。Ollama 不需要 API key；
+// 如果配置了，它会作为 Bearer token 发送，用于前面有认证代理的服务器。
+func New(cfg config.ProviderConfig) (llm.LLMProvider, error) {
+	return &OllamaProvider{
+		client:    &http.Client{},
+		config:    cfg,
+		textTools: make(map[string]bool),
+	}, nil
+}
+
+// Name 返回提供商的名称。
+func (p *OllamaProvider) Name() string {
+	return p.config.Name
+}
+
+// CreateStream 发起一个流式聊天请求。模型不支持原生工具调用时，
+// 自动改用文本格式的工具调用重试，并在之后对这个模型一直使用文本格式。
+func (p *OllamaProvider) CreateStream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	if req.Model == "" {
+		req.Model = p.config.DefaultModel
+	}
+	if req.Model == "" {
+		return nil, errors.New("no model configured for ollama: set default_model to an installed model (see /models)")
+	}
+
+	textTools := len(req.Tools) > 0 && p.usesTextTools(req.Model)
+	resp, err := p.chat(ctx, req, textTools)
+	var apiErr *APIError
+	if !textTools && len(req.Tools) > 0 && errors.As(err, &apiErr) && apiErr.toolsUnsupported() {
+		p.mu.Lock()
+		p.textTools[req.Model] = true
+		p.mu.Unlock()
+		textTools = true
+		resp, err = p.chat(ctx, req, textTools)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newStream(resp.Body, textTools), nil
+}
+
+// GetTools 返回所有默认的可用工具。
+func (p *OllamaProvider) GetTools() []llm.Tool {
+	return tool.GetDefaultTools()
+}
+
+// ListModels 返回本地已安装的模型。
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url("/api/tags"), nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(httpReq)
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("invalid model list: %w", err)
+	}
+	names := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		names = append(names, m.Name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// chat 发送 /api/chat 请求，返回状态为 200 的响应。
+func (p *OllamaProvider) chat(ctx context.Context, req llm.Request, textTools bool) (*http.Response, error) {
+	body, err := json.Marshal(p.newRequest(req, textTools))
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/api/chat"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.setHeaders(httpReq)
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, readAPIError(resp)
+	}
+	return resp, nil
+}
+
+func (p *OllamaProvider) newRequest(req llm.Request, textTools bool) *chatRequest {
+	r := &chatRequest{
+		Model:     req.Model,
+		Stream:    true,
+		KeepAlive: keepAlive(p.config.KeepAlive),
+		Options:   p.options(req),
+	}
+	if textTools {
+		r.Messages = convertTextToolMessages(req.Messages, req.Tools)
+	} else {
+		r.Messages = convertMessages(req.Messages)
+		r.Tools = convertTools(req.Tools)
+	}
+	return r
+}
+
+// options 合并配置中的模型参数和请求中的参数，配置优先。
+func (p *OllamaProvider) options(req llm.Request) map[string]any {
+	options := maps.Clone(p.config.Options)
+	if options == nil {
+		options = make(map[string]any)
+	}
+	setDefault := func(key string, value any) {
+		if _, ok := options[key]; !ok {
+			options[key] = value
+		}
+	}
+	switch {
+	case req.MaxTokens > 0:
+		setDefault("num_predict", req.MaxTokens)
+	case p.config.MaxTokens > 0:
+		setDefault("num_predict", p.config.MaxTokens)
+	}
+	if req.Temperature != 0 {
+		setDefault("temperature", req.Temperature)
+	}
+	if len(req.Stop) > 0 {
+		setDefault("stop", req.Stop)
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+func (p *OllamaProvider) usesTextTools(model string) bool {
+	if p.config.TextToolCalls {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.textTools[model]
+}
+
+// url 返回 API 路径的完整地址。base_url 可以带 OpenAI 兼容接口的 "/v1" 后缀。
+func (p *OllamaProvider) url(path string) string {
+	base := p.config.BaseURL
+	if base == "" {
+		base = defaultBaseURL
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(base, "/"), "/v1") + path
+}
+
+func (p *OllamaProvider) setHeaders(req *http.Request) {
+	if p.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+}
+
+// keepAlive 转换 keep_alive 配置：数字表示秒数（负数表示一直保留），其他值是时长字符串，例如 "30m"。
+func keepAlive(value string) any {
+	if value == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds
+	}
+	return value
+}
+
+// APIError 是 Ollama 返回的错误。
+type APIError struct {
+	StatusCode int // 流中的错误为 0
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("ollama API error %d: %s", e.StatusCode, e.Message)
+	}
+	return "ollama API error: " + e.Message
+}
+
+// toolsUnsupported 判断错误是否表示模型不支持原生工具调用，
+// 例如 "registry.ollama.ai/library/gemma2:latest does not support tools"。
+func (e *APIError) toolsUnsupported() bool {
+	return e.StatusCode == http.StatusBadRequest && strings.Contains(e.Message, "does not support tools")
+}
+
+func readAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(data))
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: body.Error}
+}
@@ -0,0 +1,294 @@
+// internal/llm/ollama/ollama_test.go
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/config"
+	"github.com/synapse/internal/llm"
+)
+
+// ndjson 把每个 JSON 对象放在单独的一行。
+func ndjson(lines ...string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// collect 读取流中的所有事件，返回事件和结束时的错误（正常结束时为 nil）。
+func collect(t *testing.T, p llm.LLMProvider, req llm.Request) ([]llm.Event, error) {
+	t.Helper()
+	stream, err := p.CreateStream(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var events []llm.Event
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+// newTestProvider 返回一个连接到 handler 的 provider。
+func newTestProvider(t *testing.T, cfg config.ProviderConfig, handler http.HandlerFunc) llm.LLMProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cfg.Name = "ollama"
+	cfg.BaseURL = server.URL + "/v1"
+	if cfg.DefaultModel == "" {
+		cfg.DefaultModel = "llama3.2"
+	}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	var got chatRequest
+	p := newTestProvider(t, config.ProviderConfig{KeepAlive: "-1", MaxTokens: 256, Options: map[string]any{"num_ctx": 8192}},
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/chat" {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			io.WriteString(w, ndjson(
+				`{"model":"llama3.2","message":{"role":"assistant","content":"","thinking":"Let me look."},"done":false}`,
+				`{"model":"llama3.2","message":{"role":"assistant","content":"Reading "},"done":false}`,
+				``,
+				`{"model":"llama3.2","message":{"role":"assistant","content":"it.","tool_calls":[{"function":{"name":"read_file","arguments":{"file_path":"main.go"}}},{"function":{"name":"list_directory"}}]},"done":false}`,
+				`{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":30,"eval_count":12}`,
+			))
+		})
+	events, err := collect(t, p, llm.Request{
+		Messages:    []llm.Message{{Role: llm.RoleUser, Content: "Read main.go"}},
+		Tools:       []llm.Tool{{Name: "read_file", Parameters: json.RawMessage(`{"type":"object"}`)}},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	if len(events) != 6 {
+		t.Fatalf("got %d events, want 6: %+v", len(events), events)
+	}
+	if events[0].Type != llm.EventReasoning || events[0].Text != "Let me look." {
+		t.Errorf("reasoning event = %+v", events[0])
+	}
+	if events[1].Text != "Reading " || events[2].Text != "it." {
+		t.Errorf("text events = %+v, %+v", events[1], events[2])
+	}
+	first, second := events[3].ToolCall, events[4].ToolCall
+	if first == nil || first.Name != "read_file" || first.Arguments != `{"file_path":"main.go"}` {
+		t.Errorf("first tool call = %+v", first)
+	}
+	if second == nil || second.Name != "list_directory" || second.Arguments != "{}" {
+		t.Errorf("second tool call = %+v", second)
+	}
+	if first != nil && second != nil && first.ID == second.ID {
+		t.Errorf("tool calls share the ID %q", first.ID)
+	}
+	finish := events[5]
+	wantUsage := &llm.Usage{PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42}
+	if finish.Type != llm.EventFinish || finish.FinishReason != llm.FinishToolCalls || !reflect.DeepEqual(finish.Usage, wantUsage) {
+		t.Errorf("finish event = %+v", finish)
+	}
+
+	if got.Model != "llama3.2" || !got.Stream || len(got.Tools) != 1 {
+		t.Errorf("request = %+v", got)
+	}
+	if got.KeepAlive != float64(-1) {
+		t.Errorf("keep_alive = %#v, want -1", got.KeepAlive)
+	}
+	if got.Options["num_ctx"] != float64(8192) || got.Options["num_predict"] != float64(256) {
+		t.Errorf("options = %v, want num_ctx 8192 and num_predict 256", got.Options)
+	}
+	if temp, _ := got.Options["temperature"].(float64); temp < 0.19 || temp > 0.21 {
+		t.Errorf("temperature = %v, want 0.2", got.Options["temperature"])
+	}
+}
+
+func TestStreamLengthAndErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantFinish llm.FinishReason
+		wantErr    func(error) bool
+	}{
+		{
+			name:       "length",
+			body:       ndjson(`{"message":{"content":"abc"},"done":false}`, `{"message":{"content":""},"done":true,"done_reason":"length"}`),
+			wantFinish: llm.FinishLength,
+		},
+		{
+			name: "error line",
+			body: ndjson(`{"message":{"content":"abc"},"done":false}`, `{"error":"model runner has unexpectedly stopped"}`),
+			wantErr: func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "unexpectedly stopped")
+			},
+		},
+		{
+			name:    "eof before done",
+			body:    ndjson(`{"message":{"content":"abc"},"done":false}`),
+			wantErr: func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) },
+		},
+		{
+			name:    "invalid line",
+			body:    ndjson(`{"message":`),
+			wantErr: func(err error) bool { return err != nil && strings.Contains(err.Error(), "invalid stream line") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t, config.ProviderConfig{}, func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, tt.body)
+			})
+			events, err := collect(t, p, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}})
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("err = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stream: %v", err)
+			}
+			last := events[len(events)-1]
+			if last.Type != llm.EventFinish || last.FinishReason != tt.wantFinish {
+				t.Errorf("last event = %+v, want finish %s", last, tt.wantFinish)
+			}
+		})
+	}
+}
+
+func TestFallbackToTextTools(t *testing.T) {
+	var requests []chatRequest
+	p := newTestProvider(t, config.ProviderConfig{DefaultModel: "gemma2"}, func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		if len(req.Tools) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"registry.ollama.ai/library/gemma2:latest does not support tools"}`)
+			return
+		}
+		io.WriteString(w, ndjson(
+			`{"message":{"content":"Sure.\n<tool_"},"done":false}`,
+			`{"message":{"content":"call>\n{\"name\": \"read_file\", \"arguments\": {\"file_path\": \"a.go\"}}\n</tool_call>"},"done":false}`,
+			`{"message":{"content":""},"done":true,"done_reason":"stop"}`,
+		))
+	})
+	req := llm.Request{
+		Messages: []llm.Message{{Role: llm.RoleSystem, Content: "You are Synapse."}, {Role: llm.RoleUser, Content: "Read a.go"}},
+		Tools:    []llm.Tool{{Name: "read_file", Description: "Read a file", Parameters: json.RawMessage(`{"type":"object"}`)}},
+	}
+	events, err := collect(t, p, req)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(requests) != 2 || len(requests[1].Tools) != 0 {
+		t.Fatalf("got %d requests, want a native attempt and a text retry", len(requests))
+	}
+	if system := requests[1].Messages[0]; system.Role != llm.RoleSystem || !strings.Contains(system.Content, `"name":"read_file"`) {
+		t.Errorf("text tool system prompt = %q", system.Content)
+	}
+
+	var text string
+	var calls []*llm.ToolCall
+	for _, ev := range events {
+		switch ev.Type {
+		case llm.EventText:
+			text += ev.Text
+		case llm.EventToolCall:
+			calls = append(calls, ev.ToolCall)
+		}
+	}
+	if text != "Sure.\n" {
+		t.Errorf("text = %q, want %q", text, "Sure.\n")
+	}
+	if len(calls) != 1 || calls[0].Name != "read_file" || calls[0].Arguments != `{"file_path": "a.go"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+
+	// 之后对同一个模型直接使用文本格式
+	requests = nil
+	if _, err := collect(t, p, req); err != nil {
+		t.Fatalf("second stream: %v", err)
+	}
+	if len(requests) != 1 || len(requests[0].Tools) != 0 {
+		t.Errorf("second call sent %d requests, want one text request", len(requests))
+	}
+}
+
+func TestConvertMessages(t *testing.T) {
+	history := []llm.Message{
+		{Role: llm.RoleSystem, Content: "You are Synapse."},
+		{Role: llm.RoleUser, Parts: []llm.ContentPart{
+			{Type: llm.PartText, Text: "What is this?"},
+			{Type: llm.PartImage, ImageURL: "data:image/png;base64,AAAA"},
+			{Type: llm.PartImage, ImageURL: "https://example.com/a.png"},
+		}},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{
+			{ID: "c1", Name: "read_file", Arguments: `{"file_path":"a.go"}`},
+			{ID: "c2", Name: "grep_search", Arguments: `oops`},
+		}},
+		{Role: llm.RoleTool, ToolCallID: "c2", Content: "no matches"},
+		{Role: llm.RoleTool, ToolCallID: "c1", Content: "package a"},
+	}
+	messages := convertMessages(history)
+	if len(messages) != 5 {
+		t.Fatalf("got %d messages, want 5", len(messages))
+	}
+	if user := messages[1]; user.Content != "What is this?" || !reflect.DeepEqual(user.Images, []string{"AAAA"}) {
+		t.Errorf("user message = %+v", user)
+	}
+	calls := messages[2].ToolCalls
+	if len(calls) != 2 || string(calls[0].Function.Arguments) != `{"file_path":"a.go"}` || string(calls[1].Function.Arguments) != "{}" {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if messages[3].ToolName != "grep_search" || messages[4].ToolName != "read_file" {
+		t.Errorf("tool names = %q, %q", messages[3].ToolName, messages[4].ToolName)
+	}
+
+	text := convertTextToolMessages(history, []llm.Tool{{Name: "read_file"}})
+	if text[2].ToolCalls != nil || !strings.Contains(text[2].Content, toolCallOpen+"\n"+`{"name":"read_file","arguments":{"file_path":"a.go"}}`) {
+		t.Errorf("text assistant message = %q", text[2].Content)
+	}
+	if text[4].Role != llm.RoleUser || text[4].Content != "<tool_result name=\"read_file\">\npackage a\n</tool_result>" {
+		t.Errorf("text tool result = %+v", text[4])
+	}
+}
+
+func TestListModels(t *testing.T) {
+	p := newTestProvider(t, config.ProviderConfig{APIKey: "secret"}, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"models":[{"name":"qwen2.5-coder:7b"},{"name":"llama3.2:latest"}]}`)
+	})
+	names, err := p.(llm.ModelLister).ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"llama3.2:latest", "qwen2.5-coder:7b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("models = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,144 @@
+// internal/llm/ollama/stream.go
+package ollama
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/synapse/internal/llm"
+)
+
+// maxLineBytes 是流中一行 JSON 的最大长度
+const maxLineBytes = 16 * 1024 * 1024
+
+// stream 把 /api/chat 按行返回的 JSON 转换为统一的事件。
+type stream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+
+	text      *textToolParser // 使用文本格式的工具调用时不为 nil
+	callID    string          // 本次回复中工具调用 ID 的前缀，Ollama 不提供调用 ID
+	toolCount int
+	pending   []llm.Event
+	done      bool
+}
+
+func newStream(body io.ReadCloser, textTools bool) *stream {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	s := &stream{body: body, scanner: scanner, callID: newCallID()}
+	if textTools {
+		s.text = &textToolParser{}
+	}
+	return s
+}
+
+// Recv 返回下一个事件。没有内容的行被跳过。
+func (s *stream) Recv() (llm.Event, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return llm.Event{}, io.EOF
+		}
+		if !s.scanner.Scan() {
+			if err := s.scanner.Err(); err != nil {
+				return llm.Event{}, err
+			}
+			return llm.Event{}, io.ErrUnexpectedEOF
+		}
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var resp chatResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return llm.Event{}, fmt.Errorf("invalid stream line: %w", err)
+		}
+		if resp.Error != "" {
+			return llm.Event{}, &APIError{Message: resp.Error}
+		}
+		s.handle(&resp)
+	}
+	event := s.pending[0]
+	s.pending = s.pending[1:]
+	return event, nil
+}
+
+// Close 关闭响应体。
+func (s *stream) Close() error {
+	return s.body.Close()
+}
+
+// handle 把一行响应转换为事件，加入待返回的队列。
+func (s *stream) handle(resp *chatResponse) {
+	if resp.Message.Thinking != "" {
+		s.pending = append(s.pending, llm.Event{Type: llm.EventReasoning, Text: resp.Message.Thinking})
+	}
+	content := resp.Message.Content
+	var calls []*llm.ToolCall
+	for _, call := range resp.Message.ToolCalls {
+		calls = append(calls, s.toolCall(call.Function.Name, call.Function.Arguments))
+	}
+	if s.text != nil {
+		var textCalls []textToolCall
+		content, textCalls = s.text.feed(content)
+		if resp.Done {
+			rest, restCalls := s.text.flush()
+			content += rest
+			textCalls = append(textCalls, restCalls...)
+		}
+		for _, call := range textCalls {
+			calls = append(calls, s.toolCall(call.Name, call.Arguments))
+		}
+	}
+	if content != "" {
+		s.pending = append(s.pending, llm.Event{Type: llm.EventText, Text: content})
+	}
+	for _, call := range calls {
+		s.pending = append(s.pending, llm.Event{Type: llm.EventToolCall, ToolCall: call})
+	}
+
+	if resp.Done {
+		s.done = true
+		s.pending = append(s.pending, llm.Event{
+			Type:         llm.EventFinish,
+			FinishReason: s.finishReason(resp.DoneReason),
+			Usage: &llm.Usage{
+				PromptTokens:     resp.PromptEvalCount,
+				CompletionTokens: resp.EvalCount,
+				TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+			},
+		})
+	}
+}
+
+// toolCall 返回一个完整的工具调用。Ollama 在一行中返回整个调用，而不是分段返回参数。
+func (s *stream) toolCall(name string, arguments json.RawMessage) *llm.ToolCall {
+	index := s.toolCount
+	s.toolCount++
+	args := string(arguments)
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+	return &llm.ToolCall{ID: fmt.Sprintf("call_%s_%d", s.callID, index), Name: name, Arguments: args}
+}
+
+func (s *stream) finishReason(doneReason string) llm.FinishReason {
+	switch {
+	case s.toolCount > 0:
+		return llm.FinishToolCalls
+	case doneReason == "length":
+		return llm.FinishLength
+	default:
+		return llm.FinishStop
+	}
+}
+
+func newCallID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,199 @@
+// internal/llm/ollama/texttools.go
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/synapse/internal/llm"
+)
+
+// 不支持原生工具调用的模型在文本中调用工具。系统提示词中描述可用的工具和下面的格式，
+// 模型用一个或多个块调用工具，每个块包含一个带有 name 和 arguments 的 JSON 对象：
+//
+//	<tool_call>
+//	{"name": "read_file", "arguments": {"path": "main.go"}}
+//	</tool_call>
+//
+// 流中的这些块被解析为普通的工具调用，不会显示给用户；解析失败的块作为文本保留。
+// 工具结果以用户消息的形式返回给模型：
+//
+//	<tool_result name="read_file">
+//	...
+//	</tool_result>
+const (
+	toolCallOpen    = "<tool_call>"
+	toolCallClose   = "</tool_call>"
+	toolResultOpen  = "<tool_result name=%q>\n"
+	toolResultClose = "\n</tool_result>"
+)
+
+const textToolsPrompt = `# Tools
+
+You can call the tools below. Each one takes a JSON object of arguments that follows its JSON Schema.
+
+<tools>
+%s
+</tools>
+
+To call a tool, write a tool_call block that contains a JSON object with the tool's name and arguments:
+
+<tool_call>
+{"name": "tool_name", "arguments": {"argument": "value"}}
+</tool_call>
+
+You may write several tool_call blocks to call several tools. Stop writing after your tool calls: the results will be sent back to you in tool_result blocks. Never write tool_result blocks yourself.`
+
+// convertTextToolMessages 把会话历史转换为不使用原生工具调用的消息：
+// 工具描述加入系统提示词，助手的工具调用和工具结果都转换为文本块。
+func convertTextToolMessages(history []llm.Message, tools []llm.Tool) []chatMessage {
+	messages := convertMessages(history)
+	prompt := toolsPrompt(tools)
+	if len(messages) > 0 && messages[0].Role == llm.RoleSystem {
+		messages[0].Content += "\n\n" + prompt
+	} else {
+		messages = append([]chatMessage{{Role: llm.RoleSystem, Content: prompt}}, messages...)
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		switch msg.Role {
+		case llm.RoleAssistant:
+			var b strings.Builder
+			b.WriteString(msg.Content)
+			for _, call := range msg.ToolCalls {
+				data, _ := json.Marshal(textToolCall{Name: call.Function.Name, Arguments: call.Function.Arguments})
+				if b.Len() > 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(toolCallOpen + "\n" + string(data) + "\n" + toolCallClose)
+			}
+			msg.Content, msg.ToolCalls = b.String(), nil
+		case llm.RoleTool:
+			msg.Role = llm.RoleUser
+			msg.Content = fmt.Sprintf(toolResultOpen, msg.ToolName) + msg.Content + toolResultClose
+			msg.ToolName = ""
+		}
+	}
+	return messages
+}
+
+// toolsPrompt 返回描述 tools 和调用格式的系统提示词。
+func toolsPrompt(tools []llm.Tool) string {
+	var lines []string
+	for _, t := range tools {
+		data, err := json.Marshal(map[string]any{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		})
+		if err == nil {
+			lines = append(lines, string(data))
+		}
+	}
+	return fmt.Sprintf(textToolsPrompt, strings.Join(lines, "\n"))
+}
+
+// textToolCall 是 tool_call 块中的 JSON 对象。
+type textToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// textToolParser 从流式文本中分离出 tool_call 块。
+type textToolParser struct {
+	pending string // 尚未确定是否属于 tool_call 块的文本
+	inCall  bool
+}
+
+// feed 处理一段文本，返回可以显示的文本和已经完整的工具调用。
+// 可能是 "<tool_call>" 开头的文本会被保留，直到确定它是否为标签。
+func (p *textToolParser) feed(text string) (string, []textToolCall) {
+	p.pending += text
+	var (
+		content strings.Builder
+		calls   []textToolCall
+	)
+	for {
+		if p.inCall {
+			end := strings.Index(p.pending, toolCallClose)
+			if end < 0 {
+				break
+			}
+			body := p.pending[:end]
+			p.pending = p.pending[end+len(toolCallClose):]
+			p.inCall = false
+			if call, ok := parseTextToolCall(body); ok {
+				calls = append(calls, call)
+			} else {
+				content.WriteString(toolCallOpen + body + toolCallClose)
+			}
+			continue
+		}
+		if start := strings.Index(p.pending, toolCallOpen); start >= 0 {
+			content.WriteString(p.pending[:start])
+			p.pending = p.pending[start+len(toolCallOpen):]
+			p.inCall = true
+			continue
+		}
+		keep := partialTagLength(p.pending)
+		content.WriteString(p.pending[:len(p.pending)-keep])
+		p.pending = p.pending[len(p.pending)-keep:]
+		break
+	}
+	return content.String(), calls
+}
+
+// flush 在流结束时处理剩余的文本。模型经常省略最后一个块的结束标签，因此未结束的块也会尝试解析。
+func (p *textToolParser) flush() (string, []textToolCall) {
+	pending, inCall := p.pending, p.inCall
+	p.pending, p.inCall = "", false
+	if !inCall {
+		return pending, nil
+	}
+	if call, ok := parseTextToolCall(pending); ok {
+		return "", []textToolCall{call}
+	}
+	return toolCallOpen + pending, nil
+}
+
+// parseTextToolCall 解析 tool_call 块的内容。允许内容被 Markdown 代码块包裹，
+// 也接受 "parameters" 代替 "arguments"，以及被编码为字符串的参数。
+func parseTextToolCall(body string) (textToolCall, bool) {
+	body = strings.TrimSpace(body)
+	body = strings.TrimPrefix(body, "```json")
+	body = strings.TrimPrefix(body, "```")
+	body = strings.TrimSpace(strings.TrimSuffix(body, "```"))
+
+	var raw struct {
+		Name       string          `json:"name"`
+		Arguments  json.RawMessage `json:"arguments"`
+		Parameters json.RawMessage `json:"parameters"`
+	}
+	if err := json.Unmarshal([]byte(body), &raw); err != nil || raw.Name == "" {
+		return textToolCall{}, false
+	}
+	args := raw.Arguments
+	if len(args) == 0 {
+		args = raw.Parameters
+	}
+	var encoded string
+	if json.Unmarshal(args, &encoded) == nil {
+		args = json.RawMessage(encoded)
+	}
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	return textToolCall{Name: raw.Name, Arguments: args}, true
+}
+
+// partialTagLength 返回 s 末尾可能是 "<tool_call>" 开头部分的长度。
+func partialTagLength(s string) int {
+	for n := min(len(s), len(toolCallOpen)-1); n > 0; n-- {
+		if strings.HasSuffix(s, toolCallOpen[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+// internal/llm/ollama/texttools_test.go
+package ollama
+
+import (
+	"strings"
+	"testing"
+)
+
+// feedAll 按 chunks 的切分把文本交给解析器，最后调用 flush。
+func feedAll(chunks []string) (string, []textToolCall) {
+	var (
+		p       textToolParser
+		content strings.Builder
+		calls   []textToolCall
+	)
+	for _, chunk := range chunks {
+		text, c := p.feed(chunk)
+		content.WriteString(text)
+		calls = append(calls, c...)
+	}
+	text, c := p.flush()
+	content.WriteString(text)
+	return content.String(), append(calls, c...)
+}
+
+func TestTextToolParser(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantText  string
+		wantCalls []string // "name arguments"
+	}{
+		{
+			name:     "plain text",
+			input:    "Use a <b>tag</b> or x < y.",
+			wantText: "Use a <b>tag</b> or x < y.",
+		},
+		{
+			name:      "one call",
+			input:     "Let me check.\n<tool_call>\n{\"name\": \"read_file\", \"arguments\": {\"file_path\": \"a.go\"}}\n</tool_call>",
+			wantText:  "Let me check.\n",
+			wantCalls: []string{`read_file {"file_path": "a.go"}`},
+		},
+		{
+			name:      "two calls and trailing text",
+			input:     "<tool_call>{\"name\":\"a\",\"arguments\":{}}</tool_call>\n<tool_call>{\"name\":\"b\",\"arguments\":{\"x\":1}}</tool_call> done",
+			wantText:  "\n done",
+			wantCalls: []string{"a {}", `b {"x":1}`},
+		},
+		{
+			name:      "unclosed last call",
+			input:     "<tool_call>\n{\"name\": \"list_directory\", \"arguments\": {\"path\": \".\"}}",
+			wantCalls: []string{`list_directory {"path": "."}`},
+		},
+		{
+			name:      "markdown fence, parameters and string arguments",
+			input:     "<tool_call>\n```json\n{\"name\": \"grep_search\", \"parameters\": \"{\\\"pattern\\\": \\\"TODO\\\"}\"}\n```\n</tool_call>",
+			wantCalls: []string{`grep_search {"pattern": "TODO"}`},
+		},
+		{
+			name:     "invalid block stays text",
+			input:    "<tool_call>not json</tool_call>",
+			wantText: "<tool_call>not json</tool_call>",
+		},
+		{
+			name:     "invalid unclosed block stays text",
+			input:    "<tool_call>{\"name\":",
+			wantText: "<tool_call>{\"name\":",
+		},
+		{
+			name:     "partial tag at the end",
+			input:    "a <tool_",
+			wantText: "a <tool_",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 一次性输入和逐字节输入的结果必须相同
+			splits := map[string][]string{
+				"whole":   {tt.input},
+				"bytes":   strings.Split(tt.input, ""),
+				"halves":  {tt.input[:len(tt.input)/2], tt.input[len(tt.input)/2:]},
+				"tag cut": strings.SplitAfter(tt.input, "<tool"),
+			}
+			for how, chunks := range splits {
+				text, calls := feedAll(chunks)
+				if text != tt.wantText {
+					t.Errorf("%s: text = %q, want %q", how, text, tt.wantText)
+				}
+				var got []string
+				for _, c := range calls {
+					got = append(got, c.Name+" "+string(c.Arguments))
+				}
+				if strings.Join(got, "|") != strings.Join(tt.wantCalls, "|") {
+					t.Errorf("%s: calls = %q, want %q", how, got, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestPartialTagLength(t *testing.T) {
+	tests := map[string]int{
+		"":              0,
+		"hello":         0,
+		"hello <":       1,
+		"hello <tool_c": 7,
+		"<tool_call":    10,
+		"<tool_call>":   0, // 完整的标签由 feed 处理
+		"x <b":          0,
+	}
+	for input, want := range tests {
+		if got := partialTagLength(input); got != want {
+			t.Errorf("partialTagLength(%q) = %d, want %d", input, got, want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/synapse/internal/config"
 	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/llm/openaicompat"
 	"github.com/synapse/internal/tool"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -45,13 +46,10 @@ func (p *OpenAIProvider) Name() string {
 	return p.config.Name
 }
 
-// CreateChatCompletionStream 使用 OpenAI 客户端发起流式聊天请求。
-func (p *OpenAIProvider) CreateChatCompletionStream(ctx context.Context, req llm.ChatCompletionRequest) (*llm.ChatCompletionStream, error) {
-	// 如果请求中没有指定模型，则使用配置中的默认模型。
-	if req.Model == "" {
-		req.Model = p.config.DefaultModel
-	}
-	return p.client.CreateChatCompletionStream(ctx, req)
+// CreateStream 使用 OpenAI 客户端发起流式聊天请求。
+// 如果请求中没有指定模型，则使用配置中的默认模型。
+func (p *OpenAIProvider) CreateStream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	return openaicompat.CreateStream(ctx, p.client, req, p.config.DefaultModel)
 }
 
 // GetTools 返回所有默认的可用工具。
@@ -0,0 +1,177 @@
+// internal/llm/openaicompat/openaicompat.go
+package openaicompat
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/synapse/internal/llm"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// CreateStream 通过兼容 OpenAI Chat Completions 的 API 发起流式请求，
+// 把请求和响应在 Synapse 的类型与 OpenAI 格式之间转换。OpenAI 和 DeepSeek 等 provider 都是它的适配层。
+func CreateStream(ctx context.Context, client *openai.Client, req llm.Request, defaultModel string) (llm.Stream, error) {
+	stream, err := client.CreateChatCompletionStream(ctx, NewRequest(req, defaultModel))
+	if err != nil {
+		return nil, err
+	}
+	return NewStream(stream), nil
+}
+
+// NewRequest 把请求转换为 OpenAI 格式。请求中没有指定模型时使用 defaultModel。
+func NewRequest(req llm.Request, defaultModel string) openai.ChatCompletionRequest {
+	out := openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    make([]openai.ChatCompletionMessage, 0, len(req.Messages)),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stop:        req.Stop,
+		Stream:      true,
+	}
+	if out.Model == "" {
+		out.Model = defaultModel
+	}
+	for _, msg := range req.Messages {
+		out.Messages = append(out.Messages, convertMessage(msg))
+	}
+	for _, t := range req.Tools {
+		out.Tools = append(out.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return out
+}
+
+func convertMessage(msg llm.Message) openai.ChatCompletionMessage {
+	out := openai.ChatCompletionMessage{
+		Role:       msg.Role,
+		Content:    msg.Content,
+		ToolCallID: msg.ToolCallID,
+	}
+	if len(msg.Parts) > 0 {
+		out.Content = ""
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case llm.PartText:
+				out.MultiContent = append(out.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: part.Text})
+			case llm.PartImage:
+				out.MultiContent = append(out.MultiContent, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: part.ImageURL},
+				})
+			}
+		}
+	}
+	for _, call := range msg.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, openai.ToolCall{
+			ID:       call.ID,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+		})
+	}
+	return out
+}
+
+// stream 把 OpenAI 格式的增量转换为统一的事件。工具调用的名称和参数分多个增量到达，
+// 它们被累积起来，在回复结束时作为完整的工具调用返回。
+type stream struct {
+	stream  *openai.ChatCompletionStream
+	calls   []llm.ToolCall
+	pending []llm.Event
+	finish  *llm.Event // 已收到 finish_reason，等待可能随后到达的 usage
+	done    bool
+}
+
+// NewStream 把 go-openai 的流包装为 llm.Stream。
+func NewStream(s *openai.ChatCompletionStream) llm.Stream {
+	return &stream{stream: s}
+}
+
+func (s *stream) Recv() (llm.Event, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return llm.Event{}, io.EOF
+		}
+		response, err := s.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			s.finishStream()
+			continue
+		}
+		if err != nil {
+			return llm.Event{}, err
+		}
+		s.handle(response)
+	}
+	event := s.pending[0]
+	s.pending = s.pending[1:]
+	return event, nil
+}
+
+func (s *stream) Close() error {
+	return s.stream.Close()
+}
+
+func (s *stream) handle(response openai.ChatCompletionStreamResponse) {
+	if response.Usage != nil && s.finish != nil {
+		s.finish.Usage = convertUsage(response.Usage)
+	}
+	if len(response.Choices) == 0 {
+		return
+	}
+	choice := response.Choices[0]
+	delta := choice.Delta
+	if delta.ReasoningContent != "" {
+		s.pending = append(s.pending, llm.Event{Type: llm.EventReasoning, Text: delta.ReasoningContent})
+	}
+	if delta.Content != "" {
+		s.pending = append(s.pending, llm.Event{Type: llm.EventText, Text: delta.Content})
+	}
+	s.accumulateToolCalls(delta.ToolCalls)
+	if choice.FinishReason != "" && s.finish == nil {
+		s.finish = &llm.Event{Type: llm.EventFinish, FinishReason: llm.FinishReason(choice.FinishReason)}
+		if response.Usage != nil {
+			s.finish.Usage = convertUsage(response.Usage)
+		}
+	}
+}
+
+// accumulateToolCalls 从流式响应中逐步构建完整的工具调用列表
+func (s *stream) accumulateToolCalls(deltas []openai.ToolCall) {
+	for _, tcDelta := range deltas {
+		if tcDelta.Index == nil {
+			continue
+		}
+		idx := *tcDelta.Index
+		for len(s.calls) <= idx {
+			s.calls = append(s.calls, llm.ToolCall{})
+		}
+		if tcDelta.ID != "" {
+			s.calls[idx].ID = tcDelta.ID
+		}
+		s.calls[idx].Name += tcDelta.Function.Name
+		s.calls[idx].Arguments += tcDelta.Function.Arguments
+	}
+}
+
+// finishStream 在底层的流结束后返回累积的工具调用和结束事件。
+func (s *stream) finishStream() {
+	s.done = true
+	for i := range s.calls {
+		s.pending = append(s.pending, llm.Event{Type: llm.EventToolCall, ToolCall: &s.calls[i]})
+	}
+	if s.finish != nil {
+		s.pending = append(s.pending, *s.finish)
+	}
+}
+
+func convertUsage(u *openai.Usage) *llm.Usage {
+	return &llm.Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
@@ -0,0 +1,189 @@
+// internal/llm/openaicompat/openaicompat_test.go
+package openaicompat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/llm"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// sse 把每个 JSON 数据块拼接为一段以 [DONE] 结束的 SSE 响应。
+func sse(chunks ...string) string {
+	var sb strings.Builder
+	for _, chunk := range chunks {
+		fmt.Fprintf(&sb, "data: %s\n\n", chunk)
+	}
+	sb.WriteString("data: [DONE]\n\n")
+	return sb.String()
+}
+
+// newTestClient 返回一个连接到 httptest 服务器的客户端。服务器对每个请求返回 transcript，
+// 并把收到的请求体写入 got。
+func newTestClient(t *testing.T, transcript string, got *openai.ChatCompletionRequest) *openai.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if got != nil {
+			if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, transcript)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := openai.DefaultConfig("test-key")
+	cfg.BaseURL = server.URL
+	return openai.NewClientWithConfig(cfg)
+}
+
+// collect 读取流中的所有事件，返回事件和结束时的错误（正常结束时为 nil）。
+func collect(t *testing.T, client *openai.Client, req llm.Request) ([]llm.Event, error) {
+	t.Helper()
+	stream, err := CreateStream(context.Background(), client, req, "test-model")
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var events []llm.Event
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	req := llm.Request{
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: "Be brief."},
+			{Role: llm.RoleUser, Content: "ignored", Parts: []llm.ContentPart{
+				{Type: llm.PartText, Text: "What is this?"},
+				{Type: llm.PartImage, ImageURL: "data:image/png;base64,AAAA"},
+			}},
+			{Role: llm.RoleAssistant, Content: "Let me look.", ToolCalls: []llm.ToolCall{
+				{ID: "call_1", Name: "read_file", Arguments: `{"file_path": "a.go"}`},
+			}},
+			{Role: llm.RoleTool, ToolCallID: "call_1", Content: "package a"},
+		},
+		Tools:       []llm.Tool{{Name: "read_file", Description: "Read a file", Parameters: json.RawMessage(`{"type": "object"}`)}},
+		MaxTokens:   100,
+		Temperature: 0.2,
+		Stop:        []string{"END"},
+	}
+	got := NewRequest(req, "default-model")
+
+	want := []openai.ChatCompletionMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "What is this?"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,AAAA"}},
+		}},
+		{Role: "assistant", Content: "Let me look.", ToolCalls: []openai.ToolCall{
+			{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "read_file", Arguments: `{"file_path": "a.go"}`}},
+		}},
+		{Role: "tool", ToolCallID: "call_1", Content: "package a"},
+	}
+	if !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("messages = %+v, want %+v", got.Messages, want)
+	}
+	if got.Model != "default-model" || !got.Stream || got.MaxTokens != 100 || got.Temperature != 0.2 || !reflect.DeepEqual(got.Stop, []string{"END"}) {
+		t.Errorf("request = %+v", got)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Type != openai.ToolTypeFunction || got.Tools[0].Function.Name != "read_file" ||
+		string(got.Tools[0].Function.Parameters.(json.RawMessage)) != `{"type": "object"}` {
+		t.Errorf("tools = %+v", got.Tools)
+	}
+
+	// 请求中指定的模型优先于默认模型
+	if got := NewRequest(llm.Request{Model: "other"}, "default-model"); got.Model != "other" {
+		t.Errorf("model = %q, want other", got.Model)
+	}
+}
+
+func TestStreamText(t *testing.T) {
+	transcript := sse(
+		`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{"content":", world"}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		// usage 在 finish_reason 之后的单独数据块中到达
+		`{"id":"1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}`,
+	)
+	var got openai.ChatCompletionRequest
+	client := newTestClient(t, transcript, &got)
+	events, err := collect(t, client, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	want := []llm.Event{
+		{Type: llm.EventText, Text: "Hello"},
+		{Type: llm.EventText, Text: ", world"},
+		{Type: llm.EventFinish, FinishReason: llm.FinishStop, Usage: &llm.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if got.Model != "test-model" || !got.Stream || len(got.Messages) != 1 || got.Messages[0].Content != "Hi" {
+		t.Errorf("request = %+v", got)
+	}
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	transcript := sse(
+		`{"id":"1","choices":[{"index":0,"delta":{"content":"Reading both."}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"file_path\": \"ma"}}]}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"list_directory","arguments":"{}"}}]}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"in.go\"}"}}]}}]}`,
+		`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	)
+	client := newTestClient(t, transcript, nil)
+	events, err := collect(t, client, llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "Read main.go"}}})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	// 工具调用在流结束后按索引顺序完整返回，结束事件总是最后一个
+	want := []llm.Event{
+		{Type: llm.EventText, Text: "Reading both."},
+		{Type: llm.EventToolCall, ToolCall: &llm.ToolCall{ID: "call_1", Name: "read_file", Arguments: `{"file_path": "main.go"}`}},
+		{Type: llm.EventToolCall, ToolCall: &llm.ToolCall{ID: "call_2", Name: "list_directory", Arguments: "{}"}},
+		{Type: llm.EventFinish, FinishReason: llm.FinishToolCalls},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestStreamWithoutFinishReason(t *testing.T) {
+	client := newTestClient(t, sse(`{"id":"1","choices":[{"index":0,"delta":{"content":"partial"}}]}`), nil)
+	events, err := collect(t, client, llm.Request{})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if want := []llm.Event{{Type: llm.EventText, Text: "partial"}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
@@ -9,9 +9,15 @@ import (
 type LLMProvider interface {
 	// Name 返回提供商的名称 (e.g., "deepseek", "openai")
 	Name() string
-	// CreateChatCompletionStream 发起一个流式聊天请求
-	CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionStream, error)
+	// CreateStream 发起一个流式聊天请求，把 API 的响应转换为统一的事件
+	CreateStream(ctx context.Context, req Request) (Stream, error)
 	// GetTools 返回该 provider 推荐使用的工具定义
 	// 注意：工具定义是通用的，但某些模型可能对格式有特殊偏好
+	// Agent 实际公开给模型的工具来自它自己的 tool.Registry
 	GetTools() []Tool
 }
+
+// ModelLister 由可以列出可用模型的 provider 实现（例如本地运行的 Ollama）。
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
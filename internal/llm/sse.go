@@ -0,0 +1,65 @@
+// internal/llm/sse.go
+package llm
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// maxEventBytes 是单个 SSE 事件中一行的最大长度
+const maxEventBytes = 16 * 1024 * 1024
+
+// SSEEvent 是 Server-Sent Events 流中的一个事件。
+type SSEEvent struct {
+	Event string // event 字段，没有时为空
+	Data  string // 多个 data 行以 "\n" 连接
+}
+
+// SSEReader 逐个读取 Server-Sent Events，供使用原生 API 的 provider 解析流式响应。
+type SSEReader struct {
+	scanner *bufio.Scanner
+}
+
+// NewSSEReader 创建一个从 r 读取事件的 SSEReader。
+func NewSSEReader(r io.Reader) *SSEReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventBytes)
+	return &SSEReader{scanner: scanner}
+}
+
+// Next 返回下一个有数据的事件。流结束时返回 io.EOF。
+func (r *SSEReader) Next() (SSEEvent, error) {
+	var (
+		event string
+		data  []string
+	)
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				return SSEEvent{Event: event, Data: strings.Join(data, "\n")}, nil
+			}
+			event = ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // 注释，通常用作心跳
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return SSEEvent{}, err
+	}
+	if len(data) > 0 {
+		return SSEEvent{Event: event, Data: strings.Join(data, "\n")}, nil
+	}
+	return SSEEvent{}, io.EOF
+}
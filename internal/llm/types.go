@@ -1,12 +1,110 @@
 // internal/llm/types.go
 package llm
 
-import openai "github.com/sashabaranov/go-openai"
-
-// 这些是我们与 LLM API 交互时使用的核心数据结构
-// 使用别名可以方便未来切换底层库而无需大规模重构
-type Message = openai.ChatCompletionMessage
-type Tool = openai.Tool
-type ToolCall = openai.ToolCall
-type ChatCompletionRequest = openai.ChatCompletionRequest
-type ChatCompletionStream = openai.ChatCompletionStream
+import "encoding/json"
+
+// 这些是 Synapse 与 LLM 交互时使用的核心数据结构，与任何一家 API 的格式无关。
+// 每个 provider 负责在它们与自己的 API 格式之间转换。
+
+// 消息的角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message 是会话中的一条消息。
+type Message struct {
+	Role       string
+	Content    string        // 文本内容
+	Parts      []ContentPart // 多模态内容，非空时代替 Content
+	ToolCalls  []ToolCall    // 助手请求的工具调用
+	ToolCallID string        // 工具结果对应的调用 ID
+}
+
+// PartType 是内容片段的类型。
+type PartType string
+
+const (
+	PartText  PartType = "text"
+	PartImage PartType = "image"
+)
+
+// ContentPart 是多模态消息中的一个片段。
+type ContentPart struct {
+	Type     PartType
+	Text     string // PartText 的文本
+	ImageURL string // PartImage 的地址：http(s) URL 或 base64 编码的 data URL
+}
+
+// ToolCall 是模型请求的一次工具调用。
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // JSON 对象
+}
+
+// Tool 描述一个可以被模型调用的工具。
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // 参数的 JSON Schema
+}
+
+// Request 是一次流式聊天请求。
+type Request struct {
+	Model       string // 为空时使用 provider 配置的默认模型
+	Messages    []Message
+	Tools       []Tool
+	MaxTokens   int     // 回复的最大 token 数，0 表示使用 provider 的默认值
+	Temperature float32 // 0 表示使用模型的默认值
+	Stop        []string
+}
+
+// Usage 是一次请求消耗的 token 数。
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int // 包括推理使用的 token
+	TotalTokens      int
+}
+
+// FinishReason 说明模型为什么停止生成。
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"
+	FinishToolCalls     FinishReason = "tool_calls"
+	FinishLength        FinishReason = "length"
+	FinishContentFilter FinishReason = "content_filter"
+)
+
+// EventType 是流式事件的类型。
+type EventType int
+
+const (
+	// EventText 是回复文本的增量，在 Event.Text 中。
+	EventText EventType = iota
+	// EventReasoning 是模型推理（思考）内容的增量，在 Event.Text 中。
+	EventReasoning
+	// EventToolCall 是一个完整的工具调用，在 Event.ToolCall 中。
+	EventToolCall
+	// EventFinish 表示回复结束，FinishReason 和 Usage（可能为 nil）有值。
+	// 它是流中的最后一个事件，但并非所有 API 都会提供，流可能直接结束。
+	EventFinish
+)
+
+// Event 是流式回复中的一个事件。
+type Event struct {
+	Type         EventType
+	Text         string
+	ToolCall     *ToolCall
+	FinishReason FinishReason
+	Usage        *Usage
+}
+
+// Stream 是一个流式回复。Recv 按顺序返回事件，读完后返回 io.EOF。
+type Stream interface {
+	Recv() (Event, error)
+	Close() error
+}
@@ -0,0 +1,283 @@
+// internal/mcp/client.go
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ServerConfig 描述如何连接一个 MCP 服务器。
+// 设置了 Command 时通过子进程的 stdin/stdout 通信；否则连接 URL。
+type ServerConfig struct {
+	Command string
+	Args    []string
+	Env     []string // 追加到子进程环境变量中的 "KEY=value"
+	URL     string
+	// Transport 是 URL 使用的传输方式："http"（Streamable HTTP）或 "sse"（旧版 HTTP+SSE）。
+	// 为空时先尝试 Streamable HTTP，失败后回退到 SSE。
+	Transport string
+	Headers   map[string]string // 附加到每个 HTTP 请求的头，例如 Authorization
+}
+
+// transport 负责在客户端与服务器之间收发 JSON-RPC 消息。
+type transport interface {
+	// start 建立连接。收到的每条消息都交给 deliver；连接断开时调用 closed。
+	start(ctx context.Context, deliver func([]byte), closed func(error)) error
+	// send 发送一条消息。
+	send(ctx context.Context, data []byte) error
+	close() error
+}
+
+// Client 是一个已完成初始化握手的 MCP 客户端连接。
+type Client struct {
+	name      string
+	transport transport
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *message
+	err     error // 连接断开的原因；非 nil 时不再接受新请求
+
+	serverInfo   Implementation
+	instructions string
+}
+
+// Connect 连接名为 name 的 MCP 服务器并完成初始化握手。
+func Connect(ctx context.Context, name string, cfg ServerConfig) (*Client, error) {
+	switch {
+	case cfg.Command != "":
+		return connect(ctx, name, newStdioTransport(cfg))
+	case cfg.URL == "":
+		return nil, fmt.Errorf("MCP server '%s' has neither a command nor a url", name)
+	case cfg.Transport == "http":
+		return connect(ctx, name, newStreamableTransport(cfg))
+	case cfg.Transport == "sse":
+		return connect(ctx, name, newSSETransport(cfg))
+	case cfg.Transport != "":
+		return nil, fmt.Errorf("MCP server '%s' has unknown transport '%s': expected http or sse", name, cfg.Transport)
+	}
+
+	// 未指定传输方式时按规范的向后兼容建议：先尝试 Streamable HTTP，
+	// 服务器拒绝 POST 时回退到旧版 SSE
+	client, err := connect(ctx, name, newStreamableTransport(cfg))
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.code >= 400 && statusErr.code < 500 {
+		return connect(ctx, name, newSSETransport(cfg))
+	}
+	return client, err
+}
+
+func connect(ctx context.Context, name string, t transport) (*Client, error) {
+	c := &Client{name: name, transport: t, pending: make(map[string]chan *message)}
+	if err := t.start(ctx, c.deliver, c.closed); err != nil {
+		return nil, fmt.Errorf("could not connect to MCP server '%s': %w", name, err)
+	}
+	if err := c.initialize(ctx); err != nil {
+		t.close()
+		return nil, fmt.Errorf("MCP server '%s' failed to initialize: %w", name, err)
+	}
+	return c, nil
+}
+
+// initialize 执行 initialize 握手并发送 initialized 通知。
+func (c *Client) initialize(ctx context.Context) error {
+	var result initializeResult
+	err := c.call(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "synapse", Version: version},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(supportedVersions, result.ProtocolVersion) {
+		return fmt.Errorf("unsupported protocol version '%s'", result.ProtocolVersion)
+	}
+	if st, ok := c.transport.(*streamableTransport); ok {
+		st.setProtocolVersion(result.ProtocolVersion)
+	}
+	c.serverInfo = result.ServerInfo
+	c.instructions = result.Instructions
+	return c.notify(ctx, "notifications/initialized", nil)
+}
+
+// Name 返回配置中的服务器名称。
+func (c *Client) Name() string {
+	return c.name
+}
+
+// ServerInfo 返回服务器在握手时报告的名称和版本。
+func (c *Client) ServerInfo() Implementation {
+	return c.serverInfo
+}
+
+// ListTools 返回服务器公开的所有工具。
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var (
+		tools  []Tool
+		cursor string
+	)
+	for {
+		var result listToolsResult
+		if err := c.call(ctx, "tools/list", listToolsParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool 调用服务器上的工具。arguments 是 JSON 对象，可以为空。
+// 服务器返回的 JSON-RPC 错误以 *RPCError 返回；工具本身的失败体现在 CallToolResult.IsError 中。
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", callToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close 关闭与服务器的连接。
+func (c *Client) Close() error {
+	c.closed(errors.New("client closed"))
+	return c.transport.close()
+}
+
+// call 发送一个请求并等待响应，把结果解析到 result 中。
+// ctx 被取消时向服务器发送 notifications/cancelled。
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("MCP server '%s' is disconnected: %w", c.name, c.err)
+	}
+	c.nextID++
+	id := json.RawMessage(strconv.FormatInt(c.nextID, 10))
+	responses := make(chan *message, 1)
+	c.pending[string(id)] = responses
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(id))
+		c.mu.Unlock()
+	}()
+
+	data, err := encode(id, method, params)
+	if err != nil {
+		return err
+	}
+	if err := c.transport.send(ctx, data); err != nil {
+		return err
+	}
+
+	select {
+	case resp, ok := <-responses:
+		if !ok {
+			c.mu.Lock()
+			err := c.err
+			c.mu.Unlock()
+			return fmt.Errorf("MCP server '%s' disconnected: %w", c.name, err)
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		if method != "initialize" {
+			cancelCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			c.notify(cancelCtx, "notifications/cancelled", cancelledParams{RequestID: id, Reason: ctx.Err().Error()})
+			cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// notify 发送一个通知。
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	data, err := encode(nil, method, params)
+	if err != nil {
+		return err
+	}
+	return c.transport.send(ctx, data)
+}
+
+// deliver 处理从服务器收到的一条消息。
+func (c *Client) deliver(data []byte) {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	switch {
+	case msg.isResponse():
+		// 在持有锁时发送，避免与 closed 关闭通道竞争
+		c.mu.Lock()
+		if responses, ok := c.pending[string(msg.ID)]; ok {
+			select {
+			case responses <- &msg:
+			default:
+			}
+		}
+		c.mu.Unlock()
+	case msg.isRequest():
+		// 客户端没有声明任何能力，只需响应 ping
+		resp := &message{JSONRPC: "2.0", ID: msg.ID}
+		if msg.Method == "ping" {
+			resp.Result = json.RawMessage("{}")
+		} else {
+			resp.Error = &RPCError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' is not supported", msg.Method)}
+		}
+		if out, err := json.Marshal(resp); err == nil {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				c.transport.send(ctx, out)
+			}()
+		}
+	}
+	// 通知（例如日志和进度）目前被忽略
+}
+
+// closed 在连接断开时被调用，使所有等待中的请求失败。
+func (c *Client) closed(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if err == nil {
+		err = errors.New("connection closed")
+	}
+	c.err = err
+	for id, responses := range c.pending {
+		close(responses)
+		delete(c.pending, id)
+	}
+}
+
+func encode(id json.RawMessage, method string, params any) ([]byte, error) {
+	msg := message{JSONRPC: "2.0", ID: id, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		msg.Params = data
+	}
+	return json.Marshal(msg)
+}
@@ -0,0 +1,342 @@
+// internal/mcp/http.go
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	sessionIDHeader       = "Mcp-Session-Id"
+	protocolVersionHeader = "MCP-Protocol-Version"
+	// maxErrorBodyBytes 是错误响应中读取的最大字节数
+	maxErrorBodyBytes = 4 * 1024
+)
+
+// httpStatusError 表示服务器返回了非 2xx 的 HTTP 状态码。
+type httpStatusError struct {
+	code int
+	body string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("HTTP %d", e.code)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.code, e.body)
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	return &httpStatusError{code: resp.StatusCode, body: strings.TrimSpace(string(body))}
+}
+
+// --- Streamable HTTP ---
+
+// streamableTransport 实现 Streamable HTTP 传输：每条消息通过 POST 发送，
+// 服务器以 JSON 或 SSE 流返回响应。会话由 Mcp-Session-Id 头维持。
+type streamableTransport struct {
+	cfg    ServerConfig
+	client *http.Client
+
+	deliver func([]byte)
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+	// ctx 在关闭传输时被取消，以结束仍在读取的 SSE 响应
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newStreamableTransport(cfg ServerConfig) *streamableTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &streamableTransport{cfg: cfg, client: http.DefaultClient, ctx: ctx, cancel: cancel}
+}
+
+func (t *streamableTransport) start(_ context.Context, deliver func([]byte), _ func(error)) error {
+	// Streamable HTTP 没有长连接，连接状态体现在每个请求的结果中
+	t.deliver = deliver
+	return nil
+}
+
+func (t *streamableTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocolVersion = version
+}
+
+func (t *streamableTransport) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(sessionIDHeader, t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set(protocolVersionHeader, t.protocolVersion)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+func (t *streamableTransport) send(ctx context.Context, data []byte) error {
+	// SSE 响应可能在 send 返回之后继续被读取，因此请求的生命周期跟随传输本身，
+	// 只有在等待响应头期间才受 ctx 控制
+	reqCtx, cancel := context.WithCancel(t.ctx)
+	stop := context.AfterFunc(ctx, cancel)
+
+	req, err := t.newRequest(reqCtx, http.MethodPost, data)
+	if err != nil {
+		cancel()
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.client.Do(req)
+	stop()
+	if err != nil {
+		cancel()
+		return err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		cancel()
+		return err
+	}
+	if id := resp.Header.Get(sessionIDHeader); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case resp.StatusCode == http.StatusAccepted || resp.ContentLength == 0:
+		resp.Body.Close()
+		cancel()
+	case mediaType == "text/event-stream":
+		go func() {
+			defer cancel()
+			defer resp.Body.Close()
+			readEvents(resp.Body, func(event, data string) bool {
+				if event == "" || event == "message" {
+					t.deliver([]byte(data))
+				}
+				return true
+			})
+		}()
+	default:
+		defer cancel()
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageBytes))
+		if err != nil {
+			return err
+		}
+		deliverJSON(body, t.deliver)
+	}
+	return nil
+}
+
+// close 结束会话并取消仍在读取的响应流。
+func (t *streamableTransport) close() error {
+	defer t.cancel()
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+	req, err := t.newRequest(t.ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// --- HTTP+SSE (2024-11-05) ---
+
+// sseTransport 实现旧版 HTTP+SSE 传输：客户端通过 GET 打开一个 SSE 流接收所有消息，
+// 服务器在流中的第一个 endpoint 事件告知发送消息的 POST 地址。
+type sseTransport struct {
+	cfg    ServerConfig
+	client *http.Client
+
+	endpoint string
+	cancel   context.CancelFunc
+}
+
+func newSSETransport(cfg ServerConfig) *sseTransport {
+	return &sseTransport{cfg: cfg, client: http.DefaultClient}
+}
+
+func (t *sseTransport) start(ctx context.Context, deliver func([]byte), closed func(error)) error {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, t.cfg.URL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return err
+	}
+
+	endpoint := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		err := readEvents(resp.Body, func(event, data string) bool {
+			switch event {
+			case "endpoint":
+				select {
+				case endpoint <- data:
+				default:
+				}
+			case "", "message":
+				deliver([]byte(data))
+			}
+			return true
+		})
+		if err == nil {
+			err = errors.New("event stream closed by server")
+		}
+		closed(err)
+		close(endpoint)
+	}()
+
+	select {
+	case e, ok := <-endpoint:
+		if !ok {
+			return errors.New("event stream closed before the endpoint event")
+		}
+		base, err := url.Parse(t.cfg.URL)
+		if err != nil {
+			return err
+		}
+		ref, err := url.Parse(strings.TrimSpace(e))
+		if err != nil {
+			return fmt.Errorf("invalid endpoint '%s': %w", e, err)
+		}
+		t.endpoint = base.ResolveReference(ref).String()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp)
+}
+
+func (t *sseTransport) close() error {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	return nil
+}
+
+// --- Helper functions ---
+
+// deliverJSON 把一个 JSON 消息或 JSON 消息数组（批量）逐条交给 deliver。
+func deliverJSON(body []byte, deliver func([]byte)) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err == nil {
+			for _, msg := range batch {
+				deliver(msg)
+			}
+		}
+		return
+	}
+	if len(body) > 0 {
+		deliver(body)
+	}
+}
+
+// readEvents 读取一个 Server-Sent Events 流，对每个事件调用 handle。
+// handle 返回 false 时停止读取。流正常结束时返回 nil。
+func readEvents(r io.Reader, handle func(event, data string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageBytes)
+	var (
+		event string
+		data  []string
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 && !handle(event, strings.Join(data, "\n")) {
+				return nil
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // 注释，通常用作心跳
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		handle(event, strings.Join(data, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+// internal/mcp/server.go
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/synapse/internal/tool"
+)
+
+// Server 通过 MCP 公开一个工具注册表中已启用的工具。
+// 工具调用与在 Synapse 中一样受工作区沙箱、参数校验和超时的约束；
+// 是否允许执行会修改工作区的工具由连接的 MCP 客户端负责确认。
+type Server struct {
+	tools  *tool.Registry
+	logger *log.Logger
+	token  string // Streamable HTTP 请求必须携带的 bearer token，为空表示不检查
+
+	mu       sync.Mutex
+	sessions map[string]bool // Streamable HTTP 中已初始化的会话
+}
+
+// NewServer 创建一个公开 tools 中工具的 MCP 服务器。
+func NewServer(tools *tool.Registry, logger *log.Logger) *Server {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Server{tools: tools, logger: logger, sessions: make(map[string]bool)}
+}
+
+// SetBearerToken 要求 Streamable HTTP 请求携带 "Authorization: Bearer <token>"。
+// 公开的工具可以修改工作区和执行命令，通过 HTTP 提供服务时应当总是设置 token。
+func (s *Server) SetBearerToken(token string) {
+	s.token = token
+}
+
+// ServeStdio 从 in 中按行读取 JSON-RPC 消息，把响应写到 out，直到 in 结束或 ctx 被取消。
+// 请求被并发处理，客户端可以通过 notifications/cancelled 取消仍在执行的请求。
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sessionID := newSessionID()
+
+	var (
+		writeMu  sync.Mutex
+		wg       sync.WaitGroup
+		inflight sync.Map // 请求 ID -> context.CancelFunc
+	)
+	write := func(resp *message) {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		out.Write(append(data, '\n'))
+	}
+	defer wg.Wait()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageBytes)
+		for scanner.Scan() {
+			select {
+			case lines <- bytes.Clone(scanner.Bytes()):
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		select {
+		case line = <-lines:
+		case err := <-readErr:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			write(errorResponse(json.RawMessage("null"), codeParseError, "invalid JSON: "+err.Error()))
+			continue
+		}
+		switch {
+		case msg.isRequest():
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			inflight.Store(string(msg.ID), reqCancel)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer reqCancel()
+				defer inflight.Delete(string(msg.ID))
+				write(s.handle(reqCtx, sessionID, &msg))
+			}()
+		case msg.isNotification() && msg.Method == "notifications/cancelled":
+			var params cancelledParams
+			if json.Unmarshal(msg.Params, &params) == nil {
+				if cancelRequest, ok := inflight.Load(string(params.RequestID)); ok {
+					cancelRequest.(context.CancelFunc)()
+				}
+			}
+		}
+		// 其他通知（例如 notifications/initialized）和客户端的响应不需要处理
+	}
+}
+
+// ServeHTTP 实现 Streamable HTTP 传输。每个 POST 携带一条或一批 JSON-RPC 消息，
+// 响应以 JSON 返回。服务器不主动推送消息，因此不支持用 GET 打开 SSE 流。
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 防止 DNS 重绑定：只接受来自本机页面（或没有 Origin 的非浏览器客户端）的请求
+	if !localOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+	sessionID := r.Header.Get(sessionIDHeader)
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, sessionID)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	var msgs []*message
+	if batch {
+		err = json.Unmarshal(body, &msgs)
+	} else {
+		var msg message
+		err = json.Unmarshal(body, &msg)
+		msgs = []*message{&msg}
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(json.RawMessage("null"), codeParseError, "invalid JSON: "+err.Error()))
+		return
+	}
+
+	initializing := slices.ContainsFunc(msgs, func(m *message) bool { return m.Method == "initialize" })
+	if initializing {
+		sessionID = newSessionID()
+		s.mu.Lock()
+		s.sessions[sessionID] = true
+		s.mu.Unlock()
+		w.Header().Set(sessionIDHeader, sessionID)
+	} else {
+		s.mu.Lock()
+		known := s.sessions[sessionID]
+		s.mu.Unlock()
+		switch {
+		case sessionID == "":
+			http.Error(w, "missing "+sessionIDHeader+" header", http.StatusBadRequest)
+			return
+		case !known:
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	var responses []*message
+	for _, msg := range msgs {
+		if msg.isRequest() {
+			// 客户端断开连接时 r.Context() 被取消，正在执行的工具随之停止
+			responses = append(responses, s.handle(r.Context(), sessionID, msg))
+		}
+	}
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeJSON(w, http.StatusOK, responses)
+	default:
+		writeJSON(w, http.StatusOK, responses[0])
+	}
+}
+
+// handle 处理一个请求并返回响应。
+func (s *Server) handle(ctx context.Context, sessionID string, req *message) *message {
+	var (
+		result any
+		err    error
+	)
+	switch req.Method {
+	case "initialize":
+		result, err = s.initialize(req.Params)
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result = listToolsResult{Tools: s.listTools()}
+	case "tools/call":
+		result, err = s.callTool(ctx, sessionID, req.Params)
+	default:
+		err = &RPCError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' is not supported", req.Method)}
+	}
+
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: codeInternalError, Message: err.Error()}
+		}
+		return &message{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, codeInternalError, err.Error())
+	}
+	return &message{JSONRPC: "2.0", ID: req.ID, Result: data}
+}
+
+func (s *Server) initialize(raw json.RawMessage) (*initializeResult, error) {
+	var params initializeParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &RPCError{Code: codeInvalidParams, Message: "invalid initialize params: " + err.Error()}
+	}
+	// 客户端请求的版本受支持时使用它，否则提出我们最新的版本，由客户端决定是否继续
+	negotiated := ProtocolVersion
+	if slices.Contains(supportedVersions, params.ProtocolVersion) {
+		negotiated = params.ProtocolVersion
+	}
+	s.logger.Printf("MCP client connected: %s %s (protocol %s)", params.ClientInfo.Name, params.ClientInfo.Version, negotiated)
+
+	instructions := "Synapse tools for reading, searching and editing files."
+	if ws, err := s.tools.Workspace(); err == nil {
+		instructions = fmt.Sprintf("Synapse tools for reading, searching and editing files in the workspace %s. Relative paths are resolved against the workspace root and paths outside it are rejected.", ws.Root())
+	}
+	return &initializeResult{
+		ProtocolVersion: negotiated,
+		Capabilities:    map[string]any{"tools": map[string]any{"listChanged": false}},
+		ServerInfo:      Implementation{Name: "synapse", Version: version},
+		Instructions:    instructions,
+	}, nil
+}
+
+// listTools 把注册表中已启用的工具转换为 MCP 工具描述。
+func (s *Server) listTools() []Tool {
+	defs := s.tools.Definitions()
+	tools := make([]Tool, 0, len(defs))
+	for _, def := range defs {
+		schema := def.Parameters
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = json.RawMessage(`{"type": "object", "properties": {}}`)
+		}
+		access := s.tools.Access(def.Name)
+		readOnly := access == tool.AccessReadOnly
+		destructive := access == tool.AccessDestructive
+		tools = append(tools, Tool{
+			Name:        def.Name,
+			Description: def.Description,
+			InputSchema: schema,
+			Annotations: &ToolAnnotations{ReadOnlyHint: &readOnly, DestructiveHint: &destructive},
+		})
+	}
+	return tools
+}
+
+// callTool 执行一个工具。工具执行失败（包括参数不合法）以 isError 结果返回，
+// 使客户端的模型可以看到错误并重试；只有未知的工具是协议错误。
+func (s *Server) callTool(ctx context.Context, sessionID string, raw json.RawMessage) (*CallToolResult, error) {
+	var params callToolParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &RPCError{Code: codeInvalidParams, Message: "invalid tools/call params: " + err.Error()}
+	}
+	if _, found := s.tools.GetExecutor(params.Name); !found {
+		return nil, &RPCError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool '%s'", params.Name)}
+	}
+
+	env := tool.Env{SessionID: sessionID, Logger: s.logger}
+	arguments := string(params.Arguments)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	result, err := s.tools.Execute(ctx, env, params.Name, arguments)
+	if err != nil {
+		return &CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	text := result.Text
+	if result.Diff != "" {
+		text += "\n\n" + result.Diff
+	}
+	return &CallToolResult{Content: []Content{{Type: "text", Text: text}}}, nil
+}
+
+// --- Helper functions ---
+
+func errorResponse(id json.RawMessage, code int, msg string) *message {
+	return &message{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: msg}}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorized 判断请求是否携带了正确的 bearer token。
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// localOrigin 判断请求的 Origin 是否为空或指向本机。
+func localOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,129 @@
+// internal/mcp/server_test.go
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const initializeBody = `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-03-26", "clientInfo": {"name": "test", "version": "1"}}}`
+
+// post 向测试服务器发送一条 JSON-RPC 消息，headers 中的值为空时不设置该请求头。
+func post(t *testing.T, url, body string, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServeHTTPAuthorization(t *testing.T) {
+	ts := newTestServer(t, "secret")
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"token prefix", "Bearer secre", http.StatusUnauthorized},
+		{"not a bearer token", "secret", http.StatusUnauthorized},
+		{"basic auth", "Basic c2VjcmV0", http.StatusUnauthorized},
+		{"correct token", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, ts.URL, initializeBody, map[string]string{"Authorization": tt.authorization})
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", resp.Header.Get("WWW-Authenticate"))
+			}
+			if tt.want == http.StatusOK && resp.Header.Get(sessionIDHeader) == "" {
+				t.Errorf("initialize response has no %s header", sessionIDHeader)
+			}
+		})
+	}
+
+	// 每个请求都要检查 token，不只是 initialize
+	init := post(t, ts.URL, initializeBody, map[string]string{"Authorization": "Bearer secret"})
+	session := init.Header.Get(sessionIDHeader)
+	list := `{"jsonrpc": "2.0", "id": 2, "method": "tools/list"}`
+	if resp := post(t, ts.URL, list, map[string]string{sessionIDHeader: session}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tools/list without a token: status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	resp := post(t, ts.URL, list, map[string]string{sessionIDHeader: session, "Authorization": "Bearer secret"})
+	var msg message
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil || msg.Error != nil {
+		t.Errorf("tools/list with the token = %+v, %v", msg, err)
+	}
+}
+
+func TestServeHTTPOrigin(t *testing.T) {
+	ts := newTestServer(t, "secret")
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusOK},
+		{"http://localhost:3000", http.StatusOK},
+		{"http://127.0.0.1:8765", http.StatusOK},
+		{"http://[::1]:8765", http.StatusOK},
+		{"https://evil.example", http.StatusForbidden},
+		{"http://localhost.evil.example", http.StatusForbidden},
+		{"http://192.168.1.10", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			// 即使 token 正确，非本机页面发起的请求也会被拒绝
+			resp := post(t, ts.URL, initializeBody, map[string]string{"Authorization": "Bearer secret", "Origin": tt.origin})
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeHTTPSessions(t *testing.T) {
+	ts := newTestServer(t, "")
+	list := `{"jsonrpc": "2.0", "id": 2, "method": "tools/list"}`
+	if resp := post(t, ts.URL, list, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("request without a session: status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if resp := post(t, ts.URL, list, map[string]string{sessionIDHeader: "unknown"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("request with an unknown session: status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	c := connectTestServer(t, ts.URL, "")
+	tools, err := c.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	if len(tools) != 3 {
+		t.Errorf("ListTools returned %d tools, want 3", len(tools))
+	}
+	result, err := c.CallTool(context.Background(), "reader", json.RawMessage(`{"a": 1}`))
+	if err != nil || result.IsError || result.Content[0].Text != `reader {"a":1}` {
+		t.Errorf("CallTool = %+v, %v", result, err)
+	}
+	if _, err := c.CallTool(context.Background(), "missing", nil); err == nil || !strings.Contains(err.Error(), "unknown tool 'missing'") {
+		t.Errorf("CallTool of an unknown tool error = %v", err)
+	}
+}
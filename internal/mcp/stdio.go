@@ -0,0 +1,144 @@
+// internal/mcp/stdio.go
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMessageBytes 是单条消息的最大长度
+	maxMessageBytes = 16 * 1024 * 1024
+	// stderrTailBytes 是为诊断保留的服务器 stderr 末尾的字节数
+	stderrTailBytes = 4 * 1024
+	// stdioShutdownDelay 是关闭 stdin 后等待服务器自行退出的时间
+	stdioShutdownDelay = 2 * time.Second
+)
+
+// stdioTransport 把服务器作为子进程启动，通过按行分隔的 JSON 与它通信。
+type stdioTransport struct {
+	cfg ServerConfig
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+	exited chan struct{}
+
+	writeMu sync.Mutex
+}
+
+func newStdioTransport(cfg ServerConfig) *stdioTransport {
+	return &stdioTransport{cfg: cfg, stderr: &tailBuffer{limit: stderrTailBytes}, exited: make(chan struct{})}
+}
+
+func (t *stdioTransport) start(_ context.Context, deliver func([]byte), closed func(error)) error {
+	// 服务器的生命周期与客户端相同，而不是与建立连接时的 ctx 相同
+	t.cmd = exec.Command(t.cfg.Command, t.cfg.Args...)
+	t.cmd.Env = append(os.Environ(), t.cfg.Env...)
+	t.cmd.Stderr = t.stderr
+
+	stdin, err := t.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	t.stdin = stdin
+	if err := t.cmd.Start(); err != nil {
+		return fmt.Errorf("error starting '%s': %w", t.cfg.Command, err)
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageBytes)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) > 0 {
+				deliver(bytes.Clone(line))
+			}
+		}
+		waitErr := t.cmd.Wait()
+		close(t.exited)
+
+		err := scanner.Err()
+		if err == nil {
+			err = waitErr
+		}
+		if err == nil {
+			err = errors.New("server exited")
+		}
+		if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+			err = fmt.Errorf("%w; stderr: %s", err, tail)
+		}
+		closed(err)
+	}()
+	return nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		// 写入失败通常是因为服务器已经退出，此时它的 stderr 更能说明原因
+		select {
+		case <-t.exited:
+		case <-time.After(stdioShutdownDelay):
+		}
+		if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+			return fmt.Errorf("%w; stderr: %s", err, tail)
+		}
+		return err
+	}
+	return nil
+}
+
+// close 关闭服务器的 stdin，让它自行退出；超时后强制结束进程。
+func (t *stdioTransport) close() error {
+	if t.cmd == nil || t.cmd.Process == nil {
+		return nil
+	}
+	t.stdin.Close()
+	select {
+	case <-t.exited:
+		return nil
+	case <-time.After(stdioShutdownDelay):
+		return t.cmd.Process.Kill()
+	}
+}
+
+// tailBuffer 是只保留最后 limit 个字节的 io.Writer。
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
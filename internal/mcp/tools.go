@@ -0,0 +1,137 @@
+// internal/mcp/tools.go
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+// toolNameSeparator 分隔注册名中的服务器前缀和工具名，例如 "github__create_issue"。
+const toolNameSeparator = "__"
+
+// maxToolNameLength 是 OpenAI 等 provider 允许的函数名最大长度
+const maxToolNameLength = 64
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ToolName 返回服务器 server 上的工具 name 在注册表中的名称。
+func ToolName(server, name string) string {
+	full := invalidNameChars.ReplaceAllString(server+toolNameSeparator+name, "_")
+	if len(full) > maxToolNameLength {
+		full = full[:maxToolNameLength]
+	}
+	return full
+}
+
+// RegisterTools 列出客户端 c 所连接服务器的工具，并以服务器名称为前缀注册到 r。
+// 对这些工具的调用会被转发给服务器。返回注册的工具名称；单个工具注册失败不影响其他工具。
+// 工具注解来自服务器，任何服务器都可以声称自己的工具是只读的：只有 trustAnnotations 为 true 时
+// readOnlyHint 才会让工具免于确认，否则每个工具至少被视为会修改工作区。
+func RegisterTools(ctx context.Context, r *tool.Registry, c *Client, trustAnnotations bool) ([]string, error) {
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list tools of MCP server '%s': %w", c.Name(), err)
+	}
+
+	var (
+		names []string
+		errs  []string
+	)
+	for _, t := range tools {
+		name := ToolName(c.Name(), t.Name)
+		params := t.InputSchema
+		if len(params) == 0 {
+			params = json.RawMessage(`{"type": "object", "properties": {}}`)
+		}
+		description := t.Description
+		if description == "" {
+			description = t.Title
+		}
+		def := llm.Tool{
+			Name:        name,
+			Description: fmt.Sprintf("[MCP server '%s'] %s", c.Name(), description),
+			Parameters:  params,
+		}
+		access := toolAccess(t.Annotations)
+		if !trustAnnotations {
+			access = max(access, tool.AccessMutating)
+		}
+		if err := r.Register(def, proxyTool(c, t.Name), access); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(errs) > 0 {
+		return names, fmt.Errorf("some tools of MCP server '%s' were not registered: %s", c.Name(), strings.Join(errs, "; "))
+	}
+	return names, nil
+}
+
+// toolAccess 根据服务器的提示决定工具的访问级别。没有提示的工具被视为会修改工作区。
+func toolAccess(a *ToolAnnotations) tool.Access {
+	switch {
+	case a == nil:
+		return tool.AccessMutating
+	case a.ReadOnlyHint != nil && *a.ReadOnlyHint:
+		return tool.AccessReadOnly
+	case a.DestructiveHint != nil && *a.DestructiveHint:
+		return tool.AccessDestructive
+	default:
+		return tool.AccessMutating
+	}
+}
+
+// proxyTool 返回一个把调用转发给服务器上名为 name 的工具的 ToolFunc。
+// 服务器返回的错误（包括 isError 的结果）作为工具错误返回。
+func proxyTool(c *Client, name string) tool.ToolFunc {
+	return func(ctx context.Context, _ tool.Env, arguments string) (tool.Result, error) {
+		result, err := c.CallTool(ctx, name, json.RawMessage(arguments))
+		if err != nil {
+			return tool.Result{}, fmt.Errorf("MCP server '%s' failed to run '%s': %w", c.Name(), name, err)
+		}
+		text := contentText(result)
+		if result.IsError {
+			return tool.Result{}, fmt.Errorf("MCP server '%s' reported an error from '%s': %s", c.Name(), name, text)
+		}
+		return tool.Result{
+			Text:    text,
+			Summary: fmt.Sprintf("ran '%s' on MCP server '%s'", name, c.Name()),
+			Meta:    map[string]any{"mcp_server": c.Name()},
+		}, nil
+	}
+}
+
+// contentText 把工具结果转换为发送给模型的文本。非文本内容以占位说明代替。
+func contentText(result *CallToolResult) string {
+	var parts []string
+	for _, c := range result.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			if c.Resource.Text != "" {
+				parts = append(parts, fmt.Sprintf("[resource %s]\n%s", c.Resource.URI, c.Resource.Text))
+			} else {
+				parts = append(parts, fmt.Sprintf("[binary resource %s (%s)]", c.Resource.URI, c.Resource.MimeType))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource link %s]", c.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content (%s) omitted]", c.Type, c.MimeType))
+		}
+	}
+	if len(parts) == 0 && len(result.StructuredContent) > 0 {
+		return string(result.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
+}
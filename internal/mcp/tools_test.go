@@ -0,0 +1,136 @@
+// internal/mcp/tools_test.go
+package mcp
+
+import (
+	"context"
+	"log"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/synapse/internal/llm"
+	"github.com/synapse/internal/tool"
+)
+
+// newTestServer 通过 Streamable HTTP 提供一个包含只读、修改和破坏性工具各一个的注册表。
+// token 非空时服务器要求 bearer token。
+func newTestServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	r := tool.NewRegistry()
+	for name, access := range map[string]tool.Access{
+		"reader":  tool.AccessReadOnly,
+		"writer":  tool.AccessMutating,
+		"deleter": tool.AccessDestructive,
+	} {
+		echo := func(_ context.Context, _ tool.Env, arguments string) (tool.Result, error) {
+			return tool.TextResult(name + " " + arguments), nil
+		}
+		r.MustRegister(llm.Tool{Name: name, Description: "test tool " + name}, echo, access)
+	}
+	server := NewServer(r, log.New(testWriter{t}, "", 0))
+	server.SetBearerToken(token)
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// testWriter 把服务器日志写入测试输出。
+type testWriter struct{ t *testing.T }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
+
+func connectTestServer(t *testing.T, url, token string) *Client {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := Connect(ctx, "test", ServerConfig{URL: url, Transport: "http", Headers: map[string]string{"Authorization": "Bearer " + token}})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRegisterToolsAccess(t *testing.T) {
+	ts := newTestServer(t, "secret")
+	c := connectTestServer(t, ts.URL, "secret")
+
+	tests := []struct {
+		trust bool
+		want  map[string]tool.Access
+	}{
+		// 默认不信任服务器声称的只读工具
+		{trust: false, want: map[string]tool.Access{
+			"test__reader":  tool.AccessMutating,
+			"test__writer":  tool.AccessMutating,
+			"test__deleter": tool.AccessDestructive,
+		}},
+		{trust: true, want: map[string]tool.Access{
+			"test__reader":  tool.AccessReadOnly,
+			"test__writer":  tool.AccessMutating,
+			"test__deleter": tool.AccessDestructive,
+		}},
+	}
+	for _, tt := range tests {
+		r := tool.NewRegistry()
+		names, err := RegisterTools(context.Background(), r, c, tt.trust)
+		if err != nil {
+			t.Fatalf("RegisterTools: %v", err)
+		}
+		if len(names) != len(tt.want) {
+			t.Errorf("registered %q, want %d tools", names, len(tt.want))
+		}
+		for name, want := range tt.want {
+			if got := r.Access(name); got != want {
+				t.Errorf("trust_annotations=%v: Access(%s) = %v, want %v", tt.trust, name, got, want)
+			}
+		}
+	}
+}
+
+func TestToolAccess(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		annotations *ToolAnnotations
+		want        tool.Access
+	}{
+		{nil, tool.AccessMutating},
+		{&ToolAnnotations{}, tool.AccessMutating},
+		{&ToolAnnotations{ReadOnlyHint: &yes}, tool.AccessReadOnly},
+		{&ToolAnnotations{ReadOnlyHint: &no, DestructiveHint: &yes}, tool.AccessDestructive},
+		{&ToolAnnotations{ReadOnlyHint: &no, DestructiveHint: &no}, tool.AccessMutating},
+	}
+	for _, tt := range tests {
+		if got := toolAccess(tt.annotations); got != tt.want {
+			t.Errorf("toolAccess(%+v) = %v, want %v", tt.annotations, got, tt.want)
+		}
+	}
+}
+
+func TestProxyTool(t *testing.T) {
+	ts := newTestServer(t, "")
+	c := connectTestServer(t, ts.URL, "")
+	r := tool.NewRegistry()
+	r.SetWorkspace(mustWorkspace(t))
+	if _, err := RegisterTools(context.Background(), r, c, false); err != nil {
+		t.Fatal(err)
+	}
+	result, err := r.Execute(context.Background(), tool.Env{}, "test__writer", `{"x": 1}`)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Text != `writer {"x":1}` || result.Meta["mcp_server"] != "test" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func mustWorkspace(t *testing.T) *tool.Workspace {
+	t.Helper()
+	ws, err := tool.NewWorkspace(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
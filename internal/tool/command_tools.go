@@ -0,0 +1,367 @@
+// internal/tool/command_tools.go
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCommandTimeout     = 120 * time.Second
+	defaultCommandOutputBytes = 32 * 1024
+	// commandWaitDelay 是进程组被杀死后等待输出管道关闭的时间
+	commandWaitDelay = 2 * time.Second
+)
+
+// CommandPolicy 控制 run_command 工具可以执行哪些命令以及如何执行。
+// Allow 和 Deny 中的每一项都是一个命令前缀，例如 "go test" 或 "git push"。
+// Deny 优先；Allow 非空时，命令必须匹配其中一项，并且在规则之外不能带有
+// 会执行其他程序或写入任意文件的参数（见 unsafeCommandArg）。
+type CommandPolicy struct {
+	Allow          []string
+	Deny           []string
+	Timeout        time.Duration // 单条命令的默认超时，也是模型可以请求的最长超时
+	MaxOutputBytes int           // stdout 和 stderr 各自保留的最大字节数
+	// HiddenEnv 是不传给命令和插件进程的环境变量，例如 provider 的 API key。
+	HiddenEnv []string
+}
+
+func defaultCommandPolicy() CommandPolicy {
+	return CommandPolicy{Timeout: defaultCommandTimeout, MaxOutputBytes: defaultCommandOutputBytes}
+}
+
+// SetCommandPolicy 设置注册表中 run_command 使用的策略。未设置的超时和输出上限使用默认值。
+func (r *Registry) SetCommandPolicy(policy CommandPolicy) {
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultCommandTimeout
+	}
+	if policy.MaxOutputBytes <= 0 {
+		policy.MaxOutputBytes = defaultCommandOutputBytes
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = policy
+}
+
+// registerCommandTools 向注册表 r 注册执行外部命令的工具
+func registerCommandTools(r *Registry) {
+	MustRegisterTyped(r, TypedTool[runCommandArgs]{
+		Name:        "run_command",
+		Description: "Run a single command (e.g. 'go build ./...' or 'go test ./internal/...') in the workspace and return its exit code, stdout and stderr. The command is executed directly, not through a shell, so pipes, redirects, '&&' and globbing are not available",
+		Access:      AccessMutating,
+		Run:         toolRunCommand,
+		Preview:     previewRunCommand,
+	})
+	// run_command 通过 commands.timeout_seconds 和 timeout_seconds 参数自己管理超时
+	if err := r.SetTimeout("run_command", NoTimeout); err != nil {
+		panic(err)
+	}
+}
+
+// --- Tool Implementations ---
+
+type runCommandArgs struct {
+	Command        string `json:"command" desc:"The command line to run. Quote arguments containing spaces" required:"true"`
+	Workdir        string `json:"workdir" desc:"The directory to run in, relative to the workspace root. Defaults to the workspace root"`
+	TimeoutSeconds int    `json:"timeout_seconds" desc:"Maximum run time in seconds before the command is killed. Defaults to, and cannot exceed, the configured timeout"`
+}
+
+func toolRunCommand(ctx context.Context, env Env, args runCommandArgs) (Result, error) {
+	policy := env.commands
+	argv, dir, err := prepareCommand(env, args)
+	if err != nil {
+		return Result{}, err
+	}
+
+	timeout := policy.Timeout
+	if args.TimeoutSeconds > 0 {
+		// 模型只能缩短配置的超时，不能延长它
+		timeout = min(time.Duration(args.TimeoutSeconds)*time.Second, policy.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = commandEnv(policy.HiddenEnv)
+	// 在独立的进程组中运行，超时时杀死整个进程组，避免遗留子进程
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = commandWaitDelay
+
+	stdout := newCappedBuffer(policy.MaxOutputBytes)
+	stderr := newCappedBuffer(policy.MaxOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	runErr := cmd.Run()
+	duration := time.Since(start).Round(time.Millisecond)
+
+	exitCode := 0
+	status := ""
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		exitCode = -1
+		status = fmt.Sprintf("Command timed out after %s and was killed.\n", timeout)
+	case errors.Is(ctx.Err(), context.Canceled):
+		exitCode = -1
+		status = "Command was interrupted by the user and killed.\n"
+	case errors.As(runErr, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case runErr != nil:
+		return Result{}, fmt.Errorf("error running command '%s': %w", args.Command, runErr)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Command: %s\nWorking directory: %s\nExit code: %d\nDuration: %s\n", args.Command, env.Workspace.Rel(dir), exitCode, duration)
+	sb.WriteString(status)
+	fmt.Fprintf(&sb, "--- stdout ---\n%s", stdout.String())
+	fmt.Fprintf(&sb, "\n--- stderr ---\n%s", stderr.String())
+	return Result{
+		Text:    sb.String(),
+		Summary: fmt.Sprintf("`%s` exited with code %d in %s", args.Command, exitCode, duration),
+		Meta: map[string]any{
+			"exit_code":    exitCode,
+			"duration_ms":  duration.Milliseconds(),
+			"stdout_bytes": stdout.total,
+			"stderr_bytes": stderr.total,
+		},
+	}, nil
+}
+
+func previewRunCommand(env Env, args runCommandArgs) (string, error) {
+	_, dir, err := prepareCommand(env, args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Run command in '%s':\n$ %s", dir, args.Command), nil
+}
+
+// --- Helper functions ---
+
+// commandEnv 返回去掉 hidden 中的变量后的当前进程环境。
+// 变量名不区分大小写，以便在 Windows 上也能生效。
+func commandEnv(hidden []string) []string {
+	env := os.Environ()
+	if len(hidden) == 0 {
+		return env
+	}
+	return slices.DeleteFunc(env, func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return slices.ContainsFunc(hidden, func(h string) bool { return strings.EqualFold(h, name) })
+	})
+}
+
+// prepareCommand 解析命令行，检查 env 中的命令策略，并解析工作目录。
+func prepareCommand(env Env, args runCommandArgs) ([]string, string, error) {
+	argv, err := splitCommandLine(args.Command)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(argv) == 0 {
+		return nil, "", errors.New("command is empty")
+	}
+	if err := checkCommandPolicy(argv, env.commands); err != nil {
+		return nil, "", err
+	}
+
+	dir := env.WorkspaceRoot
+	if args.Workdir != "" {
+		dir, err = env.resolve(args.Workdir)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return argv, dir, nil
+}
+
+// checkCommandPolicy 根据允许/拒绝列表检查命令。
+func checkCommandPolicy(argv []string, policy CommandPolicy) error {
+	for _, rule := range policy.Deny {
+		if commandMatches(argv, rule) {
+			return fmt.Errorf("command denied by policy: matches deny rule '%s'", rule)
+		}
+	}
+	if len(policy.Allow) == 0 {
+		return nil
+	}
+	var unsafeErr error
+	for _, rule := range policy.Allow {
+		if !commandMatches(argv, rule) {
+			continue
+		}
+		// 规则中写明的参数是用户明确允许的，只检查规则之外的参数
+		extra := argv[len(strings.Fields(rule)):]
+		if arg, unsafe := unsafeCommandArg(argv[0], extra); unsafe {
+			unsafeErr = fmt.Errorf("command not allowed by policy: '%s' can run other programs or write files outside the workspace; add an allow rule that includes it to permit it", arg)
+			continue
+		}
+		return nil
+	}
+	if unsafeErr != nil {
+		return unsafeErr
+	}
+	return fmt.Errorf("command not allowed by policy; allowed commands: %s", strings.Join(policy.Allow, ", "))
+}
+
+// unsafeCommandFlags 按可执行文件列出会执行其他程序或把输出写到指定路径的参数（不含前导 "-"）。
+// 允许列表按前缀匹配，"go test" 同样匹配 "go test -exec=/tmp/x"，所以这些参数需要单独拒绝。
+var unsafeCommandFlags = map[string][]string{
+	"go": {
+		"exec", "toolexec", "vettool", "o", "pkgdir",
+		"coverprofile", "cpuprofile", "memprofile", "blockprofile", "mutexprofile", "trace", "outputdir",
+	},
+	"git": {"output", "ext-diff", "no-index", "exec", "upload-pack", "receive-pack"},
+}
+
+// unsafeCommandArg 返回 args 中第一个让命令 name 执行其他程序或写入任意文件的参数。
+func unsafeCommandArg(name string, args []string) (string, bool) {
+	name = strings.TrimSuffix(filepath.Base(name), ".exe")
+	flags, ok := unsafeCommandFlags[name]
+	if !ok {
+		return "", false
+	}
+	for _, arg := range args {
+		// go 的 -ldflags 可以用 -extld 指定任意链接器程序
+		if name == "go" && strings.Contains(arg, "-extld") {
+			return arg, true
+		}
+		flag, ok := strings.CutPrefix(arg, "-")
+		if !ok {
+			continue
+		}
+		if name == "go" {
+			// go 接受 -flag 和 --flag，go test 还接受 -test.flag
+			flag = strings.TrimPrefix(flag, "-")
+			flag = strings.TrimPrefix(flag, "test.")
+		} else if flag, ok = strings.CutPrefix(flag, "-"); !ok {
+			// git 的这些参数都是长参数
+			continue
+		}
+		flag, _, _ = strings.Cut(flag, "=")
+		if slices.Contains(flags, flag) {
+			return arg, true
+		}
+	}
+	return "", false
+}
+
+// commandMatches 判断 argv 是否以 rule 的各个词开头。
+// 第一个词按可执行文件名比较，因此 "/usr/bin/rm" 也会匹配规则 "rm"。
+func commandMatches(argv []string, rule string) bool {
+	ruleArgs := strings.Fields(rule)
+	if len(ruleArgs) == 0 || len(ruleArgs) > len(argv) {
+		return false
+	}
+	for i, word := range ruleArgs {
+		arg := argv[i]
+		if i == 0 {
+			arg = strings.TrimSuffix(filepath.Base(arg), ".exe")
+		}
+		if arg != word {
+			return false
+		}
+	}
+	return true
+}
+
+// splitCommandLine 按类似 shell 的规则把命令行拆分为参数，支持单引号、双引号和反斜杠转义。
+// 由于命令不经过 shell 执行，未加引号的 shell 操作符会被拒绝，而不是被悄悄当作普通参数。
+func splitCommandLine(line string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case strings.ContainsRune("|&;<>()$`\n", r):
+			return nil, fmt.Errorf("shell operator '%c' is not supported: run one command at a time without pipes or redirects", r)
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in command")
+	}
+	if escaped {
+		return nil, errors.New("command ends with a dangling escape character")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// cappedBuffer 是一个只保留开头和结尾部分的 io.Writer，
+// 用于捕获可能非常长的命令输出。
+type cappedBuffer struct {
+	limit int
+	head  []byte
+	tail  []byte
+	total int
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.total += n
+
+	headLimit := b.limit / 2
+	if room := headLimit - len(b.head); room > 0 {
+		k := min(room, len(p))
+		b.head = append(b.head, p[:k]...)
+		p = p[k:]
+	}
+	if len(p) > 0 {
+		b.tail = append(b.tail, p...)
+		if over := len(b.tail) - (b.limit - headLimit); over > 0 {
+			b.tail = append(b.tail[:0:0], b.tail[over:]...)
+		}
+	}
+	return n, nil
+}
+
+func (b *cappedBuffer) String() string {
+	kept := len(b.head) + len(b.tail)
+	if b.total <= kept {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n... [%d bytes truncated] ...\n%s", b.head, b.total-kept, b.tail)
+}
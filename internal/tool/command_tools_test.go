@@ -0,0 +1,97 @@
+// internal/tool/command_tools_test.go
+package tool
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCommandPolicy(t *testing.T) {
+	policy := CommandPolicy{
+		Allow: []string{"go build", "go test", "go vet", "gofmt", "git status", "git diff", "git log", "go test -coverprofile=cover.out"},
+		Deny:  []string{"rm", "git push"},
+	}
+	tests := []struct {
+		command string
+		wantErr string // 为空表示应当允许
+	}{
+		{command: "go test ./..."},
+		{command: "go test -run TestX -v ./internal/tool"},
+		{command: "/usr/local/go/bin/go build ./..."},
+		{command: "gofmt -l -w ."},
+		{command: "git diff --stat HEAD~1"},
+		{command: "git log --oneline -n 5"},
+		// 规则中写明的参数是允许的
+		{command: "go test -coverprofile=cover.out ./..."},
+		{command: "go run .", wantErr: "not allowed by policy; allowed commands"},
+		{command: "rm -rf /", wantErr: "matches deny rule 'rm'"},
+		{command: "git push origin main", wantErr: "matches deny rule 'git push'"},
+		// 前缀匹配的允许规则不能用来执行其他程序或写入任意文件
+		{command: "go test -exec=/tmp/evil ./...", wantErr: "'-exec=/tmp/evil' can run other programs"},
+		{command: "go test -exec /tmp/evil ./...", wantErr: "'-exec'"},
+		{command: "go test --exec=/tmp/evil ./...", wantErr: "'--exec=/tmp/evil'"},
+		{command: "go build -toolexec=/tmp/evil ./...", wantErr: "'-toolexec=/tmp/evil'"},
+		{command: "go vet -vettool=/tmp/evil ./...", wantErr: "'-vettool=/tmp/evil'"},
+		{command: "go build -o /usr/local/bin/x .", wantErr: "'-o'"},
+		{command: "go build -ldflags=-extld=/tmp/evil .", wantErr: "'-ldflags=-extld=/tmp/evil'"},
+		{command: "go test -test.cpuprofile=/etc/x ./...", wantErr: "'-test.cpuprofile=/etc/x'"},
+		{command: "go test -coverprofile=/etc/x ./...", wantErr: "'-coverprofile=/etc/x'"},
+		{command: "git diff --output=/etc/passwd", wantErr: "'--output=/etc/passwd'"},
+		{command: "git log -p --output=/tmp/x", wantErr: "'--output=/tmp/x'"},
+		{command: "git diff --ext-diff", wantErr: "'--ext-diff'"},
+		{command: "git diff --no-index /etc/passwd /dev/null", wantErr: "'--no-index'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			argv, err := splitCommandLine(tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkCommandPolicy(argv, policy)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkCommandPolicy: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkCommandPolicy error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 没有允许列表时只检查拒绝列表
+	argv, _ := splitCommandLine("go test -exec=/tmp/x ./...")
+	if err := checkCommandPolicy(argv, CommandPolicy{Deny: []string{"rm"}}); err != nil {
+		t.Errorf("checkCommandPolicy without an allow list: %v", err)
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{line: "go test ./...", want: []string{"go", "test", "./..."}},
+		{line: `grep -n "a b" 'c d' e\ f`, want: []string{"grep", "-n", "a b", "c d", "e f"}},
+		{line: `echo "it's" ""`, want: []string{"echo", "it's", ""}},
+		{line: `echo "a|b"`, want: []string{"echo", "a|b"}},
+		{line: "go test ./... | tee out", wantErr: true},
+		{line: "make && make install", wantErr: true},
+		{line: "echo $HOME", wantErr: true},
+		{line: `echo "unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := splitCommandLine(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("splitCommandLine(%q) = %q, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") || len(got) != len(tt.want) {
+			t.Errorf("splitCommandLine(%q) = %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+}
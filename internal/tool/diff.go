@@ -0,0 +1,168 @@
+// internal/tool/diff.go
+package tool
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContextLines 是每个 hunk 前后保留的上下文行数。
+	diffContextLines = 3
+	// maxDiffCells 限制 LCS 表的大小，超过时退化为整体替换，避免巨大文件耗尽内存。
+	maxDiffCells = 4_000_000
+)
+
+type diffOp struct {
+	kind byte // ' ' 表示未变，'-' 表示删除，'+' 表示新增
+	text string
+}
+
+// unifiedDiff 生成从 oldText 到 newText 的统一格式 diff。内容相同时返回空字符串。
+func unifiedDiff(path, oldText, newText string) string {
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	// 标记每个变更前后 diffContextLines 行，连续被标记的区域组成一个 hunk。
+	include := make([]bool, len(ops))
+	changed := false
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		changed = true
+		for j := max(0, i-diffContextLines); j <= min(len(ops)-1, i+diffContextLines); j++ {
+			include[j] = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+
+	aLine, bLine := 0, 0
+	for i := 0; i < len(ops); {
+		if !include[i] {
+			aLine, bLine = advance(ops[i], aLine, bLine)
+			i++
+			continue
+		}
+
+		aStart, bStart := aLine, bLine
+		var body strings.Builder
+		for ; i < len(ops) && include[i]; i++ {
+			body.WriteByte(ops[i].kind)
+			body.WriteString(ops[i].text)
+			body.WriteByte('\n')
+			aLine, bLine = advance(ops[i], aLine, bLine)
+		}
+		aLen, bLen := aLine-aStart, bLine-bStart
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		sb.WriteString(body.String())
+	}
+	return sb.String()
+}
+
+// diffLines 计算两组行之间的编辑序列。公共的前缀和后缀会先被剥离，
+// 中间部分使用 LCS 求解。
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	ops := make([]diffOp, 0, n+m)
+	if n*m > maxDiffCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// table[i*(m+1)+j] 是 a[i:] 与 b[j:] 的最长公共子序列长度
+	width := m + 1
+	table := make([]int32, (n+1)*width)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i*width+j] = table[(i+1)*width+j+1] + 1
+			} else {
+				table[i*width+j] = max(table[(i+1)*width+j], table[i*width+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case table[(i+1)*width+j] >= table[i*width+j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+func advance(op diffOp, aLine, bLine int) (int, int) {
+	switch op.kind {
+	case ' ':
+		return aLine + 1, bLine + 1
+	case '-':
+		return aLine + 1, bLine
+	default:
+		return aLine, bLine + 1
+	}
+}
+
+// hunkRange 按统一 diff 的约定格式化 hunk 范围：空范围的起始行是它前面那一行。
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines 按行切分文本，末尾换行符不会产生额外的空行。
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -1,17 +1,67 @@
 package tool
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
 
-// Execute 是执行一个已注册工具的通用入口。
-// 它接收工具名称和 JSON 格式的参数字符串。
-// 它返回工具执行后的字符串结果或一个错误。
-func Execute(name, arguments string) (string, error) {
+// Execute 执行注册表中的一个工具。
+// 它接收工具名称和 JSON 格式的参数字符串，先按工具的 schema 修复并校验参数、检查工具策略，
+// 然后在工具的超时时间内运行它。参数不合法时返回 *ArgumentError。
+// 它返回工具执行后的结构化结果或一个错误；超过大小上限的结果文本会被从中间截断。
+func (r *Registry) Execute(ctx context.Context, env Env, name, arguments string) (Result, error) {
 	// 从注册表中查找对应的工具执行函数
-	executorFunc, found := GetExecutor(name)
+	executorFunc, found := r.GetExecutor(name)
 	if !found {
-		return "", fmt.Errorf("tool '%s' not found in registry", name)
+		return Result{}, fmt.Errorf("tool '%s' not found in registry", name)
+	}
+	// 用户已经中断时不再启动新的工具
+	if err := ctx.Err(); err != nil {
+		return Result{}, fmt.Errorf("tool '%s' was not run: %w", name, err)
+	}
+	// 被策略禁用的工具即使被模型臆造出来也不能执行
+	r.mu.RLock()
+	allowed := r.policy.allows(name)
+	r.mu.RUnlock()
+	if !allowed {
+		return Result{}, fmt.Errorf("tool '%s' is disabled by policy", name)
+	}
+	arguments, err := r.ValidateArguments(name, arguments)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := r.CheckPolicy(name, arguments); err != nil {
+		return Result{}, err
+	}
+	if env.Logger == nil {
+		env.Logger = log.Default()
+	}
+	env, err = r.env(env)
+	if err != nil {
+		return Result{}, err
+	}
+
+	timeout := r.Timeout(name)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	// 调用找到的函数并返回其结果
-	return executorFunc(arguments)
+	result, err := executorFunc(ctx, env, arguments)
+	if err != nil {
+		if timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Result{}, fmt.Errorf("tool '%s' timed out after %s: %w", name, timeout, err)
+		}
+		return Result{}, err
+	}
+	return truncateResult(result, r.resultBudget()), nil
+}
+
+// Execute 是执行默认注册表中已注册工具的通用入口。
+func Execute(ctx context.Context, env Env, name, arguments string) (Result, error) {
+	return Default().Execute(ctx, env, name, arguments)
 }
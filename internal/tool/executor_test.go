@@ -0,0 +1,123 @@
+// internal/tool/executor_test.go
+package tool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synapse/internal/llm"
+)
+
+// waitForCancel 是一个一直运行到 ctx 被取消的工具。
+func waitForCancel(ctx context.Context, _ Env, _ string) (Result, error) {
+	select {
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	case <-time.After(5 * time.Second):
+		return TextResult("finished"), nil
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"slow", "own_timeout", "unlimited"} {
+		r.MustRegister(llm.Tool{Name: name}, waitForCancel, AccessReadOnly)
+	}
+	r.SetDefaultTimeout(20 * time.Millisecond)
+	r.SetTimeout("own_timeout", 40*time.Millisecond)
+	r.SetTimeout("unlimited", NoTimeout)
+
+	for name, want := range map[string]time.Duration{"slow": 20 * time.Millisecond, "own_timeout": 40 * time.Millisecond, "unlimited": 0, "unknown": 0} {
+		if got := r.Timeout(name); got != want {
+			t.Errorf("Timeout(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	_, err := r.Execute(context.Background(), Env{}, "slow", "{}")
+	if err == nil || !strings.Contains(err.Error(), "tool 'slow' timed out after 20ms") || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Execute(slow) error = %v, want a timeout", err)
+	}
+
+	// 不受超时限制的工具只能被调用方取消
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	_, err = r.Execute(ctx, Env{}, "unlimited", "{}")
+	if !errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "timed out after") {
+		t.Errorf("Execute(unlimited) error = %v, want the caller's deadline", err)
+	}
+
+	// 恢复使用默认超时
+	r.SetTimeout("own_timeout", 0)
+	if got := r.Timeout("own_timeout"); got != 20*time.Millisecond {
+		t.Errorf("Timeout after reset = %v, want the default", got)
+	}
+	if err := r.SetTimeout("missing", time.Second); err == nil {
+		t.Error("SetTimeout accepted an unknown tool")
+	}
+}
+
+func TestExecuteAfterCancel(t *testing.T) {
+	r := NewRegistry()
+	ran := false
+	r.MustRegister(llm.Tool{Name: "t"}, func(context.Context, Env, string) (Result, error) {
+		ran = true
+		return TextResult("ok"), nil
+	}, AccessReadOnly)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Execute(ctx, Env{}, "t", "{}"); !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "was not run") {
+		t.Errorf("Execute with a cancelled context error = %v", err)
+	}
+	if ran {
+		t.Error("the tool ran after the context was cancelled")
+	}
+}
+
+func TestExecuteEnv(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	r := NewRegistry()
+	r.SetWorkspace(ws)
+	var got Env
+	r.MustRegister(llm.Tool{Name: "t"}, func(_ context.Context, env Env, _ string) (Result, error) {
+		got = env
+		return TextResult("ok"), nil
+	}, AccessReadOnly)
+	if _, err := r.Execute(context.Background(), Env{SessionID: "session-1"}, "t", "{}"); err != nil {
+		t.Fatal(err)
+	}
+	// 注册表填入工作区和默认的日志，调用方提供的字段保持不变
+	if got.SessionID != "session-1" || got.WorkspaceRoot != ws.Root() || got.Workspace != ws || got.Logger == nil {
+		t.Errorf("env = %+v", got)
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	legacy := Adapt(func(arguments string) (string, error) {
+		return "got " + arguments, nil
+	})
+	result, err := legacy(context.Background(), Env{}, `{"a": 1}`)
+	if err != nil || result.Text != `got {"a": 1}` {
+		t.Errorf("adapted tool = %+v, %v", result, err)
+	}
+
+	failing := Adapt(func(string) (string, error) { return "", errors.New("boom") })
+	if _, err := failing(context.Background(), Env{}, "{}"); err == nil || err.Error() != "boom" {
+		t.Errorf("adapted tool error = %v, want boom", err)
+	}
+
+	// 旧版工具不能被中断，取消时 Adapt 立即返回，工具在后台结束
+	release := make(chan struct{})
+	defer close(release)
+	blocking := Adapt(func(string) (string, error) {
+		<-release
+		return "late", nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := blocking(ctx, Env{}, "{}"); !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "abandoned") {
+		t.Errorf("adapted tool after the deadline error = %v", err)
+	}
+}
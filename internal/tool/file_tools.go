@@ -2,138 +2,468 @@
 package tool
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
+)
 
-	"github.com/synapse/internal/llm"
-
-	openai "github.com/sashabaranov/go-openai"
+const (
+	defaultReadLimit  = 2000 // read_file 默认返回的最大行数
+	maxReadLineLength = 2000 // 超过该长度的行会被截断
+	// readHeaderReserve 是 read_file 为标题行和分页提示预留的字节数（不含路径本身）
+	readHeaderReserve = 256
 )
 
-// registerFileTools 向注册表注册所有文件操作工具
-func registerFileTools() {
-	Register(
-		llm.Tool{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "read_file",
-				Description: "Read the content of a single file from the filesystem",
-				Parameters: json.RawMessage(`{
-					"type": "object", "properties": {"file_path": {"type": "string", "description": "The path to the file to read"}}, "required": ["file_path"]
-				}`),
-			},
-		},
-		toolReadFile,
-	)
-
-	Register(
-		llm.Tool{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "create_file",
-				Description: "Create a new file or overwrite an existing file with the provided content",
-				Parameters: json.RawMessage(`{
-					"type": "object", "properties": {"file_path": {"type": "string", "description": "The path where the file should be created"}, "content": {"type": "string", "description": "The content to write to the file"}}, "required": ["file_path", "content"]
-				}`),
-			},
-		},
-		toolCreateFile,
-	)
-
-	Register(
-		llm.Tool{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "edit_file",
-				Description: "Edit an existing file by replacing a specific snippet with new content",
-				Parameters: json.RawMessage(`{
-					"type": "object", "properties": {"file_path": {"type": "string", "description": "The path to the file to edit"}, "original_snippet": {"type": "string", "description": "The exact text snippet to find and replace"}, "new_snippet": {"type": "string", "description": "The new text to replace the original snippet with"}}, "required": ["file_path", "original_snippet", "new_snippet"]
-				}`),
-			},
-		},
-		toolEditFile,
-	)
+// registerFileTools 向注册表 r 注册所有文件操作工具
+func registerFileTools(r *Registry) {
+	MustRegisterTyped(r, TypedTool[readFileArgs]{
+		Name:        "read_file",
+		Description: "Read the content of a single file from the filesystem. Each output line is prefixed with its line number and a tab, which are not part of the file. Large files are returned in pages; use offset and limit to read further",
+		Access:      AccessReadOnly,
+		Run:         toolReadFile,
+		Targets:     func(a readFileArgs) []string { return []string{a.FilePath} },
+	})
+
+	MustRegisterTyped(r, TypedTool[createFileArgs]{
+		Name:        "create_file",
+		Description: "Create a new file or overwrite an existing file with the provided content",
+		Access:      AccessMutating,
+		Run:         toolCreateFile,
+		Preview:     previewCreateFile,
+		Targets:     func(a createFileArgs) []string { return []string{a.FilePath} },
+	})
+
+	MustRegisterTyped(r, TypedTool[editFileArgs]{
+		Name:        "edit_file",
+		Description: "Edit an existing file. Either replace a specific snippet with new content, or replace a range of lines. Pass 'edits' to apply several edits to the same file in one call; they are applied in order and nothing is written unless all of them succeed",
+		Access:      AccessMutating,
+		Run:         toolEditFile,
+		Preview:     previewEditFile,
+		Targets:     func(a editFileArgs) []string { return []string{a.FilePath} },
+	})
+
+	MustRegisterTyped(r, TypedTool[deleteFileArgs]{
+		Name:        "delete_file",
+		Description: "Delete a file or an empty directory. Set recursive to delete a directory and everything in it",
+		Access:      AccessDestructive,
+		Run:         toolDeleteFile,
+		Preview:     previewDeleteFile,
+		Targets:     func(a deleteFileArgs) []string { return []string{a.FilePath} },
+	})
+
+	MustRegisterTyped(r, TypedTool[moveFileArgs]{
+		Name:        "move_file",
+		Description: "Move or rename a file or directory. Missing parent directories of the destination are created",
+		Access:      AccessDestructive,
+		Run:         toolMoveFile,
+		Preview:     previewMoveFile,
+		Targets:     func(a moveFileArgs) []string { return []string{a.Source, a.Destination} },
+	})
+
+	MustRegisterTyped(r, TypedTool[createDirectoryArgs]{
+		Name:        "create_directory",
+		Description: "Create a directory, including any missing parent directories",
+		Access:      AccessDestructive,
+		Run:         toolCreateDirectory,
+		Preview:     previewCreateDirectory,
+		Targets:     func(a createDirectoryArgs) []string { return []string{a.Path} },
+	})
+
+	r.markRecorded("create_file", "edit_file", "delete_file", "move_file", "create_directory")
 }
 
 // --- Tool Implementations ---
 
-func toolReadFile(arguments string) (string, error) {
-	var args struct {
-		FilePath string `json:"file_path"`
+type readFileArgs struct {
+	FilePath string `json:"file_path" desc:"The path to the file to read" required:"true"`
+	Offset   int    `json:"offset" desc:"The 1-based line number to start reading from" default:"1"`
+	Limit    int    `json:"limit" desc:"The maximum number of lines to read" default:"2000"`
+}
+
+func toolReadFile(_ context.Context, env Env, args readFileArgs) (Result, error) {
+	if args.Offset <= 0 {
+		args.Offset = 1
+	}
+	if args.Limit <= 0 {
+		args.Limit = defaultReadLimit
+	}
+
+	content, err := readFileWindow(env, args.FilePath, args.Offset, args.Limit)
+	if err != nil {
+		return Result{}, fmt.Errorf("error reading file '%s': %w", args.FilePath, err)
+	}
+	return Result{
+		Text:    content,
+		Summary: fmt.Sprintf("Read '%s'", args.FilePath),
+		Meta:    map[string]any{"bytes": len(content)},
+	}, nil
+}
+
+type createFileArgs struct {
+	FilePath string `json:"file_path" desc:"The path where the file should be created" required:"true"`
+	Content  string `json:"content" desc:"The content to write to the file" required:"true"`
+}
+
+func toolCreateFile(_ context.Context, env Env, args createFileArgs) (Result, error) {
+	existing, readErr := readLocalFile(env, args.FilePath)
+	if err := createFile(env, args.FilePath, args.Content); err != nil {
+		return Result{}, fmt.Errorf("error creating file '%s': %w", args.FilePath, err)
+	}
+	res := Result{
+		Text: fmt.Sprintf("Successfully created/updated file '%s'", args.FilePath),
+		Meta: map[string]any{"bytes": len(args.Content), "lines": len(splitLines(args.Content))},
+	}
+	if readErr == nil {
+		res.Summary = fmt.Sprintf("Overwrote '%s' (%d bytes)", args.FilePath, len(args.Content))
+		res.Diff = unifiedDiff(args.FilePath, existing, args.Content)
+	} else {
+		res.Summary = fmt.Sprintf("Created '%s' (%d bytes)", args.FilePath, len(args.Content))
+	}
+	return res, nil
+}
+
+// fileEdit 是 edit_file 中的一次编辑：要么替换一段文本，要么替换一个行范围。
+type fileEdit struct {
+	OriginalSnippet string `json:"original_snippet" desc:"The exact text snippet to find and replace"`
+	NewSnippet      string `json:"new_snippet" desc:"The new text to replace the original snippet (or line range) with"`
+	ReplaceAll      bool   `json:"replace_all" desc:"Replace every occurrence of original_snippet instead of requiring it to be unique" default:"false"`
+	StartLine       int    `json:"start_line" desc:"Line-range mode: the first line (1-based) to replace with new_snippet"`
+	EndLine         int    `json:"end_line" desc:"Line-range mode: the last line (inclusive) to replace. Defaults to start_line"`
+}
+
+type editFileArgs struct {
+	FilePath string `json:"file_path" desc:"The path to the file to edit" required:"true"`
+	fileEdit
+	Edits []fileEdit `json:"edits" desc:"A list of edits applied in order. Line numbers refer to the file as it is after the previous edits"`
+}
+
+// edits 返回需要按顺序应用的所有编辑；顶层的单个编辑（如果有）排在最前面。
+func (a editFileArgs) edits() []fileEdit {
+	var edits []fileEdit
+	if a.OriginalSnippet != "" || a.StartLine > 0 {
+		edits = append(edits, a.fileEdit)
+	}
+	return append(edits, a.Edits...)
+}
+
+func toolEditFile(_ context.Context, env Env, args editFileArgs) (Result, error) {
+	content, err := readLocalFile(env, args.FilePath)
+	if err != nil {
+		return Result{}, err
+	}
+
+	updatedContent, replacements, err := applyEdits(content, args.edits())
+	if err != nil {
+		return Result{}, err
+	}
+	if err := createFile(env, args.FilePath, updatedContent); err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Text:    fmt.Sprintf("Successfully applied %d edit(s) (%d replacement(s)) to file '%s'", len(args.edits()), replacements, args.FilePath),
+		Summary: fmt.Sprintf("Edited '%s' (%d replacement(s))", args.FilePath, replacements),
+		Meta:    map[string]any{"edits": len(args.edits()), "replacements": replacements},
+		Diff:    unifiedDiff(args.FilePath, content, updatedContent),
+	}, nil
+}
+
+type deleteFileArgs struct {
+	FilePath  string `json:"file_path" desc:"The path of the file or directory to delete" required:"true"`
+	Recursive bool   `json:"recursive" desc:"Delete a non-empty directory and all of its contents" default:"false"`
+}
+
+func toolDeleteFile(_ context.Context, env Env, args deleteFileArgs) (Result, error) {
+	target, info, err := resolveDeleteTarget(env, args)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := env.record(target); err != nil {
+		return Result{}, err
 	}
-	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
-		return "", fmt.Errorf("invalid arguments for read_file: %w", err)
+	if info.IsDir() && args.Recursive {
+		err = os.RemoveAll(target)
+	} else {
+		err = os.Remove(target)
 	}
-	content, err := readLocalFile(args.FilePath)
 	if err != nil {
-		return "", fmt.Errorf("error reading file '%s': %w", args.FilePath, err)
+		return Result{}, fmt.Errorf("error deleting '%s': %w", args.FilePath, err)
 	}
-	return fmt.Sprintf("Content of file '%s':\n\n%s", args.FilePath, content), nil
+	return Result{
+		Text:    fmt.Sprintf("Successfully deleted '%s'", args.FilePath),
+		Summary: fmt.Sprintf("Deleted '%s'", args.FilePath),
+	}, nil
+}
+
+type moveFileArgs struct {
+	Source      string `json:"source" desc:"The current path of the file or directory" required:"true"`
+	Destination string `json:"destination" desc:"The new path" required:"true"`
+	Overwrite   bool   `json:"overwrite" desc:"Replace the destination file if it already exists" default:"false"`
 }
 
-func toolCreateFile(arguments string) (string, error) {
-	var args struct {
-		FilePath string `json:"file_path"`
-		Content  string `json:"content"`
+func toolMoveFile(_ context.Context, env Env, args moveFileArgs) (Result, error) {
+	source, destination, err := resolveMoveTargets(env, args)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, p := range []string{source, destination} {
+		if err := env.record(p); err != nil {
+			return Result{}, err
+		}
 	}
-	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
-		return "", fmt.Errorf("invalid arguments for create_file: %w", err)
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return Result{}, err
 	}
-	if err := createFile(args.FilePath, args.Content); err != nil {
-		return "", fmt.Errorf("error creating file '%s': %w", args.FilePath, err)
+	if err := os.Rename(source, destination); err != nil {
+		return Result{}, fmt.Errorf("error moving '%s' to '%s': %w", args.Source, args.Destination, err)
 	}
-	return fmt.Sprintf("Successfully created/updated file '%s'", args.FilePath), nil
+	return Result{
+		Text:    fmt.Sprintf("Successfully moved '%s' to '%s'", args.Source, args.Destination),
+		Summary: fmt.Sprintf("Moved '%s' -> '%s'", args.Source, args.Destination),
+	}, nil
 }
 
-func toolEditFile(arguments string) (string, error) {
-	var args struct {
-		FilePath        string `json:"file_path"`
-		OriginalSnippet string `json:"original_snippet"`
-		NewSnippet      string `json:"new_snippet"`
+type createDirectoryArgs struct {
+	Path string `json:"path" desc:"The directory to create" required:"true"`
+}
+
+func toolCreateDirectory(_ context.Context, env Env, args createDirectoryArgs) (Result, error) {
+	dir, err := env.resolve(args.Path)
+	if err != nil {
+		return Result{}, err
 	}
-	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
-		return "", fmt.Errorf("invalid arguments for edit_file: %w", err)
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return Result{}, fmt.Errorf("'%s' already exists and is not a directory", args.Path)
+		}
+		return TextResult(fmt.Sprintf("Directory '%s' already exists", args.Path)), nil
+	}
+	if err := env.record(dir); err != nil {
+		return Result{}, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Result{}, fmt.Errorf("error creating directory '%s': %w", args.Path, err)
+	}
+	return Result{
+		Text:    fmt.Sprintf("Successfully created directory '%s'", args.Path),
+		Summary: fmt.Sprintf("Created directory '%s'", args.Path),
+	}, nil
+}
+
+// --- Previews ---
+
+// maxPreviewLines 限制新文件预览展示的行数。
+const maxPreviewLines = 40
+
+func previewCreateFile(env Env, args createFileArgs) (string, error) {
+	existing, err := readLocalFile(env, args.FilePath)
+	if err == nil {
+		diff := unifiedDiff(args.FilePath, existing, args.Content)
+		if diff == "" {
+			return fmt.Sprintf("File '%s' already has this content (no changes).", args.FilePath), nil
+		}
+		return fmt.Sprintf("Overwrite file '%s':\n%s", args.FilePath, diff), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
 	}
 
-	content, err := readLocalFile(args.FilePath)
+	lines := splitLines(args.Content)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Create new file '%s' (%d lines):\n", args.FilePath, len(lines))
+	for i, line := range lines {
+		if i == maxPreviewLines {
+			fmt.Fprintf(&sb, "... (%d more lines)\n", len(lines)-maxPreviewLines)
+			break
+		}
+		sb.WriteString("+" + line + "\n")
+	}
+	return sb.String(), nil
+}
+
+func previewEditFile(env Env, args editFileArgs) (string, error) {
+	content, err := readLocalFile(env, args.FilePath)
 	if err != nil {
 		return "", err
 	}
+	updatedContent, _, err := applyEdits(content, args.edits())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Edit file '%s':\n%s", args.FilePath, unifiedDiff(args.FilePath, content, updatedContent)), nil
+}
 
-	occurrences := strings.Count(content, args.OriginalSnippet)
-	if occurrences == 0 {
-		return "", errors.New("original snippet not found in file")
+func previewDeleteFile(env Env, args deleteFileArgs) (string, error) {
+	target, info, err := resolveDeleteTarget(env, args)
+	if err != nil {
+		return "", err
 	}
-	if occurrences > 1 {
-		return "", fmt.Errorf("ambiguous edit: %d matches found for the snippet", occurrences)
+	if !info.IsDir() {
+		return fmt.Sprintf("Delete file '%s' (%d bytes)", args.FilePath, info.Size()), nil
+	}
+	count := 0
+	_ = filepath.WalkDir(target, func(_ string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return fmt.Sprintf("Delete directory '%s' and the %d file(s) inside it", args.FilePath, count), nil
+}
+
+func previewMoveFile(env Env, args moveFileArgs) (string, error) {
+	if _, _, err := resolveMoveTargets(env, args); err != nil {
+		return "", err
 	}
+	return fmt.Sprintf("Move '%s' -> '%s'", args.Source, args.Destination), nil
+}
 
-	updatedContent := strings.Replace(content, args.OriginalSnippet, args.NewSnippet, 1)
-	if err := createFile(args.FilePath, updatedContent); err != nil {
+func previewCreateDirectory(env Env, args createDirectoryArgs) (string, error) {
+	if _, err := env.resolve(args.Path); err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("Successfully applied edit to file '%s'", args.FilePath), nil
+	return fmt.Sprintf("Create directory '%s'", args.Path), nil
 }
 
 // --- Helper functions ---
 
-func normalizePath(p string) (string, error) {
-	absPath, err := filepath.Abs(p)
+// resolveDeleteTarget 解析并检查要删除的路径。工作区根目录本身不能被删除，
+// 非空目录只有在 recursive 为 true 时才能删除。符号链接本身会被删除，而不是它指向的文件。
+func resolveDeleteTarget(env Env, args deleteFileArgs) (string, os.FileInfo, error) {
+	target, err := env.resolveLink(args.FilePath)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	if target == env.WorkspaceRoot {
+		return "", nil, errors.New("refusing to delete the workspace root")
+	}
+	info, err := os.Lstat(target)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() && !args.Recursive {
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(entries) > 0 {
+			return "", nil, fmt.Errorf("directory '%s' is not empty; set recursive to delete it with its contents", args.FilePath)
+		}
+	}
+	return target, info, nil
+}
+
+// resolveMoveTargets 解析并检查 move_file 的源路径和目标路径。
+// 两者都不解析最后一个路径分量，因此移动或覆盖的是符号链接本身。
+func resolveMoveTargets(env Env, args moveFileArgs) (string, string, error) {
+	source, err := env.resolveLink(args.Source)
+	if err != nil {
+		return "", "", err
+	}
+	destination, err := env.resolveLink(args.Destination)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := os.Lstat(source); err != nil {
+		return "", "", err
 	}
-	if strings.Contains(absPath, "..") {
-		return "", fmt.Errorf("invalid path: contains '..'")
+	if source == destination {
+		return "", "", errors.New("source and destination are the same path")
 	}
-	return absPath, nil
+	if IsWithin(source, destination) {
+		return "", "", errors.New("cannot move a directory into itself")
+	}
+	if info, err := os.Lstat(destination); err == nil {
+		if info.IsDir() {
+			return "", "", fmt.Errorf("destination '%s' is an existing directory; include the file name in the destination", args.Destination)
+		}
+		if !args.Overwrite {
+			return "", "", fmt.Errorf("destination '%s' already exists; set overwrite to replace it", args.Destination)
+		}
+	}
+	return source, destination, nil
 }
 
-func readLocalFile(path string) (string, error) {
-	normalizedPath, err := normalizePath(path)
+// applyEdits 在内存中依次应用所有编辑，任何一个失败都会返回错误，调用方不应写入文件。
+// 返回更新后的内容和总替换次数。
+func applyEdits(content string, edits []fileEdit) (string, int, error) {
+	if len(edits) == 0 {
+		return "", 0, errors.New("no edits specified: provide original_snippet, start_line or edits")
+	}
+	total := 0
+	for i, edit := range edits {
+		var (
+			n   int
+			err error
+		)
+		if edit.StartLine > 0 {
+			content, err = replaceLines(content, edit.StartLine, edit.EndLine, edit.NewSnippet)
+			n = 1
+		} else {
+			content, n, err = replaceSnippet(content, edit.OriginalSnippet, edit.NewSnippet, edit.ReplaceAll)
+		}
+		if err != nil {
+			if len(edits) == 1 {
+				return "", 0, err
+			}
+			return "", 0, fmt.Errorf("edit #%d failed, no changes were written: %w", i+1, err)
+		}
+		total += n
+	}
+	return content, total, nil
+}
+
+// replaceSnippet 将 content 中的 original 替换为 replacement。
+// replaceAll 为 false 时 original 必须恰好出现一次。
+func replaceSnippet(content, original, replacement string, replaceAll bool) (string, int, error) {
+	if original == "" {
+		return "", 0, errors.New("original_snippet must not be empty")
+	}
+	occurrences := strings.Count(content, original)
+	if occurrences == 0 {
+		return "", 0, errors.New("original snippet not found in file")
+	}
+	if replaceAll {
+		return strings.ReplaceAll(content, original, replacement), occurrences, nil
+	}
+	if occurrences > 1 {
+		return "", 0, fmt.Errorf("ambiguous edit: %d matches found for the snippet (set replace_all to replace every occurrence)", occurrences)
+	}
+	return strings.Replace(content, original, replacement, 1), 1, nil
+}
+
+// replaceLines 用 replacement 替换第 start 到 end 行（从 1 开始，包含两端）。
+// end 为 0 时只替换第 start 行；replacement 为空时删除这些行。
+func replaceLines(content string, start, end int, replacement string) (string, error) {
+	if end == 0 {
+		end = start
+	}
+	lines := splitLines(content)
+	if start < 1 || end < start || end > len(lines) {
+		return "", fmt.Errorf("invalid line range %d-%d: file has %d lines", start, end, len(lines))
+	}
+
+	updated := make([]string, 0, len(lines))
+	updated = append(updated, lines[:start-1]...)
+	updated = append(updated, splitLines(replacement)...)
+	updated = append(updated, lines[end:]...)
+
+	result := strings.Join(updated, "\n")
+	if len(updated) > 0 && strings.HasSuffix(content, "\n") {
+		result += "\n"
+	}
+	return result, nil
+}
+
+func readLocalFile(env Env, path string) (string, error) {
+	normalizedPath, err := env.resolve(path)
 	if err != nil {
 		return "", err
 	}
@@ -144,14 +474,163 @@ func readLocalFile(path string) (string, error) {
 	return string(data), nil
 }
 
-func createFile(path, content string) error {
-	normalizedPath, err := normalizePath(path)
+// readLocalFileMode 与 readLocalFile 相同，同时返回文件的权限。
+func readLocalFileMode(env Env, path string) (string, fs.FileMode, error) {
+	normalizedPath, err := env.resolve(path)
+	if err != nil {
+		return "", 0, err
+	}
+	info, err := os.Stat(normalizedPath)
+	if err != nil {
+		return "", 0, err
+	}
+	data, err := os.ReadFile(normalizedPath)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(data), info.Mode().Perm(), nil
+}
+
+// readFileWindow 读取文件中从 offset 行开始的至多 limit 行，并在每行前加上行号。
+// 输出会保持在本次调用的结果大小上限之内，超出时提前结束，并提示模型从下一行继续分页读取，
+// 这样注册表就不会从中间截断结果、让分页跳过被截掉的行。
+// 二进制或非 UTF-8 文件只返回一段摘要。
+func readFileWindow(env Env, path string, offset, limit int) (string, error) {
+	normalizedPath, err := env.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(normalizedPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", errors.New("path is a directory; use list_directory instead")
+	}
+	if info.Size() == 0 {
+		return fmt.Sprintf("File '%s' is empty.", path), nil
+	}
+
+	sniff := make([]byte, binarySniffLength)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	sniff = sniff[:n]
+	if isBinary(sniff) || !validUTF8Prefix(sniff) {
+		return fmt.Sprintf("File '%s' appears to be binary or is not valid UTF-8 (%d bytes, detected type: %s). Its content is not shown.",
+			path, info.Size(), http.DetectContentType(sniff)), nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	maxBytes := env.resultBudget() - readHeaderReserve - 2*len(path)
+	var body strings.Builder
+	reader := bufio.NewReader(file)
+	lineNo, lastShown := 0, 0
+	truncatedBySize := false
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", err
+		}
+		lineNo++
+		if lineNo < offset || lineNo >= offset+limit || truncatedBySize {
+			continue
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) > maxReadLineLength {
+			line = line[:maxReadLineLength] + "... [line truncated]"
+		}
+		line = strings.ToValidUTF8(line, "\uFFFD")
+		formatted := fmt.Sprintf("%6d\t%s\n", lineNo, line)
+		if body.Len()+len(formatted) > maxBytes && lastShown > 0 {
+			truncatedBySize = true
+			continue
+		}
+		body.WriteString(formatted)
+		lastShown = lineNo
+	}
+
+	if offset > lineNo {
+		return "", fmt.Errorf("offset %d is past the end of the file (%d lines)", offset, lineNo)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "File '%s' (lines %d-%d of %d):\n", path, offset, lastShown, lineNo)
+	sb.WriteString(body.String())
+	if lastShown < lineNo {
+		reason := ""
+		if truncatedBySize {
+			reason = fmt.Sprintf(" (output limited to %d KB)", env.resultBudget()/1024)
+		}
+		fmt.Fprintf(&sb, "[Showing lines %d-%d of %d%s. Call read_file with offset=%d to continue.]\n", offset, lastShown, lineNo, reason, lastShown+1)
+	}
+	return sb.String(), nil
+}
+
+// validUTF8Prefix 判断一段从文件开头截取的字节是否为合法的 UTF-8，
+// 允许末尾有一个被截断的多字节字符。
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		b = b[:len(b)-1]
+	}
+	return len(b) == 0
+}
+
+func createFile(env Env, path, content string) error {
+	return createFileMode(env, path, content, 0)
+}
+
+// createFileMode 与 createFile 相同，但把文件的权限设置为 mode，
+// 用于重命名或恢复文件时保留原来的权限。mode 为 0 时新文件使用 0644，已存在的文件保持不变。
+func createFileMode(env Env, path, content string, mode fs.FileMode) error {
+	normalizedPath, err := env.resolve(path)
 	if err != nil {
 		return err
 	}
+	if err := env.record(normalizedPath); err != nil {
+		return err
+	}
 	dir := filepath.Dir(normalizedPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	return os.WriteFile(normalizedPath, []byte(content), 0644)
+	if err := os.WriteFile(normalizedPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	if mode == 0 {
+		return nil
+	}
+	// WriteFile 不会改变已存在文件的权限
+	return os.Chmod(normalizedPath, mode)
+}
+
+// removeLocalFile 删除工作区内的一个文件；文件不存在时不报错。
+func removeLocalFile(env Env, path string) error {
+	normalizedPath, err := env.resolve(path)
+	if err != nil {
+		return err
+	}
+	if err := env.record(normalizedPath); err != nil {
+		return err
+	}
+	if err := os.Remove(normalizedPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
 }
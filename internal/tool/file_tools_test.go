@@ -0,0 +1,366 @@
+// internal/tool/file_tools_test.go
+package tool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplaceLines(t *testing.T) {
+	const content = "one\ntwo\nthree\nfour\n"
+	tests := []struct {
+		name        string
+		content     string
+		start, end  int
+		replacement string
+		want        string
+		wantErr     bool
+	}{
+		{name: "single line", content: content, start: 2, replacement: "TWO", want: "one\nTWO\nthree\nfour\n"},
+		{name: "range", content: content, start: 2, end: 3, replacement: "middle", want: "one\nmiddle\nfour\n"},
+		{name: "more lines", content: content, start: 1, end: 1, replacement: "a\nb\n", want: "a\nb\ntwo\nthree\nfour\n"},
+		{name: "delete", content: content, start: 2, end: 3, replacement: "", want: "one\nfour\n"},
+		{name: "last line", content: content, start: 4, replacement: "FOUR", want: "one\ntwo\nthree\nFOUR\n"},
+		{name: "delete everything", content: content, start: 1, end: 4, replacement: "", want: ""},
+		{name: "no trailing newline", content: "a\nb", start: 2, replacement: "c", want: "a\nc"},
+		{name: "start zero", content: content, start: 0, replacement: "x", wantErr: true},
+		{name: "end before start", content: content, start: 3, end: 2, replacement: "x", wantErr: true},
+		{name: "past the end", content: content, start: 4, end: 5, replacement: "x", wantErr: true},
+		{name: "empty file", content: "", start: 1, replacement: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := replaceLines(tt.content, tt.start, tt.end, tt.replacement)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("replaceLines = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("replaceLines = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	const content = "a := 1\nb := 1\nc := 2\n"
+	tests := []struct {
+		name      string
+		edits     []fileEdit
+		want      string
+		wantCount int
+		wantErr   string
+	}{
+		{
+			name:      "snippet",
+			edits:     []fileEdit{{OriginalSnippet: "c := 2", NewSnippet: "c := 3"}},
+			want:      "a := 1\nb := 1\nc := 3\n",
+			wantCount: 1,
+		},
+		{
+			name:    "ambiguous snippet",
+			edits:   []fileEdit{{OriginalSnippet: ":= 1", NewSnippet: ":= 0"}},
+			wantErr: "ambiguous edit: 2 matches",
+		},
+		{
+			name:      "replace all",
+			edits:     []fileEdit{{OriginalSnippet: ":= 1", NewSnippet: ":= 0", ReplaceAll: true}},
+			want:      "a := 0\nb := 0\nc := 2\n",
+			wantCount: 2,
+		},
+		{
+			name: "line numbers follow earlier edits",
+			edits: []fileEdit{
+				{StartLine: 1, NewSnippet: "// header\na := 1"},
+				{StartLine: 3, NewSnippet: "b := 5"},
+			},
+			want:      "// header\na := 1\nb := 5\nc := 2\n",
+			wantCount: 2,
+		},
+		{
+			name: "a failing edit reports its index",
+			edits: []fileEdit{
+				{OriginalSnippet: "a := 1", NewSnippet: "a := 9"},
+				{OriginalSnippet: "missing", NewSnippet: "x"},
+			},
+			wantErr: "edit #2 failed",
+		},
+		{
+			name:    "no edits",
+			wantErr: "no edits specified",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := applyEdits(content, tt.edits)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("applyEdits error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want || n != tt.wantCount {
+				t.Errorf("applyEdits = %q, %d, %v; want %q, %d", got, n, err, tt.want, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestEditFileTool(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{"main.go": "package main\n\nfunc main() {\n\tprintln(1)\n}\n"})
+
+	_, err := execute(t, r, "edit_file", map[string]any{
+		"file_path": "main.go",
+		"edits": []map[string]any{
+			{"original_snippet": "println(1)", "new_snippet": "println(2)"},
+			{"start_line": 10, "new_snippet": "x"},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "edit #2 failed") {
+		t.Fatalf("edit_file error = %v, want edit #2 to fail", err)
+	}
+	if got := readFile(t, root, "main.go"); !strings.Contains(got, "println(1)") {
+		t.Fatalf("a failed edit_file changed the file:\n%s", got)
+	}
+
+	result, err := execute(t, r, "edit_file", map[string]any{
+		"file_path":        "main.go",
+		"original_snippet": "println(1)",
+		"new_snippet":      "println(2)",
+		"edits":            []map[string]any{{"start_line": 1, "new_snippet": "package app"}},
+	})
+	if err != nil {
+		t.Fatalf("edit_file: %v", err)
+	}
+	if got, want := readFile(t, root, "main.go"), "package app\n\nfunc main() {\n\tprintln(2)\n}\n"; got != want {
+		t.Errorf("main.go = %q, want %q", got, want)
+	}
+	if result.Meta["edits"] != 2 || !strings.Contains(result.Diff, "+package app") {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestReadFilePagesReturnEveryLineOnce(t *testing.T) {
+	// 2000 行、每行约 100 字节的文件远大于默认的结果大小上限
+	var content strings.Builder
+	const lines = 2000
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&content, "line %04d %s\n", i, strings.Repeat("x", 90))
+	}
+	for _, budget := range []int{0, 4096} {
+		t.Run(fmt.Sprintf("budget %d", budget), func(t *testing.T) {
+			r, _ := newTestRegistry(t, map[string]string{"big.txt": content.String()})
+			r.SetMaxResultBytes(budget)
+			seen := make(map[int]int)
+			offset := 1
+			for pages := 0; offset > 0; pages++ {
+				if pages > lines {
+					t.Fatal("read_file never reached the end of the file")
+				}
+				result, err := execute(t, r, "read_file", map[string]any{"file_path": "big.txt", "offset": offset})
+				if err != nil {
+					t.Fatalf("read_file: %v", err)
+				}
+				if result.Meta["truncated_bytes"] != nil {
+					t.Fatalf("the page at offset %d was truncated by the registry", offset)
+				}
+				offset = 0
+				for _, line := range strings.Split(result.Text, "\n") {
+					var n int
+					if _, err := fmt.Sscanf(line, "%d\tline", &n); err == nil {
+						seen[n]++
+					}
+					if i := strings.Index(line, "offset="); i >= 0 {
+						fmt.Sscanf(line[i:], "offset=%d", &offset)
+					}
+				}
+			}
+			for i := 1; i <= lines; i++ {
+				if seen[i] != 1 {
+					t.Fatalf("line %d was returned %d times", i, seen[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	r, _ := newTestRegistry(t, map[string]string{
+		"five.txt":   "one\ntwo\nthree\nfour\nfive\n",
+		"crlf.txt":   "a\r\nb\r\n",
+		"empty.txt":  "",
+		"image.png":  "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"latin1.txt": "caf\xe9 au lait\n",
+		"long.txt":   strings.Repeat("x", maxReadLineLength+10) + "\n",
+		"emoji.txt":  "héllo 👋\n",
+	})
+	tests := []struct {
+		name    string
+		args    map[string]any
+		want    string // 期望的完整输出
+		contain string // 或者输出中应包含的内容
+	}{
+		{
+			name: "whole file",
+			args: map[string]any{"file_path": "five.txt"},
+			want: "File 'five.txt' (lines 1-5 of 5):\n     1\tone\n     2\ttwo\n     3\tthree\n     4\tfour\n     5\tfive\n",
+		},
+		{
+			name: "window",
+			args: map[string]any{"file_path": "five.txt", "offset": 2, "limit": 2},
+			want: "File 'five.txt' (lines 2-3 of 5):\n     2\ttwo\n     3\tthree\n" +
+				"[Showing lines 2-3 of 5. Call read_file with offset=4 to continue.]\n",
+		},
+		{
+			name: "window reaching the end",
+			args: map[string]any{"file_path": "five.txt", "offset": 4, "limit": 10},
+			want: "File 'five.txt' (lines 4-5 of 5):\n     4\tfour\n     5\tfive\n",
+		},
+		{
+			name: "line endings are not shown",
+			args: map[string]any{"file_path": "crlf.txt"},
+			want: "File 'crlf.txt' (lines 1-2 of 2):\n     1\ta\n     2\tb\n",
+		},
+		{
+			name: "multi-byte characters are kept",
+			args: map[string]any{"file_path": "emoji.txt"},
+			want: "File 'emoji.txt' (lines 1-1 of 1):\n     1\théllo 👋\n",
+		},
+		{name: "empty file", args: map[string]any{"file_path": "empty.txt"}, want: "File 'empty.txt' is empty."},
+		{name: "binary file", args: map[string]any{"file_path": "image.png"}, contain: "appears to be binary or is not valid UTF-8 (16 bytes, detected type: image/png)"},
+		{name: "not UTF-8", args: map[string]any{"file_path": "latin1.txt"}, contain: "appears to be binary or is not valid UTF-8"},
+		{name: "long line", args: map[string]any{"file_path": "long.txt"}, contain: strings.Repeat("x", maxReadLineLength) + "... [line truncated]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := execute(t, r, "read_file", tt.args)
+			if err != nil {
+				t.Fatalf("read_file: %v", err)
+			}
+			if tt.want != "" && result.Text != tt.want {
+				t.Errorf("read_file = %q, want %q", result.Text, tt.want)
+			}
+			if tt.contain != "" && !strings.Contains(result.Text, tt.contain) {
+				t.Errorf("read_file = %q, want it to contain %q", result.Text, tt.contain)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		args    map[string]any
+		wantErr string
+	}{
+		{map[string]any{"file_path": "five.txt", "offset": 6}, "offset 6 is past the end of the file (5 lines)"},
+		{map[string]any{"file_path": "src"}, "path is a directory; use list_directory instead"},
+		{map[string]any{"file_path": "missing.txt"}, "no such file or directory"},
+		{map[string]any{"file_path": "../outside/secret.txt"}, "outside"},
+	} {
+		if _, err := execute(t, r, "read_file", tt.args); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("read_file(%v) error = %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFileOperationTools(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{
+		"a.txt":          "a",
+		"b.txt":          "b",
+		"pkg/one.go":     "package pkg",
+		"pkg/sub/two.go": "package sub",
+	})
+	exists := func(name string) bool {
+		_, err := os.Lstat(filepath.Join(root, name))
+		return err == nil
+	}
+	for _, name := range []string{"delete_file", "move_file", "create_directory"} {
+		if got := r.Access(name); got != AccessDestructive {
+			t.Errorf("Access(%s) = %v, want destructive", name, got)
+		}
+	}
+
+	// move_file 不会静默覆盖已存在的文件
+	if _, err := execute(t, r, "move_file", map[string]any{"source": "a.txt", "destination": "b.txt"}); err == nil || !strings.Contains(err.Error(), "set overwrite to replace it") {
+		t.Errorf("move_file onto an existing file error = %v", err)
+	}
+	if _, err := execute(t, r, "move_file", map[string]any{"source": "a.txt", "destination": "b.txt", "overwrite": true}); err != nil {
+		t.Fatalf("move_file with overwrite: %v", err)
+	}
+	if exists("a.txt") || readFile(t, root, "b.txt") != "a" {
+		t.Errorf("a.txt was not moved over b.txt")
+	}
+	if _, err := execute(t, r, "move_file", map[string]any{"source": "pkg", "destination": "internal/pkg"}); err != nil {
+		t.Fatalf("move_file of a directory: %v", err)
+	}
+	if !exists("internal/pkg/sub/two.go") || exists("pkg") {
+		t.Errorf("pkg was not moved into the new internal directory")
+	}
+	for _, tt := range []struct {
+		args    map[string]any
+		wantErr string
+	}{
+		{map[string]any{"source": "internal", "destination": "internal/pkg/inner"}, "cannot move a directory into itself"},
+		{map[string]any{"source": "b.txt", "destination": "b.txt"}, "source and destination are the same path"},
+		{map[string]any{"source": "b.txt", "destination": "internal"}, "is an existing directory"},
+		{map[string]any{"source": "missing.txt", "destination": "c.txt"}, "no such file or directory"},
+		{map[string]any{"source": "b.txt", "destination": "../outside/b.txt"}, "outside"},
+	} {
+		if _, err := execute(t, r, "move_file", tt.args); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("move_file(%v) error = %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+
+	if _, err := execute(t, r, "create_directory", map[string]any{"path": "new/deep/dir"}); err != nil || !exists("new/deep/dir") {
+		t.Errorf("create_directory: %v", err)
+	}
+	if result, err := execute(t, r, "create_directory", map[string]any{"path": "new"}); err != nil || !strings.Contains(result.Text, "already exists") {
+		t.Errorf("create_directory of an existing directory = %+v, %v", result, err)
+	}
+	if _, err := execute(t, r, "create_directory", map[string]any{"path": "b.txt"}); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Errorf("create_directory over a file error = %v", err)
+	}
+
+	// 非空目录只有在 recursive 为 true 时才会被删除
+	if _, err := execute(t, r, "delete_file", map[string]any{"file_path": "internal"}); err == nil || !strings.Contains(err.Error(), "is not empty") {
+		t.Errorf("delete_file of a non-empty directory error = %v", err)
+	}
+	if _, err := execute(t, r, "delete_file", map[string]any{"file_path": "new/deep/dir"}); err != nil || exists("new/deep/dir") {
+		t.Errorf("delete_file of an empty directory: %v", err)
+	}
+	if _, err := execute(t, r, "delete_file", map[string]any{"file_path": "internal", "recursive": true}); err != nil || exists("internal") {
+		t.Errorf("recursive delete_file: %v", err)
+	}
+	if _, err := execute(t, r, "delete_file", map[string]any{"file_path": "b.txt"}); err != nil || exists("b.txt") {
+		t.Errorf("delete_file: %v", err)
+	}
+	for _, p := range []string{".", "", "src/.."} {
+		if _, err := execute(t, r, "delete_file", map[string]any{"file_path": p, "recursive": true}); err == nil {
+			t.Errorf("delete_file(%q) deleted the workspace root", p)
+		}
+	}
+	if !exists("src") {
+		t.Error("the workspace was deleted")
+	}
+}
+
+func TestDeleteFileRemovesLinksNotTargets(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{"target.txt": "keep me"})
+	symlink(t, "target.txt", filepath.Join(root, "link.txt"))
+	preview, err := r.Preview("delete_file", `{"file_path": "link.txt"}`)
+	if err != nil || !strings.Contains(preview, "Delete file 'link.txt'") {
+		t.Errorf("Preview = %q, %v", preview, err)
+	}
+	if _, err := execute(t, r, "delete_file", map[string]any{"file_path": "link.txt"}); err != nil {
+		t.Fatalf("delete_file: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "link.txt")); !os.IsNotExist(err) {
+		t.Errorf("the link still exists: %v", err)
+	}
+	if got := readFile(t, root, "target.txt"); got != "keep me" {
+		t.Errorf("target.txt = %q, want it untouched", got)
+	}
+}
@@ -0,0 +1,624 @@
+// internal/tool/patch_tools.go
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxPatchFuzz 是查找 hunk 时最多可以忽略的首尾上下文行数（与 patch 的 fuzz 因子类似）。
+	maxPatchFuzz = 2
+	devNull      = "/dev/null"
+)
+
+// registerPatchTools 向注册表 r 注册基于 diff 的编辑工具
+func registerPatchTools(r *Registry) {
+	MustRegisterTyped(r, TypedTool[applyPatchArgs]{
+		Name:        "apply_patch",
+		Description: "Apply a unified diff that may touch multiple files, including creating ('--- /dev/null'), deleting ('+++ /dev/null') and renaming files. Hunks are located by their context, tolerating shifted line numbers and whitespace differences. The patch is atomic: if any hunk fails, no file is changed and every failure is reported",
+		Access:      AccessMutating,
+		Run:         toolApplyPatch,
+		Preview:     previewApplyPatch,
+		Targets:     patchTargets,
+	})
+	r.markRecorded("apply_patch")
+}
+
+// --- Tool Implementations ---
+
+type applyPatchArgs struct {
+	Patch string `json:"patch" desc:"The unified diff text, with '--- a/path' and '+++ b/path' headers followed by '@@' hunks" required:"true"`
+}
+
+func toolApplyPatch(ctx context.Context, env Env, args applyPatchArgs) (Result, error) {
+	changes, err := planPatch(env, args.Patch)
+	if err != nil {
+		return Result{}, err
+	}
+	// 一旦开始写入就不再中断，保证补丁要么完整应用、要么完全不应用
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if err := commitPatch(env, changes); err != nil {
+		return Result{}, fmt.Errorf("error writing patch, all files were restored: %w", err)
+	}
+
+	var sb, diff strings.Builder
+	sb.WriteString("Successfully applied patch:\n")
+	for _, c := range changes {
+		fmt.Fprintf(&sb, "- %s\n", c.summary())
+		for _, note := range c.notes {
+			fmt.Fprintf(&sb, "    %s\n", note)
+		}
+		if !c.delete {
+			diff.WriteString(unifiedDiff(c.displayPath(), c.oldContent, c.newContent))
+		}
+	}
+	return Result{
+		Text:    sb.String(),
+		Summary: fmt.Sprintf("Applied patch to %d file(s)", len(changes)),
+		Meta:    map[string]any{"files": len(changes)},
+		Diff:    diff.String(),
+	}, nil
+}
+
+func previewApplyPatch(env Env, args applyPatchArgs) (string, error) {
+	changes, err := planPatch(env, args.Patch)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&sb, "%s\n", c.summary())
+		if !c.delete {
+			sb.WriteString(unifiedDiff(c.displayPath(), c.oldContent, c.newContent))
+		}
+	}
+	return sb.String(), nil
+}
+
+// patchTargets 返回补丁涉及的所有文件路径。
+func patchTargets(args applyPatchArgs) []string {
+	files, err := parsePatch(args.Patch)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, fp := range files {
+		for _, p := range []string{fp.oldPath, fp.newPath} {
+			if p != devNull && !slices.Contains(paths, p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+// planPatch 解析补丁并在内存中计算每个文件的新内容，不会写入任何文件。
+// 所有 hunk 的失败都会被汇总到一个错误中返回。
+func planPatch(env Env, patch string) ([]*fileChange, error) {
+	files, err := parsePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	var changes []*fileChange
+	var failures []string
+	// 每个小节都从磁盘上的原始内容开始计算，同一个文件出现在多个小节中时
+	// 后面的小节会覆盖前面的修改，因此直接拒绝
+	seen := make(map[string]bool)
+	for _, fp := range files {
+		paths := []string{filepath.Clean(fp.oldPath), filepath.Clean(fp.newPath)}
+		for _, p := range slices.Compact(paths) {
+			if p == devNull {
+				continue
+			}
+			if seen[p] {
+				failures = append(failures, fmt.Sprintf("%s: appears in more than one file section; put all of its hunks in a single section", p))
+			}
+			seen[p] = true
+		}
+	}
+	for _, fp := range files {
+		change, errs := planFilePatch(env, fp)
+		if len(errs) > 0 {
+			failures = append(failures, errs...)
+			continue
+		}
+		changes = append(changes, change)
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("patch not applied, no files were changed. %d problem(s):\n- %s", len(failures), strings.Join(failures, "\n- "))
+	}
+	return changes, nil
+}
+
+// --- Patch parsing ---
+
+type patchLine struct {
+	kind byte // ' '、'-' 或 '+'
+	text string
+}
+
+type patchHunk struct {
+	header   string
+	oldStart int
+	lines    []patchLine
+	// noNewline 记录 "\ No newline at end of file" 标记：
+	// oldNoNewline 表示旧文件末尾没有换行，newNoNewline 表示新文件末尾没有换行。
+	oldNoNewline bool
+	newNoNewline bool
+}
+
+type filePatch struct {
+	oldPath string // devNull 表示新建文件
+	newPath string // devNull 表示删除文件
+	hunks   []*patchHunk
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parsePatch 解析（可能包含多个文件的）统一格式 diff。
+// 模型生成的 hunk 行数经常不准确，因此 hunk 的范围由下一个 hunk 或文件头决定，而不是依赖计数。
+func parsePatch(text string) ([]*filePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	var files []*filePatch
+	var current *filePatch
+	var hunk *patchHunk
+
+	startFile := func() *filePatch {
+		fp := &filePatch{}
+		files = append(files, fp)
+		hunk = nil
+		return fp
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			current = startFile()
+			if a, b, ok := parseGitDiffHeader(line); ok {
+				current.oldPath, current.newPath = a, b
+			}
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath, newPath := parseHeaderPath(line[4:]), parseHeaderPath(lines[i+1][4:])
+			// 只有在 "diff --git" 之后尚未出现任何 hunk、并且路径一致时，才复用同一个 filePatch；
+			// 否则前面是一个没有内容变更的 git 头（例如只重命名），这是下一个文件
+			if current == nil || len(current.hunks) > 0 || hunk != nil || !current.sameFile(oldPath, newPath) {
+				current = startFile()
+			}
+			current.oldPath, current.newPath = oldPath, newPath
+			i++
+		case current != nil && hunk == nil && strings.HasPrefix(line, "rename from "):
+			current.oldPath = strings.TrimSpace(strings.TrimPrefix(line, "rename from "))
+		case current != nil && hunk == nil && strings.HasPrefix(line, "rename to "):
+			current.newPath = strings.TrimSpace(strings.TrimPrefix(line, "rename to "))
+		case current != nil && hunk == nil && strings.HasPrefix(line, "new file mode"):
+			current.oldPath = devNull
+		case current != nil && hunk == nil && strings.HasPrefix(line, "deleted file mode"):
+			current.newPath = devNull
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk header before any '--- a/file' / '+++ b/file' header", i+1)
+			}
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed hunk header %q", i+1, line)
+			}
+			oldStart, _ := strconv.Atoi(m[1])
+			hunk = &patchHunk{header: line, oldStart: oldStart}
+			current.hunks = append(current.hunks, hunk)
+		case hunk != nil && strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file" 作用于它前面的那一行
+			if n := len(hunk.lines); n > 0 {
+				switch hunk.lines[n-1].kind {
+				case '-':
+					hunk.oldNoNewline = true
+				case '+':
+					hunk.newNoNewline = true
+				default:
+					hunk.oldNoNewline, hunk.newNoNewline = true, true
+				}
+			}
+		case hunk != nil && line != "" && (line[0] == ' ' || line[0] == '-' || line[0] == '+'):
+			hunk.lines = append(hunk.lines, patchLine{kind: line[0], text: line[1:]})
+		case hunk != nil && line == "":
+			// 模型常常丢掉空上下文行前面的空格；只有在后面还有 hunk 内容时才视为上下文
+			if i+1 < len(lines) && isHunkBodyLine(lines, i+1) {
+				hunk.lines = append(hunk.lines, patchLine{kind: ' ', text: ""})
+			}
+		}
+	}
+
+	for _, fp := range files {
+		if fp.oldPath == "" || fp.newPath == "" {
+			return nil, errors.New("file header is missing the '--- ' or '+++ ' path")
+		}
+		if fp.oldPath == devNull && fp.newPath == devNull {
+			return nil, errors.New("file header has /dev/null on both sides")
+		}
+		if len(fp.hunks) == 0 && (fp.oldPath == fp.newPath || fp.oldPath == devNull) {
+			return nil, fmt.Errorf("no hunks found for '%s'", fp.displayPath())
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no file headers found; expected '--- a/path' and '+++ b/path' lines")
+	}
+	return files, nil
+}
+
+// isHunkBodyLine 判断 lines[i] 是否仍属于当前 hunk 的内容，而不是下一个文件头。
+func isHunkBodyLine(lines []string, i int) bool {
+	line := lines[i]
+	if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+		return false
+	}
+	return line == "" || line[0] == ' ' || line[0] == '-' || line[0] == '+' || line[0] == '\\'
+}
+
+// parseHeaderPath 从 "--- a/path\t时间戳" 这样的文件头中提取路径。
+func parseHeaderPath(s string) string {
+	if idx := strings.IndexByte(s, '\t'); idx >= 0 {
+		s = s[:idx]
+	}
+	s = strings.TrimSpace(s)
+	if s == devNull {
+		return devNull
+	}
+	s = strings.Trim(s, `"`)
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+func parseGitDiffHeader(line string) (string, string, bool) {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	idx := strings.Index(rest, " b/")
+	if !strings.HasPrefix(rest, "a/") || idx < 0 {
+		return "", "", false
+	}
+	return rest[2:idx], rest[idx+3:], true
+}
+
+// sameFile 判断 "--- "/"+++ " 头中的路径是否与 "diff --git" 头中已知的路径一致。
+func (fp *filePatch) sameFile(oldPath, newPath string) bool {
+	if fp.oldPath == "" && fp.newPath == "" {
+		return true
+	}
+	return (oldPath == devNull || oldPath == fp.oldPath) && (newPath == devNull || newPath == fp.newPath)
+}
+
+func (fp *filePatch) displayPath() string {
+	if fp.newPath != devNull {
+		return fp.newPath
+	}
+	return fp.oldPath
+}
+
+// --- Patch application ---
+
+// fileChange 是一个已经在内存中计算完毕、等待写入的文件变更。
+type fileChange struct {
+	oldPath    string // 为空表示新建文件
+	newPath    string // 为空表示删除文件
+	oldContent string
+	newContent string
+	mode       fs.FileMode // 原文件的权限，新建文件为 0，重命名后的文件沿用它
+	delete     bool
+	notes      []string // 例如使用了偏移或模糊匹配的 hunk
+}
+
+func (c *fileChange) displayPath() string {
+	if c.newPath != "" {
+		return c.newPath
+	}
+	return c.oldPath
+}
+
+func (c *fileChange) summary() string {
+	switch {
+	case c.oldPath == "":
+		return fmt.Sprintf("created %s", c.newPath)
+	case c.delete:
+		return fmt.Sprintf("deleted %s", c.oldPath)
+	case c.oldPath != c.newPath:
+		return fmt.Sprintf("renamed %s -> %s", c.oldPath, c.newPath)
+	default:
+		return fmt.Sprintf("modified %s", c.newPath)
+	}
+}
+
+// planFilePatch 计算单个文件应用补丁后的内容，返回所有失败的描述。
+func planFilePatch(env Env, fp *filePatch) (*fileChange, []string) {
+	change := &fileChange{}
+	var original string
+
+	if fp.oldPath != devNull {
+		change.oldPath = fp.oldPath
+		content, mode, err := readLocalFileMode(env, fp.oldPath)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("%s: cannot read file: %v", fp.oldPath, err)}
+		}
+		original = content
+		change.mode = mode
+	}
+	if fp.newPath == devNull {
+		change.delete = true
+	} else {
+		change.newPath = fp.newPath
+		if fp.newPath != fp.oldPath {
+			if _, err := readLocalFile(env, fp.newPath); err == nil {
+				return nil, []string{fmt.Sprintf("%s: target file already exists", fp.newPath)}
+			}
+		}
+	}
+	change.oldContent = original
+
+	// 统一按 LF 处理，写回时恢复原文件的换行风格
+	crlf := strings.Contains(original, "\r\n")
+	text := strings.ReplaceAll(original, "\r\n", "\n")
+	lines := splitLines(text)
+	endsWithNewline := text == "" || strings.HasSuffix(text, "\n")
+
+	var failures []string
+	offset := 0 // 之前的 hunk 造成的行号偏移
+	from := 0   // 下一个 hunk 只能出现在上一个 hunk 之后
+	for i, h := range fp.hunks {
+		result, ok := applyHunk(lines, h, from, offset)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: hunk #%d (%s) failed: %s", fp.displayPath(), i+1, h.header, result.failure))
+			continue
+		}
+		if result.note != "" {
+			change.notes = append(change.notes, fmt.Sprintf("hunk #%d %s", i+1, result.note))
+		}
+		lines = result.lines
+		from = result.end
+		offset = result.offset
+		if h.newNoNewline {
+			endsWithNewline = false
+		} else if h.oldNoNewline {
+			endsWithNewline = true
+		}
+	}
+	if len(failures) > 0 {
+		return nil, failures
+	}
+
+	if change.delete {
+		if len(lines) > 0 && len(fp.hunks) > 0 {
+			return nil, []string{fmt.Sprintf("%s: deletion patch does not remove all lines of the file", fp.oldPath)}
+		}
+		return change, nil
+	}
+
+	newContent := strings.Join(lines, "\n")
+	if len(lines) > 0 && endsWithNewline {
+		newContent += "\n"
+	}
+	if crlf {
+		newContent = strings.ReplaceAll(newContent, "\n", "\r\n")
+	}
+	change.newContent = newContent
+	return change, nil
+}
+
+type hunkResult struct {
+	lines   []string
+	end     int // 应用后 hunk 在新内容中结束的位置
+	offset  int // 原始行号到当前行号的偏移，用于估计后续 hunk 的位置
+	note    string
+	failure string
+}
+
+type matchLevel int
+
+const (
+	matchExact matchLevel = iota
+	matchIgnoreTrailingSpace
+	matchIgnoreIndentation
+)
+
+// applyHunk 在 lines 中定位并应用一个 hunk。
+// 依次尝试：精确匹配、忽略行尾空白、忽略首尾空白，并在每一级上逐步减少首尾上下文。
+func applyHunk(lines []string, h *patchHunk, from, offset int) (hunkResult, bool) {
+	// hunk 在原文件中开始的行下标。没有上下文和删除行的纯插入 hunk（"@@ -5,0 +6,2 @@"）
+	// 的起始行号表示插入到该行之后
+	start := h.oldStart - 1
+	if !slices.ContainsFunc(h.lines, func(l patchLine) bool { return l.kind != '+' }) {
+		start = h.oldStart
+	}
+	start = max(0, start)
+	hint := max(0, start+offset)
+
+	for fuzz := 0; fuzz <= maxPatchFuzz; fuzz++ {
+		body, lead, ok := trimContext(h.lines, fuzz)
+		if !ok {
+			break
+		}
+		old, replacement := splitHunk(body)
+		for level := matchExact; level <= matchIgnoreIndentation; level++ {
+			pos, found := locate(lines, old, from, hint+lead, level)
+			if !found {
+				continue
+			}
+
+			updated := make([]string, 0, len(lines)-len(old)+len(replacement))
+			updated = append(updated, lines[:pos]...)
+			updated = append(updated, replacement...)
+			updated = append(updated, lines[pos+len(old):]...)
+
+			var notes []string
+			if pos != hint+lead && len(old) > 0 {
+				notes = append(notes, fmt.Sprintf("offset %+d lines", pos-hint-lead))
+			}
+			if level == matchIgnoreTrailingSpace {
+				notes = append(notes, "ignoring trailing whitespace")
+			} else if level == matchIgnoreIndentation {
+				notes = append(notes, "ignoring indentation")
+			}
+			if fuzz > 0 {
+				notes = append(notes, fmt.Sprintf("fuzz %d", fuzz))
+			}
+			note := ""
+			if len(notes) > 0 {
+				note = fmt.Sprintf("applied at line %d (%s)", pos+1, strings.Join(notes, ", "))
+			}
+			end := pos + len(replacement)
+			shift := (pos - lead) - start + len(replacement) - len(old)
+			return hunkResult{lines: updated, end: end, offset: shift, note: note}, true
+		}
+	}
+
+	old, _ := splitHunk(h.lines)
+	return hunkResult{failure: describeMismatch(lines, old, from, hint)}, false
+}
+
+// trimContext 去掉 hunk 首尾各最多 fuzz 行上下文，并返回开头去掉的行数。只有上下文行会被去掉。
+func trimContext(body []patchLine, fuzz int) ([]patchLine, int, bool) {
+	if fuzz == 0 {
+		return body, 0, true
+	}
+	start, end := 0, len(body)
+	for i := 0; i < fuzz; i++ {
+		if start < end && body[start].kind == ' ' {
+			start++
+		}
+		if end > start && body[end-1].kind == ' ' {
+			end--
+		}
+	}
+	if start == 0 && end == len(body) {
+		return nil, 0, false // 没有可以去掉的上下文，再提高 fuzz 也没有意义
+	}
+	return body[start:end], start, true
+}
+
+// splitHunk 返回 hunk 的旧内容（上下文 + 删除行）和新内容（上下文 + 新增行）。
+func splitHunk(body []patchLine) ([]string, []string) {
+	var old, replacement []string
+	for _, l := range body {
+		if l.kind != '+' {
+			old = append(old, l.text)
+		}
+		if l.kind != '-' {
+			replacement = append(replacement, l.text)
+		}
+	}
+	return old, replacement
+}
+
+// locate 在 lines[from:] 中查找 old，多个位置匹配时选择离 hint 最近的一个。
+func locate(lines, old []string, from, hint int, level matchLevel) (int, bool) {
+	if len(old) == 0 {
+		// 纯插入的 hunk：没有上下文可以对照，只能信任行号
+		return min(max(hint, from), len(lines)), true
+	}
+	best, bestDist := -1, 0
+	for pos := from; pos+len(old) <= len(lines); pos++ {
+		if !linesEqual(lines[pos:pos+len(old)], old, level) {
+			continue
+		}
+		dist := pos - hint
+		if dist < 0 {
+			dist = -dist
+		}
+		if best < 0 || dist < bestDist {
+			best, bestDist = pos, dist
+		}
+	}
+	return best, best >= 0
+}
+
+func linesEqual(a, b []string, level matchLevel) bool {
+	for i := range a {
+		x, y := a[i], b[i]
+		switch level {
+		case matchIgnoreTrailingSpace:
+			x, y = strings.TrimRight(x, " \t\r"), strings.TrimRight(y, " \t\r")
+		case matchIgnoreIndentation:
+			x, y = strings.TrimSpace(x), strings.TrimSpace(y)
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// describeMismatch 找到与 hunk 旧内容吻合最多的位置，指出第一处不一致的行，方便模型修正补丁。
+func describeMismatch(lines, old []string, from, hint int) string {
+	if len(old) == 0 {
+		return "hunk has no context or removed lines"
+	}
+	bestPos, bestLen := -1, -1
+	for pos := from; pos < len(lines); pos++ {
+		n := 0
+		for n < len(old) && pos+n < len(lines) && strings.TrimSpace(lines[pos+n]) == strings.TrimSpace(old[n]) {
+			n++
+		}
+		if n > bestLen || (n == bestLen && abs(pos-hint) < abs(bestPos-hint)) {
+			bestPos, bestLen = pos, n
+		}
+	}
+	if bestLen <= 0 {
+		return fmt.Sprintf("context not found; the first expected line %q does not appear after line %d", old[0], from)
+	}
+	if bestPos+bestLen >= len(lines) {
+		return fmt.Sprintf("context matches from line %d for %d line(s) but the file ends before line %q", bestPos+1, bestLen, old[bestLen])
+	}
+	return fmt.Sprintf("closest match starts at line %d; line %d differs: expected %q, found %q",
+		bestPos+1, bestPos+bestLen+1, old[bestLen], lines[bestPos+bestLen])
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// commitPatch 依次写入所有变更；任何一步失败时，把已经写入的文件恢复原状。
+func commitPatch(env Env, changes []*fileChange) error {
+	var applied []*fileChange
+	rollback := func() {
+		for i := len(applied) - 1; i >= 0; i-- {
+			c := applied[i]
+			if c.newPath != "" && c.newPath != c.oldPath {
+				_ = removeLocalFile(env, c.newPath)
+			}
+			if c.oldPath != "" {
+				_ = createFileMode(env, c.oldPath, c.oldContent, c.mode)
+			}
+		}
+	}
+
+	for _, c := range changes {
+		var err error
+		if c.newPath != "" {
+			err = createFileMode(env, c.newPath, c.newContent, c.mode)
+		}
+		if err == nil && c.oldPath != "" && (c.delete || c.oldPath != c.newPath) {
+			err = removeLocalFile(env, c.oldPath)
+		}
+		if err != nil {
+			applied = append(applied, c)
+			rollback()
+			return fmt.Errorf("%s: %w", c.displayPath(), err)
+		}
+		applied = append(applied, c)
+	}
+	return nil
+}
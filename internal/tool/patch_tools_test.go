@@ -0,0 +1,410 @@
+// internal/tool/patch_tools_test.go
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRegistry 返回一个以临时目录为工作区的内置工具注册表，files 是工作区中的初始文件。
+func newTestRegistry(t *testing.T, files map[string]string) (*Registry, string) {
+	t.Helper()
+	ws, _ := newTestWorkspace(t)
+	for name, content := range files {
+		path := filepath.Join(ws.Root(), name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewBuiltinRegistry()
+	r.SetWorkspace(ws)
+	return r, ws.Root()
+}
+
+// execute 以 args 调用工具 name。
+func execute(t *testing.T, r *Registry, name string, args map[string]any) (Result, error) {
+	t.Helper()
+	data, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.Execute(context.Background(), Env{}, name, string(data))
+}
+
+func readFile(t *testing.T, root, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParsePatch(t *testing.T) {
+	patch := strings.Join([]string{
+		"diff --git a/old.go b/new.go",
+		"similarity index 90%",
+		"rename from old.go",
+		"rename to new.go",
+		"--- a/old.go",
+		"+++ b/new.go",
+		"@@ -1,3 +1,3 @@",
+		" package main",
+		"",
+		"-var x = 1",
+		"+var x = 2",
+		"--- /dev/null",
+		"+++ b/added.txt\t2024-01-01 00:00:00",
+		"@@ -0,0 +1 @@",
+		"+hello",
+		"\\ No newline at end of file",
+		"diff --git a/gone.txt b/gone.txt",
+		"deleted file mode 100644",
+		"--- a/gone.txt",
+		"+++ /dev/null",
+		"@@ -1 +0,0 @@",
+		"-bye",
+		"",
+	}, "\r\n")
+	files, err := parsePatch(patch)
+	if err != nil {
+		t.Fatalf("parsePatch: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3", len(files))
+	}
+
+	rename := files[0]
+	if rename.oldPath != "old.go" || rename.newPath != "new.go" || len(rename.hunks) != 1 {
+		t.Fatalf("rename = %+v", rename)
+	}
+	var kinds []string
+	for _, l := range rename.hunks[0].lines {
+		kinds = append(kinds, string(l.kind)+l.text)
+	}
+	// 丢失了前导空格的空上下文行仍然被视为上下文
+	if want := []string{" package main", " ", "-var x = 1", "+var x = 2"}; strings.Join(kinds, "|") != strings.Join(want, "|") {
+		t.Errorf("hunk lines = %q, want %q", kinds, want)
+	}
+
+	added := files[1]
+	if added.oldPath != devNull || added.newPath != "added.txt" || !added.hunks[0].newNoNewline {
+		t.Errorf("added = %+v, hunk = %+v", added, added.hunks[0])
+	}
+	if gone := files[2]; gone.oldPath != "gone.txt" || gone.newPath != devNull {
+		t.Errorf("deleted = %+v", gone)
+	}
+}
+
+func TestParsePatchErrors(t *testing.T) {
+	tests := map[string]string{
+		"no headers":         "just some text\n",
+		"hunk before header": "@@ -1 +1 @@\n-a\n+b\n",
+		"malformed hunk":     "--- a/x\n+++ b/x\n@@ bad @@\n",
+		"no hunks":           "--- a/x\n+++ b/x\n",
+		"dev null twice":     "--- /dev/null\n+++ /dev/null\n@@ -0,0 +1 @@\n+a\n",
+	}
+	for name, patch := range tests {
+		t.Run(name, func(t *testing.T) {
+			if files, err := parsePatch(patch); err == nil {
+				t.Errorf("parsePatch(%q) = %+v, want an error", patch, files)
+			}
+		})
+	}
+}
+
+func TestApplyHunk(t *testing.T) {
+	file := []string{
+		"package main",
+		"",
+		"func a() {",
+		"\treturn 1",
+		"}",
+		"",
+		"func b() {",
+		"\treturn 2   ",
+		"}",
+	}
+	tests := []struct {
+		name     string
+		hunk     string
+		want     []string // 应用后的行，为 nil 表示应当失败
+		wantNote string
+	}{
+		{
+			name: "exact",
+			hunk: "@@ -3,3 +3,3 @@\n func a() {\n-\treturn 1\n+\treturn 10\n }\n",
+			want: replaceAt(file, 3, "\treturn 10"),
+		},
+		{
+			name:     "wrong line numbers",
+			hunk:     "@@ -40,3 +40,3 @@\n func a() {\n-\treturn 1\n+\treturn 10\n }\n",
+			want:     replaceAt(file, 3, "\treturn 10"),
+			wantNote: "offset",
+		},
+		{
+			name:     "trailing whitespace",
+			hunk:     "@@ -7,3 +7,3 @@\n func b() {\n-\treturn 2\n+\treturn 20\n }\n",
+			want:     replaceAt(file, 7, "\treturn 20"),
+			wantNote: "ignoring trailing whitespace",
+		},
+		{
+			name:     "indentation",
+			hunk:     "@@ -3,3 +3,3 @@\n func a() {\n-    return 1\n+\treturn 10\n }\n",
+			want:     replaceAt(file, 3, "\treturn 10"),
+			wantNote: "ignoring indentation",
+		},
+		{
+			name:     "fuzz 1",
+			hunk:     "@@ -2,5 +2,5 @@\n // stale comment\n func a() {\n-\treturn 1\n+\treturn 10\n }\n",
+			want:     replaceAt(file, 3, "\treturn 10"),
+			wantNote: "fuzz 1",
+		},
+		{
+			name:     "fuzz 2",
+			hunk:     "@@ -1,7 +1,7 @@\n // one\n // two\n func a() {\n-\treturn 1\n+\treturn 10\n }\n // three\n // four\n",
+			want:     replaceAt(file, 3, "\treturn 10"),
+			wantNote: "fuzz 2",
+		},
+		{
+			name: "too much fuzz",
+			hunk: "@@ -1,7 +1,7 @@\n // one\n // two\n // three\n func a() {\n-\treturn 1\n+\treturn 10\n }\n",
+		},
+		{
+			name: "removed line does not match",
+			hunk: "@@ -3,3 +3,3 @@\n func a() {\n-\treturn 3\n+\treturn 10\n }\n",
+		},
+		{
+			name: "pure insertion trusts the line number",
+			hunk: "@@ -5,0 +6,2 @@\n+\n+// c is new\n",
+			want: append(append(append([]string{}, file[:5]...), "", "// c is new"), file[5:]...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parsePatch("--- a/main.go\n+++ b/main.go\n" + tt.hunk)
+			if err != nil {
+				t.Fatalf("parsePatch: %v", err)
+			}
+			result, ok := applyHunk(file, files[0].hunks[0], 0, 0)
+			if tt.want == nil {
+				if ok {
+					t.Errorf("applyHunk succeeded with %q, want a failure", result.lines)
+				} else if result.failure == "" {
+					t.Error("failure has no description")
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("applyHunk failed: %s", result.failure)
+			}
+			if strings.Join(result.lines, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("lines = %q\nwant   %q", result.lines, tt.want)
+			}
+			if !strings.Contains(result.note, tt.wantNote) || (tt.wantNote == "" && result.note != "") {
+				t.Errorf("note = %q, want it to mention %q", result.note, tt.wantNote)
+			}
+		})
+	}
+}
+
+// replaceAt 返回把 lines[i] 替换为 text 后的副本。
+func replaceAt(lines []string, i int, text string) []string {
+	out := append([]string{}, lines...)
+	out[i] = text
+	return out
+}
+
+func TestApplyPatchTool(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{
+		"crlf.txt":   "one\r\ntwo\r\nthree\r\n",
+		"old.go":     "package old\n",
+		"gone.txt":   "bye\n",
+		"nonl.txt":   "a\nb",
+		"keep/x.txt": "x\n",
+	})
+	patch := `--- a/crlf.txt
++++ b/crlf.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+diff --git a/old.go b/new.go
+rename from old.go
+rename to new.go
+--- /dev/null
++++ b/created/file.txt
+@@ -0,0 +1,2 @@
++first
++second
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+--- a/nonl.txt
++++ b/nonl.txt
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+`
+	result, err := execute(t, r, "apply_patch", map[string]any{"patch": patch})
+	if err != nil {
+		t.Fatalf("apply_patch: %v", err)
+	}
+	if result.Diff == "" {
+		t.Error("result has no diff")
+	}
+
+	if got := readFile(t, root, "crlf.txt"); got != "one\r\nTWO\r\nthree\r\n" {
+		t.Errorf("crlf.txt = %q", got)
+	}
+	if got := readFile(t, root, "new.go"); got != "package old\n" {
+		t.Errorf("new.go = %q", got)
+	}
+	if got := readFile(t, root, "created/file.txt"); got != "first\nsecond\n" {
+		t.Errorf("created/file.txt = %q", got)
+	}
+	if got := readFile(t, root, "nonl.txt"); got != "a\nc\n" {
+		t.Errorf("nonl.txt = %q", got)
+	}
+	for _, name := range []string{"old.go", "gone.txt"} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", name, err)
+		}
+	}
+}
+
+func TestApplyPatchToolIsAtomic(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-a
++A
+--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-not b
++B
+--- a/../outside.txt
++++ b/../outside.txt
+@@ -1 +1 @@
+-x
++y
+`
+	_, err := execute(t, r, "apply_patch", map[string]any{"patch": patch})
+	if err == nil {
+		t.Fatal("apply_patch succeeded, want an error")
+	}
+	for _, want := range []string{"no files were changed", "b.txt: hunk #1", "outside.txt"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if got := readFile(t, root, "a.txt"); got != "a\n" {
+		t.Errorf("a.txt = %q, want it unchanged", got)
+	}
+}
+
+func TestApplyPatchKeepsFileModes(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{"run.sh": "echo one\n", "build.sh": "echo build\n"})
+	for _, name := range []string{"run.sh", "build.sh"} {
+		if err := os.Chmod(filepath.Join(root, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	patch := `diff --git a/run.sh b/scripts/run.sh
+rename from run.sh
+rename to scripts/run.sh
+--- a/run.sh
++++ b/scripts/run.sh
+@@ -1 +1 @@
+-echo one
++echo two
+--- a/build.sh
++++ b/build.sh
+@@ -1 +1 @@
+-echo build
++echo rebuild
+`
+	if _, err := execute(t, r, "apply_patch", map[string]any{"patch": patch}); err != nil {
+		t.Fatalf("apply_patch: %v", err)
+	}
+	for _, name := range []string{"scripts/run.sh", "build.sh"} {
+		info, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o755 {
+			t.Errorf("%s mode = %v, want %v", name, info.Mode().Perm(), os.FileMode(0o755))
+		}
+	}
+}
+
+func TestApplyPatchRejectsRepeatedFiles(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{"a.txt": "one\ntwo\n"})
+	// 两个小节都从磁盘上的原始内容开始计算，第二个小节会悄悄丢掉第一个的修改
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-one
++ONE
+--- a/a.txt
++++ b/a.txt
+@@ -2 +2 @@
+-two
++TWO
+`
+	_, err := execute(t, r, "apply_patch", map[string]any{"patch": patch})
+	if err == nil || !strings.Contains(err.Error(), "a.txt: appears in more than one file section") {
+		t.Fatalf("apply_patch error = %v, want a repeated file error", err)
+	}
+	if got := readFile(t, root, "a.txt"); got != "one\ntwo\n" {
+		t.Errorf("a.txt = %q, want it unchanged", got)
+	}
+
+	// 在另一个小节中修改重命名后的路径同样会被拒绝
+	patch = "diff --git a/a.txt b/b.txt\nrename from a.txt\nrename to b.txt\n--- a/b.txt\n+++ b/b.txt\n@@ -1 +1 @@\n-one\n+ONE\n"
+	_, err = execute(t, r, "apply_patch", map[string]any{"patch": patch})
+	if err == nil || !strings.Contains(err.Error(), "b.txt: appears in more than one file section") {
+		t.Errorf("apply_patch error = %v, want a repeated file error", err)
+	}
+}
+
+// FuzzParsePatch 检查任意输入都不会使解析和应用补丁 panic。
+func FuzzParsePatch(f *testing.F) {
+	f.Add("--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n", "a\nb\n")
+	f.Add("--- /dev/null\n+++ b/x\n@@ -0,0 +1 @@\n+a\n\\ No newline at end of file\n", "")
+	f.Add("diff --git a/x b/y\nrename from x\nrename to y\n", "x\n")
+	f.Add("--- a/x\n+++ b/x\n@@ -100 +100 @@\n\n-\n+\n@@ -1 +1 @@\n", "\n\n\n")
+	f.Fuzz(func(t *testing.T, patch, content string) {
+		files, err := parsePatch(patch)
+		if err != nil {
+			return
+		}
+		lines := splitLines(content)
+		for _, fp := range files {
+			from, offset := 0, 0
+			for _, h := range fp.hunks {
+				result, ok := applyHunk(lines, h, from, offset)
+				if !ok {
+					continue
+				}
+				if result.end < 0 || result.end > len(result.lines) {
+					t.Fatalf("hunk end %d is outside the %d result lines", result.end, len(result.lines))
+				}
+				lines, from, offset = result.lines, result.end, result.offset
+			}
+		}
+	})
+}
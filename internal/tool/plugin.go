@@ -0,0 +1,351 @@
+// internal/tool/plugin.go
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/synapse/internal/llm"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// pluginManifestName 是插件目录中清单文件的文件名
+	pluginManifestName = "tool.yaml"
+	// maxPluginOutputBytes 是从插件 stdout 读取的最大字节数，超出时 JSON 输出会被拒绝
+	maxPluginOutputBytes = 1024 * 1024
+)
+
+// pluginNamePattern 与 OpenAI 对函数名的要求一致
+var pluginNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// PluginManifest 描述一个外部可执行插件。每个插件是插件目录下的一个子目录，
+// 其中包含 tool.yaml 清单和一个可执行文件，例如：
+//
+//	~/.synapse/tools/jira_issue/tool.yaml
+//	~/.synapse/tools/jira_issue/run.py
+//
+// 插件在工作区根目录中运行，从 stdin 读取 JSON 格式的参数，把结果写到 stdout。
+// output 为 "json" 时，stdout 必须是 {"text", "summary", "meta", "diff", "error"} 形式的对象，且不超过 1 MiB；
+// 否则整个 stdout 作为结果文本。非零退出码表示调用失败，stderr 会作为错误信息返回。
+type PluginManifest struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Command     string   `yaml:"command"` // 可执行文件，相对于清单所在目录
+	Args        []string `yaml:"args"`    // 传给可执行文件的固定参数
+	// Parameters 是参数的 JSON Schema，为空时工具不接受参数
+	Parameters map[string]any `yaml:"parameters"`
+	// Access 是 "read-only"、"mutating" 或 "destructive"，默认为 "mutating"
+	Access         string `yaml:"access"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // 0 表示使用注册表的默认超时
+	Output         string `yaml:"output"`          // "text"（默认）或 "json"
+	// PathArgs 是参数中表示路径的字段。它们与内置工具一样被限制在工作区内，
+	// 在传给插件之前被解析为绝对路径，并用于并发调度。
+	PathArgs []string `yaml:"path_args"`
+
+	dir string
+}
+
+// pluginOutput 是 output 为 "json" 时插件写到 stdout 的结果。
+type pluginOutput struct {
+	Text    string         `json:"text"`
+	Summary string         `json:"summary"`
+	Meta    map[string]any `json:"meta"`
+	Diff    string         `json:"diff"`
+	Error   string         `json:"error"`
+}
+
+// DefaultPluginDirs 返回默认的用户插件目录 ~/.synapse/tools。
+func DefaultPluginDirs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(home, ".synapse", "tools")}
+}
+
+// WorkspacePluginDir 返回工作区中的插件目录 .synapse/tools。
+// 其中的插件来自仓库而不是用户，只应在用户明确信任时通过 LoadUntrustedPlugins 加载。
+func WorkspacePluginDir(workspaceRoot string) string {
+	return filepath.Join(workspaceRoot, ".synapse", "tools")
+}
+
+// LoadPlugins 从用户信任的目录 dirs 中加载插件并注册到 r，返回成功加载的工具名称。
+// 不存在的目录会被跳过；单个插件出错不影响其他插件，所有错误被合并返回。
+// 与已注册工具同名的插件会加载失败，因此先加载的目录优先。
+func (r *Registry) LoadPlugins(dirs []string) ([]string, error) {
+	return r.loadPlugins(dirs, true)
+}
+
+// LoadUntrustedPlugins 与 LoadPlugins 相同，但 dirs 中的插件（例如仓库中的 .synapse/tools）
+// 不能把自己声明为只读：它们至少被视为 mutating，执行前总是需要用户确认。
+func (r *Registry) LoadUntrustedPlugins(dirs []string) ([]string, error) {
+	return r.loadPlugins(dirs, false)
+}
+
+func (r *Registry) loadPlugins(dirs []string, trusted bool) ([]string, error) {
+	var (
+		loaded []string
+		errs   []error
+	)
+	for _, dir := range dirs {
+		dir = expandHome(dir)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("error reading plugin directory '%s': %w", dir, err))
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			manifestPath := filepath.Join(dir, entry.Name(), pluginManifestName)
+			if _, err := os.Stat(manifestPath); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			manifest, err := readPluginManifest(manifestPath)
+			if err == nil {
+				err = r.registerPlugin(manifest, trusted)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("plugin '%s': %w", manifestPath, err))
+				continue
+			}
+			loaded = append(loaded, manifest.Name)
+		}
+	}
+	return loaded, errors.Join(errs...)
+}
+
+// readPluginManifest 读取并检查一个插件清单。
+func readPluginManifest(path string) (*PluginManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m PluginManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	m.dir = filepath.Dir(path)
+
+	if !pluginNamePattern.MatchString(m.Name) {
+		return nil, fmt.Errorf("invalid tool name '%s': use 1-64 letters, digits, '_' or '-'", m.Name)
+	}
+	if m.Description == "" {
+		return nil, errors.New("description is required")
+	}
+	if m.Command == "" {
+		return nil, errors.New("command is required")
+	}
+	if _, err := parseAccess(m.Access); err != nil {
+		return nil, err
+	}
+	switch m.Output {
+	case "", "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid output '%s': expected text or json", m.Output)
+	}
+	if m.TimeoutSeconds < 0 {
+		return nil, errors.New("timeout_seconds must not be negative")
+	}
+	info, err := os.Stat(m.executable())
+	if err != nil {
+		return nil, fmt.Errorf("command not found: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("command '%s' is a directory", m.Command)
+	}
+	return &m, nil
+}
+
+// executable 返回插件可执行文件的路径。
+func (m *PluginManifest) executable() string {
+	command := expandHome(m.Command)
+	if filepath.IsAbs(command) {
+		return command
+	}
+	return filepath.Join(m.dir, command)
+}
+
+func parseAccess(s string) (Access, error) {
+	switch s {
+	case "", AccessMutating.String():
+		return AccessMutating, nil
+	case AccessReadOnly.String():
+		return AccessReadOnly, nil
+	case AccessDestructive.String():
+		return AccessDestructive, nil
+	default:
+		return 0, fmt.Errorf("invalid access '%s': expected read-only, mutating or destructive", s)
+	}
+}
+
+// registerPlugin 把插件注册为 r 中的一个工具。不受信任的插件的访问级别至少为 mutating。
+func (r *Registry) registerPlugin(m *PluginManifest, trusted bool) error {
+	params := m.Parameters
+	if params == nil {
+		params = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("invalid parameters: %w", err)
+	}
+	access, _ := parseAccess(m.Access)
+	if !trusted {
+		access = max(access, AccessMutating)
+	}
+
+	def := llm.Tool{
+		Name:        m.Name,
+		Description: m.Description,
+		Parameters:  json.RawMessage(data),
+	}
+	if err := r.Register(def, m.run, access); err != nil {
+		return err
+	}
+	if len(m.PathArgs) > 0 {
+		if err := r.RegisterTargets(m.Name, m.targets); err != nil {
+			return err
+		}
+	}
+	if m.TimeoutSeconds > 0 {
+		return r.SetTimeout(m.Name, time.Duration(m.TimeoutSeconds)*time.Second)
+	}
+	return nil
+}
+
+// run 执行插件：参数写入 stdin，结果从 stdout 读取。
+func (m *PluginManifest) run(ctx context.Context, env Env, arguments string) (Result, error) {
+	input, err := m.resolvePathArgs(env, arguments)
+	if err != nil {
+		return Result{}, err
+	}
+
+	cmd := exec.CommandContext(ctx, m.executable(), m.Args...)
+	cmd.Dir = env.WorkspaceRoot
+	cmd.Env = append(commandEnv(env.commands.HiddenEnv),
+		"SYNAPSE_TOOL_NAME="+m.Name,
+		"SYNAPSE_WORKSPACE_ROOT="+env.WorkspaceRoot,
+		"SYNAPSE_SESSION_ID="+env.SessionID,
+	)
+	cmd.Stdin = strings.NewReader(input)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = commandWaitDelay
+
+	stdout := newCappedBuffer(maxPluginOutputBytes)
+	stderr := newCappedBuffer(defaultCommandOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	runErr := cmd.Run()
+	duration := time.Since(start).Round(time.Millisecond)
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, fmt.Errorf("plugin tool '%s' was killed: %w", m.Name, err)
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(runErr, &exitErr):
+		return Result{}, fmt.Errorf("plugin tool '%s' exited with code %d: %s", m.Name, exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+	case runErr != nil:
+		return Result{}, fmt.Errorf("error running plugin tool '%s': %w", m.Name, runErr)
+	}
+	if stderr.total > 0 {
+		env.Logger.Printf("plugin tool '%s' stderr: %s", m.Name, strings.TrimSpace(stderr.String()))
+	}
+
+	result := Result{Text: stdout.String()}
+	if m.Output == "json" {
+		// 截断后的 JSON 无法解析，超出上限时直接报告
+		if stdout.total > maxPluginOutputBytes {
+			return Result{}, fmt.Errorf("plugin tool '%s' wrote %d bytes of JSON output, more than the limit of %d bytes", m.Name, stdout.total, maxPluginOutputBytes)
+		}
+		var out pluginOutput
+		if err := json.Unmarshal([]byte(result.Text), &out); err != nil {
+			return Result{}, fmt.Errorf("plugin tool '%s' returned invalid JSON output: %w", m.Name, err)
+		}
+		if out.Error != "" {
+			return Result{}, fmt.Errorf("plugin tool '%s' failed: %s", m.Name, out.Error)
+		}
+		result = Result{Text: out.Text, Summary: out.Summary, Meta: out.Meta, Diff: out.Diff}
+	}
+	if result.Summary == "" {
+		result.Summary = fmt.Sprintf("%s finished in %s", m.Name, duration)
+	}
+	return result.SetMeta("duration_ms", duration.Milliseconds()), nil
+}
+
+// resolvePathArgs 把 path_args 中声明的参数解析为工作区内的绝对路径，
+// 拒绝逃逸出工作区的路径。返回传给插件的参数。
+func (m *PluginManifest) resolvePathArgs(env Env, arguments string) (string, error) {
+	if len(m.PathArgs) == 0 {
+		return arguments, nil
+	}
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments for %s: %w", m.Name, err)
+	}
+	for _, name := range m.PathArgs {
+		switch v := args[name].(type) {
+		case string:
+			resolved, err := env.resolve(v)
+			if err != nil {
+				return "", err
+			}
+			args[name] = resolved
+		case []any:
+			for i, item := range v {
+				p, ok := item.(string)
+				if !ok {
+					continue
+				}
+				resolved, err := env.resolve(p)
+				if err != nil {
+					return "", err
+				}
+				v[i] = resolved
+			}
+		}
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// targets 返回 path_args 中声明的路径，用于并发调度。
+func (m *PluginManifest) targets(arguments string) []string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return nil
+	}
+	var paths []string
+	for _, name := range m.PathArgs {
+		switch v := args[name].(type) {
+		case string:
+			paths = append(paths, v)
+		case []any:
+			for _, item := range v {
+				if p, ok := item.(string); ok {
+					paths = append(paths, p)
+				}
+			}
+		}
+	}
+	return paths
+}
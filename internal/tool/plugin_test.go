@@ -0,0 +1,206 @@
+// internal/tool/plugin_test.go
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePlugin 在 dir 下创建插件目录 name，写入清单和可执行的 shell 脚本 run.sh。
+func writePlugin(t *testing.T, dir, name, manifest, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin tests use shell scripts")
+	}
+	pluginDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(pluginDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pluginDir, pluginManifestName), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if script != "" {
+		if err := os.WriteFile(filepath.Join(pluginDir, "run.sh"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "echo", `
+name: echo_args
+description: Echo the arguments
+command: run.sh
+access: read-only
+parameters:
+  type: object
+  properties:
+    text: {type: string}
+  required: [text]
+`, `printf 'args=%s cwd=%s tool=%s' "$(cat)" "$(pwd)" "$SYNAPSE_TOOL_NAME"`)
+	writePlugin(t, dir, "bad_name", "name: 'bad name'\ndescription: x\ncommand: run.sh\n", "true")
+	writePlugin(t, dir, "no_description", "name: no_description\ncommand: run.sh\n", "true")
+	writePlugin(t, dir, "no_command", "name: no_command\ndescription: x\ncommand: missing.sh\n", "")
+	writePlugin(t, dir, "bad_access", "name: bad_access\ndescription: x\ncommand: run.sh\naccess: admin\n", "true")
+	writePlugin(t, dir, "bad_output", "name: bad_output\ndescription: x\ncommand: run.sh\noutput: xml\n", "true")
+	writePlugin(t, dir, "shadow", "name: read_file\ndescription: x\ncommand: run.sh\n", "true")
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, root := newTestRegistry(t, nil)
+	loaded, err := r.LoadPlugins([]string{dir, filepath.Join(dir, "does-not-exist")})
+	// 出错的插件不影响其他插件，所有错误被一起报告
+	if len(loaded) != 1 || loaded[0] != "echo_args" {
+		t.Errorf("loaded = %q, want only echo_args", loaded)
+	}
+	for _, want := range []string{
+		"invalid tool name 'bad name'",
+		"description is required",
+		"command not found",
+		"invalid access 'admin'",
+		"invalid output 'xml'",
+		"tool read_file is already registered",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadPlugins error = %v, want it to contain %q", err, want)
+		}
+	}
+
+	if r.Access("echo_args") != AccessReadOnly {
+		t.Errorf("Access(echo_args) = %v, want read-only", r.Access("echo_args"))
+	}
+	result, err := execute(t, r, "echo_args", map[string]any{"text": "hi"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if want := `args={"text":"hi"} cwd=` + root + " tool=echo_args"; result.Text != want {
+		t.Errorf("result = %q, want %q", result.Text, want)
+	}
+	// 参数按清单中的 schema 校验
+	if _, err := execute(t, r, "echo_args", map[string]any{}); err == nil || !strings.Contains(err.Error(), "text: missing required field") {
+		t.Errorf("Execute without the required argument error = %v", err)
+	}
+}
+
+func TestUntrustedPluginsAreNotReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "reader", "name: reader\ndescription: x\ncommand: run.sh\naccess: read-only\n", "true")
+	writePlugin(t, dir, "deleter", "name: deleter\ndescription: x\ncommand: run.sh\naccess: destructive\n", "true")
+
+	r := NewRegistry()
+	if _, err := r.LoadUntrustedPlugins([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Access("reader"); got != AccessMutating {
+		t.Errorf("Access(reader) = %v, want mutating", got)
+	}
+	if got := r.Access("deleter"); got != AccessDestructive {
+		t.Errorf("Access(deleter) = %v, want destructive", got)
+	}
+}
+
+func TestPluginRun(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "json", "name: json_tool\ndescription: x\ncommand: run.sh\noutput: json\n",
+		`echo '{"text": "result text", "summary": "did it", "meta": {"n": 1}}'`)
+	writePlugin(t, dir, "json_error", "name: json_error\ndescription: x\ncommand: run.sh\noutput: json\n",
+		`echo '{"error": "no such issue"}'`)
+	writePlugin(t, dir, "bad_json", "name: bad_json\ndescription: x\ncommand: run.sh\noutput: json\n",
+		`echo 'not json'`)
+	writePlugin(t, dir, "huge_json", "name: huge_json\ndescription: x\ncommand: run.sh\noutput: json\n",
+		`printf '{"text": "'; head -c 1100000 /dev/zero | tr '\0' x; printf '"}'`)
+	writePlugin(t, dir, "fails", "name: fails\ndescription: x\ncommand: run.sh\n",
+		`echo 'something broke' >&2; exit 3`)
+	writePlugin(t, dir, "slow", "name: slow\ndescription: x\ncommand: run.sh\ntimeout_seconds: 1\n",
+		`sleep 30`)
+
+	r, _ := newTestRegistry(t, nil)
+	if _, err := r.LoadPlugins([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := execute(t, r, "json_tool", map[string]any{})
+	if err != nil || result.Text != "result text" || result.Summary != "did it" || result.Meta["n"] != float64(1) || result.Meta["duration_ms"] == nil {
+		t.Errorf("json_tool = %+v, %v", result, err)
+	}
+	for name, wantErr := range map[string]string{
+		"json_error": "plugin tool 'json_error' failed: no such issue",
+		"bad_json":   "returned invalid JSON output",
+		"huge_json":  "more than the limit of 1048576 bytes",
+		"fails":      "plugin tool 'fails' exited with code 3: something broke",
+	} {
+		if _, err := execute(t, r, name, map[string]any{}); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s error = %v, want %q", name, err, wantErr)
+		}
+	}
+
+	if got := r.Timeout("slow"); got != time.Second {
+		t.Errorf("Timeout(slow) = %v, want 1s", got)
+	}
+	start := time.Now()
+	if _, err := execute(t, r, "slow", map[string]any{}); err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("slow error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the plugin was not killed at its timeout (took %s)", elapsed)
+	}
+
+	// 调用方取消时插件被终止
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r.SetTimeout("slow", NoTimeout)
+	if _, err := r.Execute(ctx, Env{}, "slow", "{}"); err == nil || !strings.Contains(err.Error(), "was killed") {
+		t.Errorf("cancelled slow error = %v", err)
+	}
+}
+
+func TestPluginPathArgs(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "paths", `
+name: lint
+description: Lint files
+command: run.sh
+access: read-only
+path_args: [file, files]
+parameters:
+  type: object
+  properties:
+    file: {type: string}
+    files: {type: array, items: {type: string}}
+`, `cat`)
+	r, root := newTestRegistry(t, nil)
+	if _, err := r.LoadPlugins([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 路径参数在传给插件前被解析为工作区内的绝对路径
+	result, err := execute(t, r, "lint", map[string]any{"file": "a.go", "files": []string{"src/b.go", "c.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a.go", "src/b.go", "c.go"} {
+		if !strings.Contains(result.Text, `"`+filepath.Join(root, p)+`"`) {
+			t.Errorf("plugin input %s does not contain the absolute path of %s", result.Text, p)
+		}
+	}
+	for _, args := range []map[string]any{
+		{"file": "../outside/x"},
+		{"files": []string{"ok.go", "/etc/passwd"}},
+	} {
+		if _, err := execute(t, r, "lint", args); err == nil {
+			t.Errorf("lint(%v) reached outside the workspace", args)
+		}
+	}
+
+	got := r.Targets("lint", `{"file": "a.go", "files": ["b.go"]}`)
+	if len(got) != 2 || got[0] != filepath.Join(root, "a.go") || got[1] != filepath.Join(root, "b.go") {
+		t.Errorf("Targets = %q", got)
+	}
+}
@@ -0,0 +1,238 @@
+// internal/tool/policy.go
+package tool
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Approval 描述策略对一个工具审批方式的要求。
+type Approval int
+
+const (
+	// ApprovalDefault 表示按工具的访问级别决定是否需要确认。
+	ApprovalDefault Approval = iota
+	// ApprovalAuto 表示无需确认即可执行。
+	ApprovalAuto
+	// ApprovalConfirm 表示每次执行前都需要确认（包括只读工具），不能在会话范围内自动放行。
+	ApprovalConfirm
+)
+
+// Untargeted 决定路径规则如何对待无法声明访问路径的工具，
+// 例如 run_command、MCP 工具和没有 path_args 的插件。
+type Untargeted string
+
+const (
+	// UntargetedAllow 是默认值：Deny 模式无法检查这些工具，它们不受路径规则约束。
+	UntargetedAllow Untargeted = ""
+	// UntargetedConfirm 要求这些工具每次执行前都经过确认。
+	UntargetedConfirm Untargeted = "confirm"
+	// UntargetedDeny 禁止执行这些工具。
+	UntargetedDeny Untargeted = "deny"
+)
+
+// PathRule 禁止匹配的工具访问某些路径。
+// Deny 只对声明了访问路径（TargetsFunc）的工具生效，其他匹配的工具由 Untargeted 决定。
+type PathRule struct {
+	Tools      []string   // 工具名模式（path.Match 语法，例如 "github__*"），为空表示所有工具
+	Deny       []string   // 相对于工作区根目录的 glob 模式，支持 "**"；以 "/" 结尾表示整个目录
+	Untargeted Untargeted // 匹配的工具没有声明访问路径时的处理方式
+}
+
+// Policy 是用户配置的工具策略。工具名列表都支持 path.Match 风格的通配符。
+// Disabled 优先于 Enabled，RequireConfirm 优先于 AutoApprove。
+type Policy struct {
+	Enabled        []string // 非空时只启用匹配的工具
+	Disabled       []string // 禁用的工具：既不向模型公开，也不能被执行
+	AutoApprove    []string // 无需确认即可执行的工具
+	RequireConfirm []string // 每次执行前都需要确认的工具
+	Paths          []PathRule
+}
+
+// Merge 返回同时包含 p 和 other 中所有规则的策略。
+func (p Policy) Merge(other Policy) Policy {
+	return Policy{
+		Enabled:        slices.Concat(p.Enabled, other.Enabled),
+		Disabled:       slices.Concat(p.Disabled, other.Disabled),
+		AutoApprove:    slices.Concat(p.AutoApprove, other.AutoApprove),
+		RequireConfirm: slices.Concat(p.RequireConfirm, other.RequireConfirm),
+		Paths:          slices.Concat(p.Paths, other.Paths),
+	}
+}
+
+// validate 检查策略中的模式是否合法。
+func (p Policy) validate() error {
+	for _, patterns := range [][]string{p.Enabled, p.Disabled, p.AutoApprove, p.RequireConfirm} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid tool pattern '%s': %w", pattern, err)
+			}
+		}
+	}
+	for _, rule := range p.Paths {
+		for _, pattern := range rule.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid tool pattern '%s': %w", pattern, err)
+			}
+		}
+		for _, pattern := range rule.Deny {
+			if !doublestar.ValidatePattern(pathPattern(pattern)) {
+				return fmt.Errorf("invalid path pattern '%s'", pattern)
+			}
+		}
+		switch rule.Untargeted {
+		case UntargetedAllow, UntargetedConfirm, UntargetedDeny:
+		default:
+			return fmt.Errorf("invalid untargeted action '%s' (expected confirm or deny)", rule.Untargeted)
+		}
+	}
+	return nil
+}
+
+// allows 判断策略是否启用了工具 name。
+func (p Policy) allows(name string) bool {
+	if matchesAny(p.Disabled, name) {
+		return false
+	}
+	return len(p.Enabled) == 0 || matchesAny(p.Enabled, name)
+}
+
+func (p Policy) approval(name string) Approval {
+	switch {
+	case matchesAny(p.RequireConfirm, name):
+		return ApprovalConfirm
+	case matchesAny(p.AutoApprove, name):
+		return ApprovalAuto
+	default:
+		return ApprovalDefault
+	}
+}
+
+// untargeted 返回匹配工具 name 的路径规则中最严格的 Untargeted。
+func (p Policy) untargeted(name string) Untargeted {
+	result := UntargetedAllow
+	for _, rule := range p.Paths {
+		if len(rule.Tools) > 0 && !matchesAny(rule.Tools, name) {
+			continue
+		}
+		switch rule.Untargeted {
+		case UntargetedDeny:
+			return UntargetedDeny
+		case UntargetedConfirm:
+			result = UntargetedConfirm
+		}
+	}
+	return result
+}
+
+// restrictsPaths 判断是否有带 Deny 模式的路径规则适用于工具 name。
+func (p Policy) restrictsPaths(name string) bool {
+	return slices.ContainsFunc(p.Paths, func(rule PathRule) bool {
+		return len(rule.Deny) > 0 && (len(rule.Tools) == 0 || matchesAny(rule.Tools, name))
+	})
+}
+
+// deniedPath 检查工具 name 是否可以访问相对路径 rel。被拒绝时返回匹配的模式。
+// 路径的任何一级父目录匹配也会被拒绝，因此 ".git" 同时禁止了 ".git/config"。
+func (p Policy) deniedPath(name, rel string) (string, bool) {
+	rel = filepath.ToSlash(rel)
+	for _, rule := range p.Paths {
+		if len(rule.Tools) > 0 && !matchesAny(rule.Tools, name) {
+			continue
+		}
+		for _, pattern := range rule.Deny {
+			for candidate := rel; candidate != "." && candidate != "/" && candidate != ""; candidate = path.Dir(candidate) {
+				if ok, _ := doublestar.Match(pathPattern(pattern), candidate); ok {
+					return pattern, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// SetPolicy 设置注册表的工具策略，替换之前的策略。
+func (r *Registry) SetPolicy(p Policy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = p
+	return nil
+}
+
+// Approval 返回策略对工具审批方式的要求。没有声明访问路径的工具
+// 在路径规则要求确认时总是需要确认，即使它被列在 AutoApprove 中。
+func (r *Registry) Approval(name string) Approval {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.declaresTargets(name) && r.policy.untargeted(name) == UntargetedConfirm {
+		return ApprovalConfirm
+	}
+	return r.policy.approval(name)
+}
+
+// declaresTargets 判断工具 name 是否声明了访问路径。调用方必须持有 r.mu。
+func (r *Registry) declaresTargets(name string) bool {
+	t, found := r.tools[name]
+	return found && t.targets != nil
+}
+
+// CheckPolicy 检查策略是否允许以 arguments 调用工具 name：工具必须被启用，
+// 它访问的路径不能被路径规则禁止，没有声明访问路径时不能被路径规则的 Untargeted 禁止。
+// 受路径规则约束的工具声明的路径无法解析时也会被拒绝，因为无法确认它们不在被禁止的目录中。
+// arguments 应当已经通过 ValidateArguments。
+func (r *Registry) CheckPolicy(name, arguments string) error {
+	r.mu.RLock()
+	policy := r.policy
+	declaresTargets := r.declaresTargets(name)
+	r.mu.RUnlock()
+	if !policy.allows(name) {
+		return fmt.Errorf("tool '%s' is disabled by policy", name)
+	}
+	if !declaresTargets && policy.untargeted(name) == UntargetedDeny {
+		return fmt.Errorf("tool '%s' does not declare the paths it accesses and is denied by a path rule", name)
+	}
+	if !policy.restrictsPaths(name) {
+		return nil
+	}
+	targets, err := r.targets(name, arguments)
+	if err != nil {
+		return fmt.Errorf("tool '%s' may not access a path that cannot be checked against the path rules: %w", name, err)
+	}
+	ws, err := r.Workspace()
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		rel := ws.Rel(target)
+		if pattern, denied := policy.deniedPath(name, rel); denied {
+			return fmt.Errorf("tool '%s' may not access '%s': denied by policy rule '%s'", name, rel, pattern)
+		}
+	}
+	return nil
+}
+
+// --- Helper functions ---
+
+func matchesAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
+
+// pathPattern 规范化路径规则中的模式："vendor/" 表示整个 vendor 目录。
+func pathPattern(pattern string) string {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return pattern
+}
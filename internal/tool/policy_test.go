@@ -0,0 +1,113 @@
+// internal/tool/policy_test.go
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/llm"
+)
+
+func TestCheckPolicyPathRules(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{
+		"public.txt":      "public",
+		"secrets/key.txt": "key",
+	})
+	_, outside := newTestWorkspace(t)
+	symlink(t, filepath.Join(root, "secrets", "key.txt"), filepath.Join(root, "alias.txt"))
+	symlink(t, filepath.Join(root, "public.txt"), filepath.Join(root, "secrets", "public-link"))
+	symlink(t, filepath.Join(outside, "missing"), filepath.Join(root, "secrets", "dangling"))
+	symlink(t, filepath.Join(outside, "missing"), filepath.Join(root, "dangling"))
+	err := r.SetPolicy(Policy{Paths: []PathRule{{Tools: []string{"*_file"}, Deny: []string{"secrets/"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    map[string]any
+		wantErr string // 为空表示应当允许
+	}{
+		{name: "allowed path", tool: "read_file", args: map[string]any{"file_path": "public.txt"}},
+		{name: "denied path", tool: "read_file", args: map[string]any{"file_path": "secrets/key.txt"}, wantErr: "denied by policy rule 'secrets/'"},
+		{name: "link to a denied path", tool: "read_file", args: map[string]any{"file_path": "alias.txt"}, wantErr: "may not access 'secrets/key.txt'"},
+		{name: "link inside a denied directory", tool: "delete_file", args: map[string]any{"file_path": "secrets/public-link"}, wantErr: "may not access 'secrets/public-link'"},
+		{name: "broken link inside a denied directory", tool: "delete_file", args: map[string]any{"file_path": "secrets/dangling"}, wantErr: "may not access 'secrets/dangling'"},
+		{name: "broken link elsewhere", tool: "delete_file", args: map[string]any{"file_path": "dangling"}},
+		{name: "move into a denied directory", tool: "move_file", args: map[string]any{"source": "public.txt", "destination": "secrets/public.txt"}, wantErr: "denied by policy rule"},
+		{name: "unresolvable path", tool: "read_file", args: map[string]any{"file_path": filepath.Join(outside, "x.txt")}, wantErr: "cannot be checked against the path rules"},
+		// 路径规则不适用的工具不受影响，路径错误由工具自己报告
+		{name: "rule does not apply", tool: "list_directory", args: map[string]any{"path": "secrets"}},
+		{name: "rule does not apply to an unresolvable path", tool: "list_directory", args: map[string]any{"path": outside}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := json.Marshal(tt.args)
+			arguments, err := r.ValidateArguments(tt.tool, string(data))
+			if err != nil {
+				t.Fatalf("ValidateArguments: %v", err)
+			}
+			err = r.CheckPolicy(tt.tool, arguments)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckPolicy: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckPolicy error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTargetsIncludeLinks(t *testing.T) {
+	r, root := newTestRegistry(t, map[string]string{"real.txt": "x"})
+	symlink(t, filepath.Join(root, "real.txt"), filepath.Join(root, "link.txt"))
+	got := r.Targets("delete_file", `{"file_path": "link.txt"}`)
+	want := []string{filepath.Join(root, "real.txt"), filepath.Join(root, "link.txt")}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Targets = %q, want %q", got, want)
+	}
+	if got := r.Targets("read_file", `{"file_path": "../escape.txt"}`); got != nil {
+		t.Errorf("Targets for an unresolvable path = %q, want nil", got)
+	}
+}
+
+func TestUntargetedTools(t *testing.T) {
+	r, _ := newTestRegistry(t, nil)
+	noop := func(context.Context, Env, string) (Result, error) { return TextResult("ok"), nil }
+	if err := r.Register(llm.Tool{Name: "fetch_url"}, noop, AccessReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	err := r.SetPolicy(Policy{
+		AutoApprove: []string{"run_command"},
+		Paths: []PathRule{
+			{Tools: []string{"run_command"}, Untargeted: UntargetedConfirm},
+			{Tools: []string{"fetch_*"}, Untargeted: UntargetedDeny},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Approval("run_command"); got != ApprovalConfirm {
+		t.Errorf("Approval(run_command) = %v, want ApprovalConfirm", got)
+	}
+	if err := r.CheckPolicy("run_command", `{"command": "ls"}`); err != nil {
+		t.Errorf("CheckPolicy(run_command): %v", err)
+	}
+	if err := r.CheckPolicy("fetch_url", `{}`); err == nil {
+		t.Error("CheckPolicy allowed a tool denied by untargeted: deny")
+	}
+	// 声明了路径的工具不受 Untargeted 影响
+	if got := r.Approval("read_file"); got != ApprovalDefault {
+		t.Errorf("Approval(read_file) = %v, want ApprovalDefault", got)
+	}
+	if err := r.SetPolicy(Policy{Paths: []PathRule{{Untargeted: "sometimes"}}}); err == nil {
+		t.Error("SetPolicy accepted an invalid untargeted action")
+	}
+}
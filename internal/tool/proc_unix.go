@@ -0,0 +1,22 @@
+//go:build !windows
+
+// internal/tool/proc_unix.go
+package tool
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让命令在新的进程组中运行，以便超时后可以一并结束其子进程。
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup 杀死命令所在的整个进程组。
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
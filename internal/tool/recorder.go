@@ -0,0 +1,17 @@
+// internal/tool/recorder.go
+package tool
+
+// Recorder 在工具修改工作区之前保存被修改路径的原始状态，例如用于撤销。
+// 它通过 Env 传给工具，因此共享同一个注册表的多个 agent 可以各自记录自己的修改。
+type Recorder interface {
+	Record(path string) error
+}
+
+// record 在修改 path（已解析的绝对路径）之前通知 env 中的 Recorder。
+// 记录失败时不应继续修改，否则这次修改将无法撤销。
+func (e Env) record(path string) error {
+	if e.Recorder == nil {
+		return nil
+	}
+	return e.Recorder.Record(path)
+}
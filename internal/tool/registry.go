@@ -3,44 +3,408 @@ package tool
 
 import (
 	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/synapse/internal/llm"
-
-	"sync"
 )
 
-var (
-	registry     = make(map[string]ToolFunc)
-	definitions  []llm.Tool // <-- 直接使用 llm.Tool 类型
-	registryOnce sync.Once
-)
+// registeredTool 是注册表中的一个条目。
+type registeredTool struct {
+	def     llm.Tool
+	fn      ToolFunc
+	access  Access
+	preview PreviewFunc
+	targets TargetsFunc
+	schema  *jsonSchema // 用于校验参数，为 nil 时不校验
+	enabled bool
+	// timeout 是单次调用的超时；0 表示使用注册表的默认超时，NoTimeout 表示不限制。
+	timeout time.Duration
+	// providers 限制只向这些 provider 公开该工具，为空表示对所有 provider 可见。
+	providers []string
+	// records 表示工具在修改文件前会通知 Env.Recorder，它做出的修改可以被撤销。
+	records bool
+}
+
+// Registry 是一组可供 agent 使用的工具。
+// 每个 Agent 持有自己的 Registry，因此同一进程中的多个 agent 可以拥有不同的工具集；
+// 工具可以在运行时注册、注销、启用和禁用。
+type Registry struct {
+	mu             sync.RWMutex
+	tools          map[string]*registeredTool
+	order          []string      // 注册顺序，保证向模型公开的定义列表是稳定的
+	defaultTimeout time.Duration // 未单独设置超时的工具使用的超时，0 表示不限制
+	maxResultBytes int           // 结果文本的大小上限，0 表示使用默认值
+	policy         Policy        // 用户配置的工具策略
+	workspace      *Workspace    // 工具可以访问的工作区，nil 表示以当前工作目录为根
+	commands       CommandPolicy // run_command 使用的命令策略
+}
+
+// NoTimeout 用于 SetTimeout，表示工具不受注册表默认超时的限制（例如自己管理超时的工具）。
+const NoTimeout time.Duration = -1
+
+// NewRegistry 创建一个空的注册表。
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]*registeredTool), commands: defaultCommandPolicy()}
+}
+
+// NewBuiltinRegistry 创建一个包含所有内置工具的注册表。
+func NewBuiltinRegistry() *Registry {
+	r := NewRegistry()
+	registerFileTools(r)
+	registerSearchTools(r)
+	registerCommandTools(r)
+	registerPatchTools(r)
+	return r
+}
 
 // Register 注册一个工具，使其可用。
-// 它接收一个 llm.Tool 定义和一个我们自定义的 ToolFunc 实现。
-func Register(def llm.Tool, fn ToolFunc) { // <-- 参数类型改为 llm.Tool
-	name := def.Function.Name
-	if _, exists := registry[name]; exists {
-		panic(fmt.Sprintf("tool %s is already registered", name))
+// 它接收一个 llm.Tool 定义、一个我们自定义的 ToolFunc 实现，
+// 以及该工具对工作区的访问级别。同名工具已存在时返回错误。
+func (r *Registry) Register(def llm.Tool, fn ToolFunc, access Access) error {
+	if def.Name == "" {
+		return fmt.Errorf("tool definition has no name")
 	}
-	registry[name] = fn
-	definitions = append(definitions, def)
+	name := def.Name
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[name]; exists {
+		return fmt.Errorf("tool %s is already registered", name)
+	}
+	r.tools[name] = &registeredTool{def: def, fn: fn, access: access, schema: parseSchema(def.Parameters), enabled: true}
+	r.order = append(r.order, name)
+	return nil
 }
 
-// GetExecutor 返回一个可以执行工具的函数。
-func GetExecutor(name string) (ToolFunc, bool) {
-	fn, found := registry[name]
-	return fn, found
+// MustRegister 与 Register 相同，但在出错时 panic。用于注册内置工具。
+func (r *Registry) MustRegister(def llm.Tool, fn ToolFunc, access Access) {
+	if err := r.Register(def, fn, access); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterPreview 为一个已注册的工具关联预览函数。
+func (r *Registry) RegisterPreview(name string, fn PreviewFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, exists := r.tools[name]
+	if !exists {
+		return fmt.Errorf("cannot register preview: tool %s is not registered", name)
+	}
+	t.preview = fn
+	return nil
+}
+
+// MustRegisterPreview 与 RegisterPreview 相同，但在出错时 panic。
+func (r *Registry) MustRegisterPreview(name string, fn PreviewFunc) {
+	if err := r.RegisterPreview(name, fn); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterTargets 为一个已注册的工具关联 TargetsFunc。
+func (r *Registry) RegisterTargets(name string, fn TargetsFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, exists := r.tools[name]
+	if !exists {
+		return fmt.Errorf("cannot register targets: tool %s is not registered", name)
+	}
+	t.targets = fn
+	return nil
+}
+
+// MustRegisterTargets 与 RegisterTargets 相同，但在出错时 panic。
+func (r *Registry) MustRegisterTargets(name string, fn TargetsFunc) {
+	if err := r.RegisterTargets(name, fn); err != nil {
+		panic(err)
+	}
+}
+
+// Unregister 移除一个工具。工具不存在时返回 false。
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[name]; !exists {
+		return false
+	}
+	delete(r.tools, name)
+	r.order = slices.DeleteFunc(r.order, func(n string) bool { return n == name })
+	return true
+}
+
+// Enable 重新启用一个被禁用的工具。
+func (r *Registry) Enable(name string) error {
+	return r.setEnabled(name, true)
+}
+
+// Disable 禁用一个工具：它不会再向模型公开，也不能被执行，但仍保留在注册表中。
+func (r *Registry) Disable(name string) error {
+	return r.setEnabled(name, false)
+}
+
+func (r *Registry) setEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, exists := r.tools[name]
+	if !exists {
+		return fmt.Errorf("tool '%s' not found in registry", name)
+	}
+	t.enabled = enabled
+	return nil
+}
+
+// RestrictToProviders 限制工具只向指定的 provider 公开。不传 provider 表示取消限制。
+func (r *Registry) RestrictToProviders(name string, providers ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, exists := r.tools[name]
+	if !exists {
+		return fmt.Errorf("tool '%s' not found in registry", name)
+	}
+	t.providers = providers
+	return nil
+}
+
+// SetDefaultTimeout 设置未单独配置超时的工具的默认超时。d <= 0 表示不限制。
+func (r *Registry) SetDefaultTimeout(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultTimeout = max(d, 0)
+}
+
+// SetTimeout 设置单个工具的超时，覆盖默认超时。
+// d 为 0 时恢复使用默认超时，为 NoTimeout 时不限制。
+func (r *Registry) SetTimeout(name string, d time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, exists := r.tools[name]
+	if !exists {
+		return fmt.Errorf("tool '%s' not found in registry", name)
+	}
+	t.timeout = d
+	return nil
+}
+
+// Timeout 返回工具实际生效的超时，0 表示不限制。
+func (r *Registry) Timeout(name string) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, found := r.tools[name]
+	if !found {
+		return 0
+	}
+	switch {
+	case t.timeout == NoTimeout:
+		return 0
+	case t.timeout > 0:
+		return t.timeout
+	default:
+		return r.defaultTimeout
+	}
 }
 
-// GetDefaultTools 返回所有已注册工具的定义。
-func GetDefaultTools() []llm.Tool { // <-- 返回类型改为 []llm.Tool
-	InitTools() // 确保工具已初始化
-	return definitions
+// Definitions 返回所有已启用且未被策略禁用的工具的定义。
+func (r *Registry) Definitions() []llm.Tool {
+	return r.DefinitionsFor("")
+}
+
+// DefinitionsFor 返回对指定 provider 可见的已启用且未被策略禁用的工具的定义。
+// provider 为空时忽略 provider 限制。
+func (r *Registry) DefinitionsFor(provider string) []llm.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	defs := make([]llm.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		t := r.tools[name]
+		if !t.enabled || !r.policy.allows(name) {
+			continue
+		}
+		if provider != "" && len(t.providers) > 0 && !slices.Contains(t.providers, provider) {
+			continue
+		}
+		defs = append(defs, t.def)
+	}
+	return defs
+}
+
+// Names 返回所有已注册工具的名称（包括被禁用的），按注册顺序排列。
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.order)
+}
+
+// GetExecutor 返回一个已启用工具的执行函数。
+func (r *Registry) GetExecutor(name string) (ToolFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, found := r.tools[name]
+	if !found || !t.enabled {
+		return nil, false
+	}
+	return t.fn, true
+}
+
+// Access 返回工具的访问级别。
+// 未知的工具被视为会修改工作区，从而总是需要确认。
+func (r *Registry) Access(name string) Access {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, found := r.tools[name]
+	if !found {
+		return AccessMutating
+	}
+	return t.access
+}
+
+// RecordsChanges 判断工具是否在修改文件前通知 Env.Recorder。
+// 对会修改工作区的工具返回 false 意味着它的修改（例如 run_command、插件和 MCP 工具做出的修改）无法被撤销。
+func (r *Registry) RecordsChanges(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, found := r.tools[name]
+	return found && t.records
+}
+
+// markRecorded 标记内置工具会通过 Env.Recorder 记录自己的修改。
+func (r *Registry) markRecorded(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		if t, found := r.tools[name]; found {
+			t.records = true
+		}
+	}
+}
+
+// Preview 返回工具执行前的变更预览。没有注册预览函数的工具返回空字符串。
+func (r *Registry) Preview(name, arguments string) (string, error) {
+	r.mu.RLock()
+	t, found := r.tools[name]
+	r.mu.RUnlock()
+	if !found || t.preview == nil {
+		return "", nil
+	}
+	env, err := r.env(Env{})
+	if err != nil {
+		return "", err
+	}
+	return t.preview(env, arguments)
+}
+
+// env 用注册表的工作区、命令策略和结果大小上限补全一次调用的执行环境。
+func (r *Registry) env(env Env) (Env, error) {
+	ws, err := r.Workspace()
+	if err != nil {
+		return Env{}, err
+	}
+	env.Workspace = ws
+	env.WorkspaceRoot = ws.Root()
+	r.mu.RLock()
+	env.commands = r.commands
+	env.maxResultSize = r.maxResultBytes
+	r.mu.RUnlock()
+	return env, nil
+}
+
+// Targets 返回一次调用将会访问的路径，已解析为工作区内的绝对路径。
+// 符号链接同时返回链接自身的路径和它指向的位置，因为有的工具（例如 delete_file）操作链接本身。
+// 返回 nil 表示无法确定（工具没有注册 TargetsFunc，或者某个路径无法解析）。
+func (r *Registry) Targets(name, arguments string) []string {
+	targets, err := r.targets(name, arguments)
+	if err != nil {
+		return nil
+	}
+	return targets
+}
+
+// targets 与 Targets 相同，但在某个声明的路径无法解析时返回错误。
+// 路径只要作为链接自身或沿链接解析后在工作区内就算可以解析：
+// 无法沿链接解析的路径（例如悬空的链接）只会被操作链接本身的工具访问。
+func (r *Registry) targets(name, arguments string) ([]string, error) {
+	r.mu.RLock()
+	t, found := r.tools[name]
+	r.mu.RUnlock()
+	if !found || t.targets == nil {
+		return nil, nil
+	}
+	paths := t.targets(arguments)
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	ws, err := r.Workspace()
+	if err != nil {
+		return nil, err
+	}
+	resolved := make([]string, 0, len(paths))
+	for _, p := range paths {
+		link, linkErr := ws.ResolveLink(p)
+		target, err := ws.Resolve(p)
+		switch {
+		case err == nil:
+			resolved = append(resolved, target)
+			if linkErr == nil && link != target {
+				resolved = append(resolved, link)
+			}
+		case linkErr == nil:
+			resolved = append(resolved, link)
+		default:
+			return nil, fmt.Errorf("cannot resolve '%s': %w", p, err)
+		}
+	}
+	return resolved, nil
+}
+
+// --- Default registry ---
+
+var (
+	defaultRegistry *Registry
+	registryOnce    sync.Once
+)
+
+// Default 返回包含所有内置工具的全局默认注册表。
+// 它用于兼容不持有自己注册表的调用方。
+func Default() *Registry {
+	InitTools()
+	return defaultRegistry
 }
 
 // InitTools 初始化并注册所有默认工具。
 func InitTools() {
 	registryOnce.Do(func() {
-		registerFileTools()
+		defaultRegistry = NewBuiltinRegistry()
 	})
 }
+
+// Register 向默认注册表注册一个工具。同名工具已存在时 panic。
+func Register(def llm.Tool, fn ToolFunc, access Access) {
+	Default().MustRegister(def, fn, access)
+}
+
+// RegisterPreview 为默认注册表中的工具关联一个预览函数。
+func RegisterPreview(name string, fn PreviewFunc) {
+	Default().MustRegisterPreview(name, fn)
+}
+
+// GetExecutor 返回默认注册表中工具的执行函数。
+func GetExecutor(name string) (ToolFunc, bool) {
+	return Default().GetExecutor(name)
+}
+
+// GetAccess 返回默认注册表中工具的访问级别。
+func GetAccess(name string) Access {
+	return Default().Access(name)
+}
+
+// Preview 返回默认注册表中工具执行前的变更预览。
+func Preview(name, arguments string) (string, error) {
+	return Default().Preview(name, arguments)
+}
+
+// GetDefaultTools 返回默认注册表中所有已启用且未被策略禁用的工具的定义。
+func GetDefaultTools() []llm.Tool {
+	return Default().Definitions()
+}
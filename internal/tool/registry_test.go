@@ -0,0 +1,127 @@
+// internal/tool/registry_test.go
+package tool
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/llm"
+)
+
+func echoTool(context.Context, Env, string) (Result, error) { return TextResult("ok"), nil }
+
+// definitionNames 返回定义列表中的工具名称。
+func definitionNames(defs []llm.Tool) []string {
+	names := make([]string, 0, len(defs))
+	for _, def := range defs {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+func TestRegistriesAreIndependent(t *testing.T) {
+	a, b := NewBuiltinRegistry(), NewBuiltinRegistry()
+	a.MustRegister(llm.Tool{Name: "only_in_a"}, echoTool, AccessReadOnly)
+	if err := b.Disable("read_file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := b.GetExecutor("only_in_a"); found {
+		t.Error("a tool registered in one registry is visible in another")
+	}
+	if _, found := a.GetExecutor("read_file"); !found {
+		t.Error("disabling a tool in one registry disabled it in another")
+	}
+	// 默认注册表与新创建的注册表互不影响
+	if _, found := Default().GetExecutor("only_in_a"); found {
+		t.Error("the default registry sees a tool registered in another registry")
+	}
+}
+
+func TestRegisterAndUnregister(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(llm.Tool{Name: "b"}, echoTool, AccessReadOnly)
+	r.MustRegister(llm.Tool{Name: "a"}, echoTool, AccessMutating)
+	if err := r.Register(llm.Tool{Name: "a"}, echoTool, AccessReadOnly); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("duplicate Register error = %v", err)
+	}
+	if err := r.Register(llm.Tool{}, echoTool, AccessReadOnly); err == nil {
+		t.Error("Register accepted a tool without a name")
+	}
+	// 定义按注册顺序返回
+	if got := definitionNames(r.Definitions()); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("Definitions = %q, want registration order", got)
+	}
+	if r.Access("a") != AccessMutating || r.Access("unknown") != AccessMutating {
+		t.Errorf("Access(a) = %v, Access(unknown) = %v; want mutating", r.Access("a"), r.Access("unknown"))
+	}
+
+	if !r.Unregister("b") || r.Unregister("b") {
+		t.Error("Unregister should succeed once")
+	}
+	if got := r.Names(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Names after Unregister = %q", got)
+	}
+	// 注销后可以用同一个名称重新注册
+	if err := r.Register(llm.Tool{Name: "b"}, echoTool, AccessReadOnly); err != nil {
+		t.Errorf("Register after Unregister: %v", err)
+	}
+	if err := r.RegisterPreview("missing", nil); err == nil {
+		t.Error("RegisterPreview accepted an unknown tool")
+	}
+}
+
+func TestEnableAndDisable(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(llm.Tool{Name: "t"}, echoTool, AccessReadOnly)
+	if err := r.Disable("t"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Definitions()) != 0 {
+		t.Error("a disabled tool is still offered to the model")
+	}
+	if _, err := r.Execute(context.Background(), Env{}, "t", "{}"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Execute of a disabled tool error = %v", err)
+	}
+	if got := r.Names(); !reflect.DeepEqual(got, []string{"t"}) {
+		t.Errorf("Names = %q, want disabled tools to be listed", got)
+	}
+	if err := r.Enable("t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Execute(context.Background(), Env{}, "t", "{}"); err != nil {
+		t.Errorf("Execute after Enable: %v", err)
+	}
+	if err := r.Disable("missing"); err == nil {
+		t.Error("Disable accepted an unknown tool")
+	}
+}
+
+func TestDefinitionsFor(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"everywhere", "ollama_only", "cloud_only"} {
+		r.MustRegister(llm.Tool{Name: name}, echoTool, AccessReadOnly)
+	}
+	r.RestrictToProviders("ollama_only", "ollama")
+	r.RestrictToProviders("cloud_only", "openai", "anthropic")
+
+	tests := map[string][]string{
+		"":          {"everywhere", "ollama_only", "cloud_only"},
+		"ollama":    {"everywhere", "ollama_only"},
+		"anthropic": {"everywhere", "cloud_only"},
+		"deepseek":  {"everywhere"},
+	}
+	for provider, want := range tests {
+		if got := definitionNames(r.DefinitionsFor(provider)); !reflect.DeepEqual(got, want) {
+			t.Errorf("DefinitionsFor(%q) = %q, want %q", provider, got, want)
+		}
+	}
+
+	// 不传 provider 时取消限制
+	r.RestrictToProviders("ollama_only")
+	if got := definitionNames(r.DefinitionsFor("deepseek")); !reflect.DeepEqual(got, []string{"everywhere", "ollama_only"}) {
+		t.Errorf("DefinitionsFor after lifting the restriction = %q", got)
+	}
+}
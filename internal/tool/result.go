@@ -0,0 +1,115 @@
+// internal/tool/result.go
+package tool
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxResultBytes 是工具结果中发送给模型的文本的默认大小上限。
+const defaultMaxResultBytes = 64 * 1024
+
+// Result 是一次工具调用的结构化结果。
+type Result struct {
+	// Text 是发送给模型、写入会话历史的内容。
+	Text string
+	// Summary 是展示给用户的一行摘要，例如 "Read 120 lines from main.go"。
+	Summary string
+	// Meta 是结构化的附加信息，例如 bytes、lines、exit_code。
+	Meta map[string]any
+	// Diff 是工具对文件做出的变更（统一 diff 格式），没有变更时为空。
+	Diff string
+}
+
+// TextResult 创建一个只有文本内容的结果。
+func TextResult(text string) Result {
+	return Result{Text: text}
+}
+
+// SetMeta 设置一项元数据并返回 r，便于链式调用。
+func (r Result) SetMeta(key string, value any) Result {
+	meta := make(map[string]any, len(r.Meta)+1)
+	for k, v := range r.Meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	r.Meta = meta
+	return r
+}
+
+// SetMaxResultBytes 设置工具结果文本的大小上限，超出部分会从中间截断。n <= 0 时使用默认值。
+func (r *Registry) SetMaxResultBytes(n int) {
+	if n <= 0 {
+		n = defaultMaxResultBytes
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxResultBytes = n
+}
+
+func (r *Registry) resultBudget() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.maxResultBytes <= 0 {
+		return defaultMaxResultBytes
+	}
+	return r.maxResultBytes
+}
+
+// resultBudget 返回本次调用的结果文本大小上限。
+// 自己分页的工具（例如 read_file）应当让输出保持在这个上限之内，以免被从中间截断。
+func (e Env) resultBudget() int {
+	if e.maxResultSize <= 0 {
+		return defaultMaxResultBytes
+	}
+	return e.maxResultSize
+}
+
+// truncateResult 在结果文本超过 limit 字节时保留开头和结尾，并注明省略了多少内容。
+func truncateResult(res Result, limit int) Result {
+	text, dropped := truncateMiddle(res.Text, limit)
+	if dropped == 0 {
+		return res
+	}
+	res.Text = text
+	return res.SetMeta("truncated_bytes", dropped)
+}
+
+// truncateMiddle 保留 text 的开头和结尾部分，使其不超过大约 limit 字节。
+// 切分点尽量落在行边界上，并且不会切断 UTF-8 字符。返回截断后的文本和被省略的字节数。
+func truncateMiddle(text string, limit int) (string, int) {
+	if len(text) <= limit {
+		return text, 0
+	}
+	headLen := limit / 2
+	tailLen := limit - headLen
+
+	head := text[:headLen]
+	if i := strings.LastIndexByte(head, '\n'); i > headLen/2 {
+		head = head[:i+1]
+	}
+	for len(head) > 0 {
+		if r, size := utf8.DecodeLastRuneInString(head); r != utf8.RuneError || size > 1 {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+
+	tailStart := len(text) - tailLen
+	if i := strings.IndexByte(text[tailStart:], '\n'); i >= 0 && i < tailLen/2 {
+		tailStart += i + 1
+	}
+	for tailStart < len(text) && !utf8.RuneStart(text[tailStart]) {
+		tailStart++
+	}
+	tail := text[tailStart:]
+
+	dropped := len(text) - len(head) - len(tail)
+	droppedLines := strings.Count(text[len(head):tailStart], "\n")
+	note := fmt.Sprintf("... [output truncated: %d bytes (%d lines) omitted from the middle] ...\n", dropped, droppedLines)
+	if !strings.HasSuffix(head, "\n") {
+		note = "\n" + note
+	}
+	return head + note + tail, dropped
+}
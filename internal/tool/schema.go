@@ -0,0 +1,237 @@
+// internal/tool/schema.go
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/synapse/internal/llm"
+)
+
+// TypedTool 描述一个使用 Go 结构体作为参数的工具。
+// 参数的 JSON Schema 通过反射 T 生成，字段支持以下标签：
+//
+//	json:"name"       参数名（与 encoding/json 相同，"-" 表示忽略该字段）
+//	desc:"..."        参数说明
+//	enum:"a,b,c"      允许的取值，以逗号分隔
+//	required:"true"   必填参数
+//	default:"..."     参数缺省时使用的默认值
+//
+// 嵌入的结构体会被展开到外层对象中。参数在 Run 之前由 Registry.ValidateArguments
+// 按生成的 schema 校验并填入默认值，然后被解析到 T 中。
+type TypedTool[T any] struct {
+	Name        string
+	Description string
+	Access      Access
+	Run         func(ctx context.Context, env Env, args T) (Result, error)
+	// Preview 是可选的，用于在审批时展示变更预览。
+	Preview func(env Env, args T) (string, error)
+	// Targets 是可选的，返回调用将会访问的路径，用于并发调度。
+	Targets func(args T) []string
+}
+
+// RegisterTyped 向注册表 r 注册一个使用结构体参数的工具。
+func RegisterTyped[T any](r *Registry, t TypedTool[T]) error {
+	schema, err := buildSchema(reflect.TypeFor[T]())
+	if err != nil {
+		return fmt.Errorf("invalid argument type for tool %s: %w", t.Name, err)
+	}
+	params, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+
+	decode := func(arguments string) (T, error) {
+		var args T
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return args, fmt.Errorf("invalid arguments for %s: %w", t.Name, err)
+		}
+		return args, nil
+	}
+
+	def := llm.Tool{
+		Name:        t.Name,
+		Description: t.Description,
+		Parameters:  json.RawMessage(params),
+	}
+	run := func(ctx context.Context, env Env, arguments string) (Result, error) {
+		args, err := decode(arguments)
+		if err != nil {
+			return Result{}, err
+		}
+		return t.Run(ctx, env, args)
+	}
+	if err := r.Register(def, run, t.Access); err != nil {
+		return err
+	}
+	// 生成的 schema 完整描述了 T 的字段，未声明的参数一定是模型拼错了
+	r.mu.Lock()
+	if schema := r.tools[t.Name].schema; schema != nil {
+		schema.disallowExtraProperties()
+	}
+	r.mu.Unlock()
+	if t.Preview != nil {
+		err := r.RegisterPreview(t.Name, func(env Env, arguments string) (string, error) {
+			args, err := decode(arguments)
+			if err != nil {
+				return "", err
+			}
+			return t.Preview(env, args)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if t.Targets != nil {
+		return r.RegisterTargets(t.Name, func(arguments string) []string {
+			args, err := decode(arguments)
+			if err != nil {
+				return nil
+			}
+			return t.Targets(args)
+		})
+	}
+	return nil
+}
+
+// MustRegisterTyped 与 RegisterTyped 相同，但在出错时 panic。用于注册内置工具。
+func MustRegisterTyped[T any](r *Registry, t TypedTool[T]) {
+	if err := RegisterTyped(r, t); err != nil {
+		panic(err)
+	}
+}
+
+// --- Schema generation ---
+
+// schemaNode 是 JSON Schema 中我们用到的子集。
+type schemaNode struct {
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Enum        []any                  `json:"enum,omitempty"`
+	Default     any                    `json:"default,omitempty"`
+	Items       *schemaNode            `json:"items,omitempty"`
+	Properties  map[string]*schemaNode `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+}
+
+var rawMessageType = reflect.TypeFor[json.RawMessage]()
+
+// buildSchema 根据 Go 类型生成 JSON Schema。
+func buildSchema(t reflect.Type) (*schemaNode, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == rawMessageType {
+		return &schemaNode{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &schemaNode{Type: "string"}, nil
+	case reflect.Bool:
+		return &schemaNode{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schemaNode{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &schemaNode{Type: "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := buildSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{Type: "array", Items: items}, nil
+	case reflect.Map:
+		return &schemaNode{Type: "object"}, nil
+	case reflect.Interface:
+		return &schemaNode{}, nil
+	case reflect.Struct:
+		node := &schemaNode{Type: "object", Properties: make(map[string]*schemaNode)}
+		if err := addStructFields(node, t); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, fmt.Errorf("unsupported argument type %s", t)
+	}
+}
+
+// addStructFields 把结构体 t 的字段加入 node，嵌入的结构体会被展开。
+func addStructFields(node *schemaNode, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(jsonTag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := addStructFields(node, embedded); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, err := buildSchema(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		prop.Description = field.Tag.Get("desc")
+		if enum, ok := field.Tag.Lookup("enum"); ok {
+			for _, v := range strings.Split(enum, ",") {
+				value, err := parseTagValue(prop.Type, strings.TrimSpace(v))
+				if err != nil {
+					return fmt.Errorf("field %s: invalid enum value %q: %w", field.Name, v, err)
+				}
+				prop.Enum = append(prop.Enum, value)
+			}
+		}
+		if def, ok := field.Tag.Lookup("default"); ok {
+			value, err := parseTagValue(prop.Type, def)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid default %q: %w", field.Name, def, err)
+			}
+			prop.Default = value
+		}
+		if required, _ := strconv.ParseBool(field.Tag.Get("required")); required {
+			node.Required = append(node.Required, name)
+		}
+		node.Properties[name] = prop
+	}
+	return nil
+}
+
+// parseTagValue 把标签中的字符串按 schema 类型转换为 JSON 值。
+func parseTagValue(typ, s string) (any, error) {
+	switch typ {
+	case "string":
+		return s, nil
+	case "boolean":
+		return strconv.ParseBool(s)
+	case "integer":
+		return strconv.ParseInt(s, 10, 64)
+	case "number":
+		return strconv.ParseFloat(s, 64)
+	default:
+		var v any
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err
+	}
+}
@@ -0,0 +1,108 @@
+// internal/tool/schema_test.go
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type schemaCommon struct {
+	Path string `json:"path" desc:"The path" required:"true"`
+}
+
+type schemaArgs struct {
+	schemaCommon
+	Level   int               `json:"level" enum:"1, 2, 3" default:"2"`
+	Mode    string            `json:"mode,omitempty" enum:"fast,slow"`
+	Ratio   float64           `json:"ratio" default:"0.5"`
+	Force   *bool             `json:"force" default:"false"`
+	Tags    []string          `json:"tags" desc:"Labels"`
+	Labels  map[string]string `json:"labels"`
+	Raw     json.RawMessage   `json:"raw"`
+	Items   []schemaItem      `json:"items"`
+	Ignored string            `json:"-"`
+	NoTag   string
+	hidden  string
+}
+
+type schemaItem struct {
+	Name string `json:"name" required:"true"`
+}
+
+func TestBuildSchema(t *testing.T) {
+	r := NewRegistry()
+	if err := RegisterTyped(r, TypedTool[schemaArgs]{Name: "typed", Run: func(context.Context, Env, schemaArgs) (Result, error) {
+		return Result{}, nil
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(r.Definitions()[0].Parameters, &got); err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]any
+	json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["path"],
+		"properties": {
+			"path":   {"type": "string", "description": "The path"},
+			"level":  {"type": "integer", "enum": [1, 2, 3], "default": 2},
+			"mode":   {"type": "string", "enum": ["fast", "slow"]},
+			"ratio":  {"type": "number", "default": 0.5},
+			"force":  {"type": "boolean", "default": false},
+			"tags":   {"type": "array", "description": "Labels", "items": {"type": "string"}},
+			"labels": {"type": "object"},
+			"raw":    {},
+			"items":  {"type": "array", "items": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}},
+			"NoTag":  {"type": "string"}
+		}
+	}`), &want)
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("schema =\n%s\nwant\n%s", gotJSON, wantJSON)
+	}
+}
+
+func TestBuildSchemaErrors(t *testing.T) {
+	run := func(name string, register func(r *Registry) error, wantErr string) {
+		t.Helper()
+		if err := register(NewRegistry()); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: RegisterTyped error = %v, want %q", name, err, wantErr)
+		}
+	}
+	run("bad enum", func(r *Registry) error {
+		type args struct {
+			N int `json:"n" enum:"1,two"`
+		}
+		return RegisterTyped(r, TypedTool[args]{Name: "t"})
+	}, `field N: invalid enum value "two"`)
+	run("bad default", func(r *Registry) error {
+		type args struct {
+			B bool `json:"b" default:"maybe"`
+		}
+		return RegisterTyped(r, TypedTool[args]{Name: "t"})
+	}, `field B: invalid default "maybe"`)
+	run("unsupported type", func(r *Registry) error {
+		type args struct {
+			C chan int `json:"c"`
+		}
+		return RegisterTyped(r, TypedTool[args]{Name: "t"})
+	}, "invalid argument type for tool t: field C: unsupported argument type chan int")
+}
+
+func TestTypedToolRejectsUnknownFields(t *testing.T) {
+	r := NewRegistry()
+	MustRegisterTyped(r, TypedTool[schemaItem]{Name: "typed", Run: func(_ context.Context, _ Env, a schemaItem) (Result, error) {
+		return TextResult(a.Name), nil
+	}})
+	if _, err := r.Execute(context.Background(), Env{}, "typed", `{"name": "x", "nmae": "y"}`); err == nil || !strings.Contains(err.Error(), "nmae: unknown field") {
+		t.Errorf("Execute with an unknown field error = %v", err)
+	}
+	result, err := r.Execute(context.Background(), Env{}, "typed", `{"name": "x"}`)
+	if err != nil || result.Text != "x" {
+		t.Errorf("Execute = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,416 @@
+// internal/tool/search_tools.go
+package tool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	defaultListDepth   = 1
+	maxListDepth       = 10
+	maxListEntries     = 500
+	defaultGlobResults = 100
+	maxGlobResults     = 1000
+	defaultGrepResults = 100
+	maxGrepResults     = 500
+	maxGrepContext     = 10
+	maxGrepFileSize    = 5 << 20 // 超过该大小的文件不会被搜索
+	maxGrepLineLength  = 300     // 过长的行在输出中会被截断
+	binarySniffLength  = 8000    // 与 git 一致，检查前 8000 字节中是否有 NUL
+)
+
+// registerSearchTools 向注册表 r 注册用于探索项目结构的工具
+func registerSearchTools(r *Registry) {
+	MustRegisterTyped(r, TypedTool[listDirectoryArgs]{
+		Name:        "list_directory",
+		Description: "List the files and subdirectories of a directory in the workspace. Directories are shown with a trailing '/'",
+		Access:      AccessReadOnly,
+		Run:         toolListDirectory,
+		Targets:     func(a listDirectoryArgs) []string { return searchTargets(a.Path) },
+	})
+
+	MustRegisterTyped(r, TypedTool[globFilesArgs]{
+		Name:        "glob_files",
+		Description: "Find files whose path matches a glob pattern such as '**/*.go' or 'internal/**/*_test.go'. Results are sorted by modification time, newest first",
+		Access:      AccessReadOnly,
+		Run:         toolGlobFiles,
+		Targets:     func(a globFilesArgs) []string { return searchTargets(a.Path) },
+	})
+
+	MustRegisterTyped(r, TypedTool[grepSearchArgs]{
+		Name:        "grep_search",
+		Description: "Search file contents with a regular expression (Go RE2 syntax). Returns matches as 'file:line:text'. Binary files and paths ignored by .gitignore are skipped",
+		Access:      AccessReadOnly,
+		Run:         toolGrepSearch,
+		Targets:     func(a grepSearchArgs) []string { return searchTargets(a.Path) },
+	})
+}
+
+// --- Tool Implementations ---
+
+type listDirectoryArgs struct {
+	Path             string `json:"path" desc:"The directory to list, relative to the workspace root. Defaults to the workspace root"`
+	Depth            int    `json:"depth" desc:"How many levels deep to list (1 = direct children only)" default:"1"`
+	IncludeHidden    bool   `json:"include_hidden" desc:"Include files and directories starting with '.'" default:"false"`
+	RespectGitignore bool   `json:"respect_gitignore" desc:"Skip paths ignored by .gitignore" default:"true"`
+}
+
+func toolListDirectory(ctx context.Context, env Env, args listDirectoryArgs) (Result, error) {
+	if args.Path == "" {
+		args.Path = "."
+	}
+	if args.Depth <= 0 {
+		args.Depth = defaultListDepth
+	}
+	args.Depth = min(args.Depth, maxListDepth)
+
+	ws, dir, err := resolveDir(env, args.Path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	opts := walkOptions{
+		includeHidden:    args.IncludeHidden,
+		respectGitignore: args.RespectGitignore,
+		maxDepth:         args.Depth,
+	}
+	var entries []string
+	truncated := false
+	err = walkFiles(ctx, ws, dir, opts, func(_, rel string, entry fs.DirEntry) error {
+		if len(entries) >= maxListEntries {
+			truncated = true
+			return fs.SkipAll
+		}
+		if entry.IsDir() {
+			rel += "/"
+		}
+		entries = append(entries, rel)
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("error listing directory '%s': %w", args.Path, err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Contents of directory '%s' (depth %d):\n", ws.Rel(dir), args.Depth)
+	if len(entries) == 0 {
+		sb.WriteString("(empty)\n")
+	}
+	for _, entry := range entries {
+		sb.WriteString(entry + "\n")
+	}
+	if truncated {
+		fmt.Fprintf(&sb, "... (output truncated at %d entries; list a subdirectory or reduce depth)\n", maxListEntries)
+	}
+	return Result{
+		Text:    sb.String(),
+		Summary: fmt.Sprintf("Listed %d entries in '%s'", len(entries), ws.Rel(dir)),
+		Meta:    map[string]any{"entries": len(entries), "truncated": truncated},
+	}, nil
+}
+
+type globFilesArgs struct {
+	Pattern    string `json:"pattern" desc:"The glob pattern, relative to 'path'. Supports '*', '?', '[...]', '{a,b}' and '**' for any number of directories" required:"true"`
+	Path       string `json:"path" desc:"The directory to search in. Defaults to the workspace root"`
+	MaxResults int    `json:"max_results" desc:"Maximum number of paths to return" default:"100"`
+}
+
+func toolGlobFiles(ctx context.Context, env Env, args globFilesArgs) (Result, error) {
+	if args.Path == "" {
+		args.Path = "."
+	}
+	if args.MaxResults <= 0 {
+		args.MaxResults = defaultGlobResults
+	}
+	args.MaxResults = min(args.MaxResults, maxGlobResults)
+
+	pattern := strings.TrimPrefix(args.Pattern, "./")
+	if !doublestar.ValidatePattern(pattern) {
+		return Result{}, fmt.Errorf("invalid glob pattern '%s'", args.Pattern)
+	}
+
+	ws, dir, err := resolveDir(env, args.Path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	type match struct {
+		path    string
+		modTime time.Time
+	}
+	var matches []match
+	// 模式显式以 '.' 开头的部分时，也需要遍历隐藏文件
+	opts := walkOptions{includeHidden: strings.HasPrefix(pattern, ".") || strings.Contains(pattern, "/."), respectGitignore: true}
+	err = walkFiles(ctx, ws, dir, opts, func(absPath, rel string, entry fs.DirEntry) error {
+		if entry.IsDir() {
+			return nil
+		}
+		if ok, _ := doublestar.Match(pattern, rel); !ok {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		matches = append(matches, match{path: ws.Rel(absPath), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("error searching '%s': %w", args.Path, err)
+	}
+
+	if len(matches) == 0 {
+		return Result{
+			Text:    fmt.Sprintf("No files match pattern '%s' in '%s'", args.Pattern, ws.Rel(dir)),
+			Summary: fmt.Sprintf("No files match '%s'", args.Pattern),
+			Meta:    map[string]any{"matches": 0},
+		}, nil
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].modTime.After(matches[j].modTime)
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Found %d file(s) matching '%s':\n", len(matches), args.Pattern)
+	for i, m := range matches {
+		if i == args.MaxResults {
+			fmt.Fprintf(&sb, "... (%d more results omitted; use a more specific pattern)\n", len(matches)-args.MaxResults)
+			break
+		}
+		sb.WriteString(m.path + "\n")
+	}
+	return Result{
+		Text:    sb.String(),
+		Summary: fmt.Sprintf("Found %d file(s) matching '%s'", len(matches), args.Pattern),
+		Meta:    map[string]any{"matches": len(matches)},
+	}, nil
+}
+
+type grepSearchArgs struct {
+	Pattern         string   `json:"pattern" desc:"The regular expression to search for" required:"true"`
+	Path            string   `json:"path" desc:"The directory or file to search in. Defaults to the workspace root"`
+	Include         []string `json:"include" desc:"Only search files matching one of these globs, e.g. ['*.go', 'internal/**']"`
+	Exclude         []string `json:"exclude" desc:"Skip files matching any of these globs"`
+	CaseInsensitive bool     `json:"case_insensitive" desc:"Match case-insensitively" default:"false"`
+	ContextLines    int      `json:"context_lines" desc:"Number of lines of context to show before and after each match" default:"0"`
+	MaxResults      int      `json:"max_results" desc:"Maximum number of matching lines to return" default:"100"`
+}
+
+func toolGrepSearch(ctx context.Context, env Env, args grepSearchArgs) (Result, error) {
+	if args.Path == "" {
+		args.Path = "."
+	}
+	if args.MaxResults <= 0 {
+		args.MaxResults = defaultGrepResults
+	}
+	args.MaxResults = min(args.MaxResults, maxGrepResults)
+	args.ContextLines = max(0, min(args.ContextLines, maxGrepContext))
+
+	expr := args.Pattern
+	if args.CaseInsensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid regular expression '%s': %w", args.Pattern, err)
+	}
+	for _, glob := range append(append([]string(nil), args.Include...), args.Exclude...) {
+		if !doublestar.ValidatePattern(glob) {
+			return Result{}, fmt.Errorf("invalid glob pattern '%s'", glob)
+		}
+	}
+
+	ws := env.Workspace
+	target, err := env.resolve(args.Path)
+	if err != nil {
+		return Result{}, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return Result{}, err
+	}
+
+	searcher := &grepSearcher{
+		ws:         ws,
+		re:         re,
+		context:    args.ContextLines,
+		maxResults: args.MaxResults,
+	}
+	if !info.IsDir() {
+		searcher.searchFile(target)
+	} else {
+		err = walkFiles(ctx, ws, target, walkOptions{respectGitignore: true}, func(absPath, rel string, entry fs.DirEntry) error {
+			if entry.IsDir() || !entry.Type().IsRegular() {
+				return nil
+			}
+			if len(args.Include) > 0 && !matchAnyGlob(args.Include, rel) {
+				return nil
+			}
+			if matchAnyGlob(args.Exclude, rel) {
+				return nil
+			}
+			if !searcher.searchFile(absPath) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return Result{}, fmt.Errorf("error searching '%s': %w", args.Path, err)
+		}
+	}
+
+	if searcher.matches == 0 {
+		return Result{
+			Text:    fmt.Sprintf("No matches found for pattern '%s' in '%s'", args.Pattern, ws.Rel(target)),
+			Summary: fmt.Sprintf("No matches for '%s'", args.Pattern),
+			Meta:    map[string]any{"matches": 0, "files": 0},
+		}, nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Found %d match(es) for '%s' in %d file(s):\n", searcher.matches, args.Pattern, searcher.files)
+	sb.WriteString(searcher.out.String())
+	if searcher.truncated {
+		fmt.Fprintf(&sb, "... (stopped after %d matches; narrow the pattern or path to see more)\n", args.MaxResults)
+	}
+	return Result{
+		Text:    sb.String(),
+		Summary: fmt.Sprintf("Found %d match(es) for '%s' in %d file(s)", searcher.matches, args.Pattern, searcher.files),
+		Meta:    map[string]any{"matches": searcher.matches, "files": searcher.files, "truncated": searcher.truncated},
+	}, nil
+}
+
+// grepSearcher 累积 grep_search 的输出，并在达到结果上限时停止。
+type grepSearcher struct {
+	ws         *Workspace
+	re         *regexp.Regexp
+	context    int
+	maxResults int
+
+	out       strings.Builder
+	matches   int
+	files     int
+	truncated bool
+}
+
+// searchFile 搜索单个文件。返回 false 表示已达到结果上限，应停止遍历。
+func (g *grepSearcher) searchFile(absPath string) bool {
+	info, err := os.Stat(absPath)
+	if err != nil || info.Size() > maxGrepFileSize {
+		return true
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil || isBinary(data) {
+		return true
+	}
+
+	lines := splitLines(string(data))
+	name := g.ws.Rel(absPath)
+	lastPrinted := -1 // 已输出的最后一行的下标，用于合并重叠的上下文
+	fileHasMatch := false
+
+	for i, line := range lines {
+		if !g.re.MatchString(line) {
+			continue
+		}
+		if g.matches >= g.maxResults {
+			g.truncated = true
+			return false
+		}
+		g.matches++
+		if !fileHasMatch {
+			fileHasMatch = true
+			g.files++
+		}
+
+		start := max(0, i-g.context)
+		if lastPrinted >= 0 && start > lastPrinted+1 && g.context > 0 {
+			g.out.WriteString("--\n")
+		}
+		for j := max(start, lastPrinted+1); j < i; j++ {
+			fmt.Fprintf(&g.out, "%s-%d-%s\n", name, j+1, truncateLine(lines[j]))
+		}
+		if i > lastPrinted {
+			fmt.Fprintf(&g.out, "%s:%d:%s\n", name, i+1, truncateLine(line))
+		}
+		lastPrinted = i
+
+		// 后置上下文中出现的匹配行会在下一次循环中以 ':' 形式输出
+		end := min(len(lines)-1, i+g.context)
+		for j := i + 1; j <= end && !g.re.MatchString(lines[j]); j++ {
+			fmt.Fprintf(&g.out, "%s-%d-%s\n", name, j+1, truncateLine(lines[j]))
+			lastPrinted = j
+		}
+	}
+	if fileHasMatch && g.context > 0 {
+		g.out.WriteString("--\n")
+	}
+	return true
+}
+
+// --- Helper functions ---
+
+// matchAnyGlob 判断 rel 是否匹配任意一个 glob。
+// 不含 '/' 的模式（如 '*.go'）匹配任意目录下的文件名。
+func matchAnyGlob(globs []string, rel string) bool {
+	for _, glob := range globs {
+		glob = strings.TrimPrefix(glob, "./")
+		subject := rel
+		if !strings.Contains(glob, "/") {
+			subject = path.Base(rel)
+		}
+		if ok, _ := doublestar.Match(glob, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary 通过检查开头是否包含 NUL 字节来判断内容是否为二进制数据。
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLength {
+		data = data[:binarySniffLength]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+func truncateLine(line string) string {
+	if len(line) <= maxGrepLineLength {
+		return line
+	}
+	return line[:maxGrepLineLength] + "..."
+}
+
+// searchTargets 返回搜索工具访问的目录，未指定时为工作区根目录。
+func searchTargets(dir string) []string {
+	if dir == "" {
+		dir = "."
+	}
+	return []string{dir}
+}
+
+// resolveDir 将路径解析为工作区内一个已存在的目录。
+func resolveDir(env Env, p string) (*Workspace, string, error) {
+	dir, err := env.resolve(p)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if !info.IsDir() {
+		return nil, "", fmt.Errorf("'%s' is not a directory", p)
+	}
+	return env.Workspace, dir, nil
+}
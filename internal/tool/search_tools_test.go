@@ -0,0 +1,221 @@
+// internal/tool/search_tools_test.go
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// searchFiles 是搜索工具测试共用的项目结构。
+var searchFiles = map[string]string{
+	".gitignore":                "build/\n*.log\n!keep.log\n",
+	".env":                      "SECRET=1\n",
+	"main.go":                   "package main\n",
+	"debug.log":                 "ignored\n",
+	"keep.log":                  "kept\n",
+	"build/out.go":              "package build\n",
+	"internal/app/app.go":       "package app\n",
+	"internal/app/app_test.go":  "package app\n",
+	"internal/app/.gitignore":   "generated.go\n",
+	"internal/app/generated.go": "package app\n",
+}
+
+// lines 返回工具输出中除第一行标题以外的各行。
+func lines(text string) []string {
+	all := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return all[1:]
+}
+
+func TestListDirectory(t *testing.T) {
+	r, _ := newTestRegistry(t, searchFiles)
+	tests := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{
+			name: "direct children",
+			args: map[string]any{},
+			want: []string{"internal/", "keep.log", "main.go", "src/"},
+		},
+		{
+			name: "depth",
+			args: map[string]any{"depth": 3},
+			want: []string{"internal/", "internal/app/", "internal/app/app.go", "internal/app/app_test.go", "keep.log", "main.go", "src/"},
+		},
+		{
+			name: "hidden files",
+			args: map[string]any{"include_hidden": true},
+			want: []string{".env", ".gitignore", "internal/", "keep.log", "main.go", "src/"},
+		},
+		{
+			name: "without gitignore",
+			args: map[string]any{"respect_gitignore": false},
+			want: []string{"build/", "debug.log", "internal/", "keep.log", "main.go", "src/"},
+		},
+		{
+			name: "subdirectory",
+			args: map[string]any{"path": "internal/app"},
+			want: []string{"app.go", "app_test.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := execute(t, r, "list_directory", tt.args)
+			if err != nil {
+				t.Fatalf("list_directory: %v", err)
+			}
+			if got := lines(result.Text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := execute(t, r, "list_directory", map[string]any{"path": "main.go"}); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Errorf("list_directory of a file error = %v", err)
+	}
+	if _, err := execute(t, r, "list_directory", map[string]any{"path": "../outside"}); err == nil {
+		t.Error("list_directory outside the workspace succeeded")
+	}
+}
+
+func TestGlobFiles(t *testing.T) {
+	r, root := newTestRegistry(t, searchFiles)
+	// 修改时间决定结果的顺序：最新的在前
+	now := time.Now()
+	for i, name := range []string{"internal/app/app_test.go", "main.go", "internal/app/app.go"} {
+		mtime := now.Add(-time.Duration(i+1) * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{
+			name: "recursive",
+			args: map[string]any{"pattern": "**/*.go"},
+			want: []string{"internal/app/app_test.go", "main.go", "internal/app/app.go"},
+		},
+		{
+			name: "relative to path",
+			args: map[string]any{"pattern": "*_test.go", "path": "internal/app"},
+			want: []string{"internal/app/app_test.go"},
+		},
+		{
+			name: "hidden files by explicit pattern",
+			args: map[string]any{"pattern": ".env"},
+			want: []string{".env"},
+		},
+		{
+			name: "result cap",
+			args: map[string]any{"pattern": "**/*.go", "max_results": 1},
+			want: []string{"internal/app/app_test.go", "... (2 more results omitted; use a more specific pattern)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := execute(t, r, "glob_files", tt.args)
+			if err != nil {
+				t.Fatalf("glob_files: %v", err)
+			}
+			if got := lines(result.Text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matches = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	result, err := execute(t, r, "glob_files", map[string]any{"pattern": "**/*.rs"})
+	if err != nil || result.Meta["matches"] != 0 || !strings.Contains(result.Text, "No files match") {
+		t.Errorf("glob_files without matches = %+v, %v", result, err)
+	}
+	if _, err := execute(t, r, "glob_files", map[string]any{"pattern": "[a-"}); err == nil || !strings.Contains(err.Error(), "invalid glob pattern") {
+		t.Errorf("glob_files with a bad pattern error = %v", err)
+	}
+}
+
+func TestGrepSearch(t *testing.T) {
+	files := map[string]string{
+		".gitignore":    "vendor/\n",
+		"a.go":          "package a\n\nfunc Alpha() {}\n\nfunc Beta() {}\n",
+		"b.txt":         "alpha\nbeta\ngamma\ndelta\n",
+		"sub/c.go":      "package sub\n// func inComment\n",
+		"vendor/v.go":   "func Vendored() {}\n",
+		"bin/blob.dat":  "func\x00binary\n",
+		"sub/c_test.go": "func TestC() {}\n",
+	}
+	r, _ := newTestRegistry(t, files)
+	tests := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{
+			name: "skips ignored and binary files",
+			args: map[string]any{"pattern": `func \w+`},
+			want: []string{"a.go:3:func Alpha() {}", "a.go:5:func Beta() {}", "sub/c.go:2:// func inComment", "sub/c_test.go:1:func TestC() {}"},
+		},
+		{
+			name: "include and exclude",
+			args: map[string]any{"pattern": "func", "include": []string{"*.go"}, "exclude": []string{"**/*_test.go", "a.go"}},
+			want: []string{"sub/c.go:2:// func inComment"},
+		},
+		{
+			name: "case insensitive",
+			args: map[string]any{"pattern": "^ALPHA", "case_insensitive": true},
+			want: []string{"b.txt:1:alpha"},
+		},
+		{
+			name: "single file",
+			args: map[string]any{"pattern": "Beta", "path": "a.go"},
+			want: []string{"a.go:5:func Beta() {}"},
+		},
+		{
+			name: "context lines",
+			args: map[string]any{"pattern": "beta|gamma", "path": "b.txt", "context_lines": 1},
+			want: []string{"b.txt-1-alpha", "b.txt:2:beta", "b.txt:3:gamma", "b.txt-4-delta", "--"},
+		},
+		{
+			name: "result cap",
+			args: map[string]any{"pattern": "func", "max_results": 2},
+			want: []string{"a.go:3:func Alpha() {}", "a.go:5:func Beta() {}", "... (stopped after 2 matches; narrow the pattern or path to see more)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := execute(t, r, "grep_search", tt.args)
+			if err != nil {
+				t.Fatalf("grep_search: %v", err)
+			}
+			if got := lines(result.Text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	result, err := execute(t, r, "grep_search", map[string]any{"pattern": "Vendored"})
+	if err != nil || result.Meta["matches"] != 0 {
+		t.Errorf("grep_search found a match in an ignored directory: %+v, %v", result, err)
+	}
+	if _, err := execute(t, r, "grep_search", map[string]any{"pattern": "("}); err == nil || !strings.Contains(err.Error(), "invalid regular expression") {
+		t.Errorf("grep_search with a bad pattern error = %v", err)
+	}
+}
+
+func TestGrepSearchLongLines(t *testing.T) {
+	r, _ := newTestRegistry(t, map[string]string{"long.txt": "needle " + strings.Repeat("x", 2*maxGrepLineLength) + "\n"})
+	result, err := execute(t, r, "grep_search", map[string]any{"pattern": "needle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := lines(result.Text)
+	if len(got) != 1 || !strings.HasSuffix(got[0], "...") || len(got[0]) > maxGrepLineLength+len("long.txt:1:...") {
+		t.Errorf("long line was not truncated: %q", got)
+	}
+}
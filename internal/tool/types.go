@@ -1,6 +1,89 @@
 package tool
 
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Env 描述一次工具调用的执行环境。
+// Workspace、WorkspaceRoot 和命令策略由注册表在执行时填入，因此不同的注册表可以拥有不同的沙箱。
+type Env struct {
+	WorkspaceRoot string      // 工作区根目录的绝对路径
+	SessionID     string      // 发起调用的会话 ID
+	Logger        *log.Logger // 工具的诊断日志，不会发送给 LLM
+	Recorder      Recorder    // 修改文件前通知的 Recorder，为 nil 时不记录
+	Workspace     *Workspace  // 工具可以访问的文件系统范围
+	commands      CommandPolicy
+	maxResultSize int // 结果文本的大小上限，为 0 时使用 defaultMaxResultBytes
+}
+
 // ToolFunc 是一个可执行工具的函数签名。
 // 它接收由 LLM 生成的、JSON 格式的参数字符串，
-// 并返回一个对 LLM 有意义的、字符串形式的结果，或者一个错误。
-type ToolFunc func(arguments string) (string, error)
+// 并返回一个结构化的结果（其中的 Text 对 LLM 有意义），或者一个错误。
+// ctx 在用户中断或工具超时时被取消，耗时的工具应当及时响应并返回。
+type ToolFunc func(ctx context.Context, env Env, arguments string) (Result, error)
+
+// LegacyToolFunc 是旧版的工具签名，不感知 context 和执行环境。
+type LegacyToolFunc func(arguments string) (string, error)
+
+// Adapt 把旧版工具包装为 ToolFunc。
+// 旧版工具无法被真正中断：ctx 被取消时 Adapt 会立即返回错误，
+// 让 agent 循环继续，而工具本身会在后台运行到结束，其结果被丢弃。
+func Adapt(fn LegacyToolFunc) ToolFunc {
+	return func(ctx context.Context, _ Env, arguments string) (Result, error) {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		type outcome struct {
+			result string
+			err    error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			result, err := fn(arguments)
+			done <- outcome{result, err}
+		}()
+		select {
+		case o := <-done:
+			return TextResult(o.result), o.err
+		case <-ctx.Done():
+			return Result{}, fmt.Errorf("tool abandoned before it finished: %w", ctx.Err())
+		}
+	}
+}
+
+// PreviewFunc 在工具真正执行之前描述它将要做出的变更（例如一段 diff），
+// 用于在审批时展示给用户。它不能产生任何副作用。
+type PreviewFunc func(env Env, arguments string) (string, error)
+
+// TargetsFunc 返回一次调用将会读取或修改的路径（相对于工作区或绝对路径），
+// agent 据此判断哪些调用可以并发执行。返回 nil 表示无法确定，
+// 这样的调用被视为可能访问整个工作区。
+type TargetsFunc func(arguments string) []string
+
+// Access 描述一个工具对工作区的影响程度，审批层据此决定是否需要用户确认。
+type Access int
+
+const (
+	// AccessReadOnly 表示工具只读取数据，可以直接执行。
+	AccessReadOnly Access = iota
+	// AccessMutating 表示工具会修改工作区，执行前需要用户确认。
+	AccessMutating
+	// AccessDestructive 表示工具会删除、移动文件或改变目录结构，
+	// 每次执行前都需要用户确认，不能在会话范围内自动放行。
+	AccessDestructive
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessReadOnly:
+		return "read-only"
+	case AccessMutating:
+		return "mutating"
+	case AccessDestructive:
+		return "destructive"
+	default:
+		return "unknown"
+	}
+}
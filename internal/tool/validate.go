@@ -0,0 +1,581 @@
+// internal/tool/validate.go
+package tool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ArgumentProblem 描述参数中的一个具体问题。
+type ArgumentProblem struct {
+	Field   string // 出错字段的路径，例如 "edits[0].new_snippet"；为空表示整个参数
+	Message string
+}
+
+// ArgumentError 表示工具参数没有通过 schema 校验。
+// 它的 Error() 会逐条列出出错的字段，作为工具结果返回给模型，便于模型修正后重试。
+type ArgumentError struct {
+	Tool     string
+	Problems []ArgumentProblem
+}
+
+func (e *ArgumentError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "invalid arguments for tool '%s':\n", e.Tool)
+	for _, p := range e.Problems {
+		field := p.Field
+		if field == "" {
+			field = "(arguments)"
+		}
+		fmt.Fprintf(&sb, "  - %s: %s\n", field, p.Message)
+	}
+	sb.WriteString("Fix the listed fields and call the tool again.")
+	return sb.String()
+}
+
+// jsonSchema 是校验参数时使用的 JSON Schema 子集。
+type jsonSchema struct {
+	Type                 any                    `json:"type"` // 字符串或字符串数组
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	Enum                 []any                  `json:"enum"`
+	Items                *jsonSchema            `json:"items"`
+	AdditionalProperties any                    `json:"additionalProperties"`
+	Default              any                    `json:"default"`
+}
+
+// parseSchema 把工具定义中的 Parameters 解析为 jsonSchema。无法解析时返回 nil，表示不做校验。
+func parseSchema(params any) *jsonSchema {
+	if params == nil {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil
+	}
+	return &schema
+}
+
+// ValidateArguments 修复常见的 JSON 格式错误，并按工具注册的 schema 校验参数，
+// 为缺省的参数填入 schema 中的默认值。它返回可以直接交给工具的参数；校验失败时返回 *ArgumentError。
+func (r *Registry) ValidateArguments(name, arguments string) (string, error) {
+	r.mu.RLock()
+	t, found := r.tools[name]
+	r.mu.RUnlock()
+	if !found {
+		return "", fmt.Errorf("tool '%s' not found in registry", name)
+	}
+
+	repaired, _ := RepairJSON(arguments)
+	if TruncatedJSON(repaired) {
+		// 补全后的参数必然残缺，只用来找出被截断的字段，不会交给工具执行
+		_, field, _ := CloseTruncatedJSON(repaired)
+		return "", &ArgumentError{Tool: name, Problems: []ArgumentProblem{{Field: field, Message: "arguments were cut off before the JSON was complete, probably because the response hit the output token limit; nothing was executed. Send smaller arguments, e.g. write a large file with several smaller edits"}}}
+	}
+	decoder := json.NewDecoder(strings.NewReader(repaired))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", &ArgumentError{Tool: name, Problems: []ArgumentProblem{{Message: fmt.Sprintf("arguments are not valid JSON: %v", err)}}}
+	}
+	if decoder.More() {
+		return "", &ArgumentError{Tool: name, Problems: []ArgumentProblem{{Message: "arguments must be a single JSON object"}}}
+	}
+
+	if value == nil {
+		// 没有参数的调用有时会被写成 null
+		value, repaired = map[string]any{}, "{}"
+	}
+	if t.schema == nil {
+		return repaired, nil
+	}
+	var problems []ArgumentProblem
+	value = t.schema.validate(value, "", &problems)
+	if len(problems) > 0 {
+		return "", &ArgumentError{Tool: name, Problems: problems}
+	}
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// validate 校验 value 是否符合 schema，把发现的问题追加到 problems。
+// 对于模型常见的类型错误（例如把数字写成字符串 "5"），返回转换后的值；
+// 缺省或为 null 的字段会被填入 schema 中的默认值。
+func (s *jsonSchema) validate(value any, path string, problems *[]ArgumentProblem) any {
+	report := func(format string, args ...any) {
+		*problems = append(*problems, ArgumentProblem{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	types := s.types()
+	if len(types) > 0 {
+		coerced, ok := coerce(value, types)
+		if !ok {
+			report("expected %s, got %s", strings.Join(types, " or "), jsonTypeOf(value))
+			return value
+		}
+		value = coerced
+	}
+
+	if len(s.Enum) > 0 && !enumContains(s.Enum, value) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			data, _ := json.Marshal(e)
+			allowed[i] = string(data)
+		}
+		got, _ := json.Marshal(value)
+		report("value %s is not allowed; expected one of: %s", got, strings.Join(allowed, ", "))
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if field, ok := v[name]; !ok || field == nil {
+				*problems = append(*problems, ArgumentProblem{Field: joinPath(path, name), Message: "missing required field"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, known := s.Properties[name]
+			switch {
+			case known:
+				if v[name] != nil {
+					v[name] = prop.validate(v[name], joinPath(path, name), problems)
+				}
+			case s.allowsExtraProperties():
+				// 未声明的字段被允许
+			default:
+				*problems = append(*problems, ArgumentProblem{Field: joinPath(path, name), Message: fmt.Sprintf("unknown field; allowed fields are: %s", strings.Join(s.propertyNames(), ", "))})
+			}
+		}
+		for name, prop := range s.Properties {
+			if v[name] == nil && prop.Default != nil {
+				v[name] = prop.Default
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				v[i] = s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+	return value
+}
+
+func (s *jsonSchema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	default:
+		return nil
+	}
+}
+
+// allowsExtraProperties 判断对象是否可以包含 properties 之外的字段。
+// 与 JSON Schema 一致，没有设置 additionalProperties 时允许；
+// 由 TypedTool 生成的 schema 会被 disallowExtraProperties 收紧，以便发现模型拼错的参数名。
+func (s *jsonSchema) allowsExtraProperties() bool {
+	switch a := s.AdditionalProperties.(type) {
+	case bool:
+		return a
+	default:
+		return true
+	}
+}
+
+// disallowExtraProperties 让 schema 中所有声明了 properties 且没有设置 additionalProperties
+// 的对象拒绝未声明的字段。它只修改用于校验的 schema，不影响发送给模型的工具定义。
+func (s *jsonSchema) disallowExtraProperties() {
+	if len(s.Properties) > 0 && s.AdditionalProperties == nil {
+		s.AdditionalProperties = false
+	}
+	for _, prop := range s.Properties {
+		prop.disallowExtraProperties()
+	}
+	if s.Items != nil {
+		s.Items.disallowExtraProperties()
+	}
+}
+
+func (s *jsonSchema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// coerce 检查 value 是否属于 types 中的某个类型；如果不是，尝试把字符串形式的
+// 数字和布尔值转换为对应类型。
+func coerce(value any, types []string) (any, bool) {
+	for _, t := range types {
+		if matchesType(value, t) {
+			if t == "integer" {
+				// 把 2.0 这样的整数值规范为 2，以便解析到 Go 的整数类型
+				return canonicalInteger(value.(json.Number)), true
+			}
+			return value, true
+		}
+	}
+	s, ok := value.(string)
+	if !ok {
+		return value, false
+	}
+	s = strings.TrimSpace(s)
+	for _, t := range types {
+		switch t {
+		case "integer", "number":
+			n := json.Number(s)
+			if matchesType(n, t) {
+				if t == "integer" {
+					return canonicalInteger(n), true
+				}
+				return n, true
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b, true
+			}
+		}
+	}
+	return value, false
+}
+
+func matchesType(value any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Float64()
+		return err == nil
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, _, err := big.ParseFloat(n.String(), 10, 64, big.ToNearestEven)
+		return err == nil && f.IsInt()
+	default:
+		// 未知的类型名不做限制
+		return true
+	}
+}
+
+func canonicalInteger(n json.Number) json.Number {
+	f, _, err := big.ParseFloat(n.String(), 10, 64, big.ToNearestEven)
+	if err != nil {
+		return n
+	}
+	i, _ := f.Int(nil)
+	return json.Number(i.String())
+}
+
+func jsonTypeOf(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return fmt.Sprintf("string %q", truncateLine(v))
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number " + v.String()
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func enumContains(enum []any, value any) bool {
+	got, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(enum, func(e any) bool {
+		want, err := json.Marshal(e)
+		if err != nil {
+			return false
+		}
+		if bytes.Equal(got, want) {
+			return true
+		}
+		// 数字按数值比较，使 1 与 1.0 相等
+		a, aok := new(big.Float).SetString(string(got))
+		b, bok := new(big.Float).SetString(string(want))
+		return aok && bok && a.Cmp(b) == 0
+	})
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// --- JSON repair ---
+
+// RepairJSON 修复 LLM 生成的工具参数中无害的 JSON 格式错误：Markdown 代码块包裹、
+// 空参数，以及对象和数组末尾多余的逗号。返回修复后的 JSON 以及是否做了修改；无法修复时原样返回。
+// 未闭合的字符串、对象和数组说明参数被截断了（见 TruncatedJSON），补全它们会让工具
+// 写入残缺的内容，因此 RepairJSON 不会补全它们；需要时使用 CloseTruncatedJSON。
+func RepairJSON(s string) (string, bool) {
+	if json.Valid([]byte(s)) {
+		return s, false
+	}
+	trimmed := strings.TrimSpace(s)
+	if fenced, ok := stripCodeFence(trimmed); ok {
+		trimmed = fenced
+	}
+	if trimmed == "" {
+		return "{}", true
+	}
+	if json.Valid([]byte(trimmed)) {
+		return trimmed, true
+	}
+
+	out, unclosed := scanJSON(trimmed)
+	if unclosed || !json.Valid(out) {
+		return s, false
+	}
+	return string(out), true
+}
+
+// TruncatedJSON 判断 s 是否在字符串、对象或数组闭合之前就结束了，
+// 这通常说明模型的输出因为达到 token 上限而被截断。
+func TruncatedJSON(s string) bool {
+	trimmed := strings.TrimSpace(s)
+	if fenced, ok := stripCodeFence(trimmed); ok {
+		trimmed = fenced
+	}
+	_, unclosed := scanJSON(trimmed)
+	return unclosed
+}
+
+// CloseTruncatedJSON 补全被截断的 JSON：闭合未结束的字符串，去掉末尾不完整的键和多余的逗号，
+// 再依次闭合未结束的数组和对象。它返回补全后的 JSON、被截断的值所在的字段路径
+// （例如 "edits[1].new_snippet"，截断发生在顶层时为空），以及补全是否成功。
+// 补全得到的值必然残缺：它只适合用来诊断和报告，不应当交给工具执行。
+func CloseTruncatedJSON(s string) (string, string, bool) {
+	trimmed := strings.TrimSpace(s)
+	if fenced, ok := stripCodeFence(trimmed); ok {
+		trimmed = fenced
+	}
+
+	// frame 是一个尚未闭合的对象或数组
+	type frame struct {
+		object    bool
+		expectKey bool   // 对象中下一个字符串是键
+		key       string // 对象中当前成员的键
+		index     int    // 数组中当前元素的下标
+		started   bool   // 数组中当前元素是否已经开始
+	}
+	var (
+		out         []byte
+		frames      []*frame
+		inString    bool
+		escaped     bool
+		stringStart int
+	)
+	for i := 0; i < len(trimmed); i++ {
+		c := trimmed[i]
+		out = append(out, c)
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if n := len(frames); n > 0 && frames[n-1].object && frames[n-1].expectKey {
+					var key string
+					if json.Unmarshal(out[stringStart:], &key) == nil {
+						frames[n-1].key = key
+					}
+				}
+			}
+			continue
+		}
+		var top *frame
+		if len(frames) > 0 {
+			top = frames[len(frames)-1]
+		}
+		if top != nil && !top.object && !strings.ContainsRune(" \t\r\n,]", rune(c)) {
+			top.started = true
+		}
+		switch c {
+		case '"':
+			inString = true
+			stringStart = len(out) - 1
+		case '{':
+			frames = append(frames, &frame{object: true, expectKey: true})
+		case '[':
+			frames = append(frames, &frame{})
+		case '}', ']':
+			if top != nil {
+				frames = frames[:len(frames)-1]
+			}
+		case ':':
+			if top != nil && top.object {
+				top.expectKey = false
+			}
+		case ',':
+			if top != nil && top.object {
+				top.expectKey, top.key = true, ""
+			} else if top != nil {
+				top.index++
+				top.started = false
+			}
+		}
+	}
+
+	// 被截断的值所在的路径
+	var field string
+	for _, f := range frames {
+		switch {
+		case f.object && f.key != "":
+			field = joinPath(field, f.key)
+		case !f.object && f.started:
+			field = fmt.Sprintf("%s[%d]", field, f.index)
+		}
+	}
+
+	if n := len(frames); inString && n > 0 && frames[n-1].object && frames[n-1].expectKey {
+		// 截断发生在键中间：丢掉这个不完整的键
+		out, inString = out[:stringStart], false
+	}
+	if inString {
+		if escaped {
+			out = out[:len(out)-1]
+		}
+		out = append(out, '"')
+	}
+	out = bytes.TrimRight(out, " \t\r\n")
+	if n := len(frames); n > 0 && frames[n-1].object {
+		switch {
+		case bytes.HasSuffix(out, []byte(":")):
+			// 只有键没有值
+			out = append(out, "null"...)
+		case frames[n-1].expectKey && !bytes.HasSuffix(out, []byte("{")) && !bytes.HasSuffix(out, []byte(",")):
+			// 键已经结束但还没有冒号
+			out = append(out, ":null"...)
+		}
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].object {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+	}
+	closed, unclosed := scanJSON(string(out))
+	if unclosed || !json.Valid(closed) {
+		return s, field, false
+	}
+	return string(closed), field, true
+}
+
+// scanJSON 去掉对象和数组末尾多余的逗号，并报告 s 结束时是否还有未闭合的字符串、对象或数组。
+func scanJSON(s string) ([]byte, bool) {
+	var (
+		out      []byte
+		depth    int
+		inString bool
+		escaped  bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			out = append(out, c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			out = trimTrailingComma(out)
+			depth = max(depth-1, 0)
+		}
+		out = append(out, c)
+	}
+	return out, inString || depth > 0
+}
+
+// stripCodeFence 去掉 ```json ... ``` 形式的 Markdown 代码块包裹。
+func stripCodeFence(s string) (string, bool) {
+	if !strings.HasPrefix(s, "```") {
+		return s, false
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.IndexByte(s, '\n'); i >= 0 && !strings.ContainsAny(s[:i], "{[") {
+		s = s[i+1:]
+	}
+	s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	return strings.TrimSpace(s), true
+}
+
+// trimTrailingComma 去掉 out 末尾（忽略空白）的逗号。
+func trimTrailingComma(out []byte) []byte {
+	t := bytes.TrimRight(out, " \t\r\n")
+	if len(t) > 0 && t[len(t)-1] == ',' {
+		return t[:len(t)-1]
+	}
+	return out
+}
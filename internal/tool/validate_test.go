@@ -0,0 +1,290 @@
+// internal/tool/validate_test.go
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/synapse/internal/llm"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		input       string
+		want        string
+		wantChanged bool
+	}{
+		{`{"a": 1}`, `{"a": 1}`, false},
+		{"", "{}", true},
+		{"   \n", "{}", true},
+		{"```json\n{\"a\": 1}\n```", `{"a": 1}`, true},
+		{"```\n{\"a\": 1}\n```", `{"a": 1}`, true},
+		{`{"a": [1, 2,], "b": {"c": 3,},}`, `{"a": [1, 2], "b": {"c": 3}}`, true},
+		{`{"a": "x,}", }`, `{"a": "x,}"}`, true},
+		{`{"a": "escaped \" quote",}`, `{"a": "escaped \" quote"}`, true},
+		// 截断的参数不会被补全
+		{`{"content": "half a fi`, `{"content": "half a fi`, false},
+		{`{"edits": [{"a": 1}`, `{"edits": [{"a": 1}`, false},
+		// 无法修复的内容原样返回
+		{`{a: 1}`, `{a: 1}`, false},
+	}
+	for _, tt := range tests {
+		got, changed := RepairJSON(tt.input)
+		if got != tt.want || changed != tt.wantChanged {
+			t.Errorf("RepairJSON(%q) = %q, %v; want %q, %v", tt.input, got, changed, tt.want, tt.wantChanged)
+		}
+	}
+}
+
+func TestTruncatedJSON(t *testing.T) {
+	tests := map[string]bool{
+		`{"a": 1}`:                       false,
+		`{"a": [1, 2,]}`:                 false,
+		`{a: 1}`:                         false,
+		``:                               false,
+		`{"a": "unterminated`:            true,
+		`{"a": "ends with escape \`:      true,
+		`{"a": [1, 2`:                    true,
+		`{"a": {"b": 1}`:                 true,
+		`{"a": "braces in strings {[ "}`: false,
+		"```json\n{\"a\": [\n```":        true,
+	}
+	for input, want := range tests {
+		if got := TruncatedJSON(input); got != want {
+			t.Errorf("TruncatedJSON(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestCloseTruncatedJSON(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		field  string
+		wantOK bool
+	}{
+		{input: `{"content": "half a fi`, want: `{"content": "half a fi"}`, field: "content", wantOK: true},
+		{input: `{"a": "ends with escape \`, want: `{"a": "ends with escape "}`, field: "a", wantOK: true},
+		{input: `{"edits": [{"old": "x", "new": "y"}, {"old": "z", "new": "partial`, want: `{"edits": [{"old": "x", "new": "y"}, {"old": "z", "new": "partial"}]}`, field: "edits[1].new", wantOK: true},
+		{input: `{"tags": ["x", `, want: `{"tags": ["x"]}`, field: "tags", wantOK: true},
+		{input: `{"tags": ["x"`, want: `{"tags": ["x"]}`, field: "tags[0]", wantOK: true},
+		{input: `{"a": 1, "b": `, want: `{"a": 1, "b":null}`, field: "b", wantOK: true},
+		{input: `{"a": 1, "b"`, want: `{"a": 1, "b":null}`, field: "b", wantOK: true},
+		{input: `{"a": 1, "bc`, want: `{"a": 1}`, wantOK: true},
+		{input: `{"a": 1,`, want: `{"a": 1}`, wantOK: true},
+		{input: "```json\n{\"a\": [1, 2", want: `{"a": [1, 2]}`, field: "a[1]", wantOK: true},
+		// 截断在字面量中间时无法补全，但仍然能找到字段
+		{input: `{"a": tru`, field: "a"},
+	}
+	for _, tt := range tests {
+		got, field, ok := CloseTruncatedJSON(tt.input)
+		if ok != tt.wantOK || field != tt.field || (ok && got != tt.want) {
+			t.Errorf("CloseTruncatedJSON(%q) = %q, %q, %v; want %q, %q, %v", tt.input, got, field, ok, tt.want, tt.field, tt.wantOK)
+		}
+		if ok && TruncatedJSON(got) {
+			t.Errorf("CloseTruncatedJSON(%q) = %q is still truncated", tt.input, got)
+		}
+	}
+}
+
+type validateArgs struct {
+	Path    string   `json:"path" desc:"A path" required:"true"`
+	Count   int      `json:"count" default:"10"`
+	Ratio   float64  `json:"ratio"`
+	Verbose bool     `json:"verbose" default:"true"`
+	Mode    string   `json:"mode" enum:"fast,slow" default:"fast"`
+	Tags    []string `json:"tags"`
+	Edits   []struct {
+		Old string `json:"old" required:"true"`
+		New string `json:"new"`
+	} `json:"edits"`
+}
+
+// newValidateRegistry 返回一个注册了 typed 工具和使用手写 schema 的 plain 工具的注册表，
+// 以及 typed 工具收到的参数。
+func newValidateRegistry(t *testing.T) (*Registry, *validateArgs) {
+	t.Helper()
+	r := NewRegistry()
+	got := &validateArgs{}
+	err := RegisterTyped(r, TypedTool[validateArgs]{
+		Name:   "typed",
+		Access: AccessReadOnly,
+		Run: func(_ context.Context, _ Env, args validateArgs) (Result, error) {
+			*got = args
+			return TextResult("ok"), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := llm.Tool{
+		Name:       "plain",
+		Parameters: json.RawMessage(`{"type": "object", "properties": {"q": {"type": "string"}, "strict": {"type": "object", "properties": {"x": {"type": "integer"}}, "additionalProperties": false}}}`),
+	}
+	noop := func(context.Context, Env, string) (Result, error) { return TextResult("ok"), nil }
+	if err := r.Register(plain, noop, AccessReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(llm.Tool{Name: "schemaless"}, noop, AccessReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	return r, got
+}
+
+func TestValidateArguments(t *testing.T) {
+	r, _ := newValidateRegistry(t)
+	tests := []struct {
+		name      string
+		tool      string
+		arguments string
+		want      string   // 规范化后的参数
+		problems  []string // 期望的 "字段: 信息片段"
+	}{
+		{
+			name:      "defaults are filled",
+			tool:      "typed",
+			arguments: `{"path": "a.go"}`,
+			want:      `{"count":10,"mode":"fast","path":"a.go","verbose":true}`,
+		},
+		{
+			name:      "null fields get defaults",
+			tool:      "typed",
+			arguments: `{"path": "a.go", "count": null}`,
+			want:      `{"count":10,"mode":"fast","path":"a.go","verbose":true}`,
+		},
+		{
+			name:      "strings are coerced",
+			tool:      "typed",
+			arguments: `{"path": "a.go", "count": " 5 ", "ratio": "0.5", "verbose": "false"}`,
+			want:      `{"count":5,"mode":"fast","path":"a.go","ratio":0.5,"verbose":false}`,
+		},
+		{
+			name:      "integral floats become integers",
+			tool:      "typed",
+			arguments: `{"path": "a.go", "count": 3.0}`,
+			want:      `{"count":3,"mode":"fast","path":"a.go","verbose":true}`,
+		},
+		{
+			name:      "trailing commas are repaired",
+			tool:      "typed",
+			arguments: "```json\n{\"path\": \"a.go\", \"tags\": [\"x\",],}\n```",
+			want:      `{"count":10,"mode":"fast","path":"a.go","tags":["x"],"verbose":true}`,
+		},
+		{
+			name:      "every problem is reported",
+			tool:      "typed",
+			arguments: `{"count": 1.5, "mode": "medium", "tags": "x", "edits": [{"new": "b"}], "pth": "a.go"}`,
+			problems: []string{
+				"path: missing required field",
+				"count: expected integer",
+				"mode: value \"medium\" is not allowed",
+				"tags: expected array",
+				"edits[0].old: missing required field",
+				"pth: unknown field",
+			},
+		},
+		{
+			name:      "truncated arguments",
+			tool:      "typed",
+			arguments: `{"path": "a.go", "tags": ["x"`,
+			problems:  []string{"tags[0]: arguments were cut off"},
+		},
+		{
+			name:      "invalid JSON",
+			tool:      "typed",
+			arguments: `{path: "a.go"}`,
+			problems:  []string{"(arguments): arguments are not valid JSON"},
+		},
+		{
+			name:      "several values",
+			tool:      "typed",
+			arguments: `{"path": "a"} {"path": "b"}`,
+			problems:  []string{"(arguments): arguments must be a single JSON object"},
+		},
+		{
+			name:      "not an object",
+			tool:      "typed",
+			arguments: `["a.go"]`,
+			problems:  []string{"(arguments): expected object, got array"},
+		},
+		{
+			name:      "plain schemas allow undeclared fields",
+			tool:      "plain",
+			arguments: `{"q": "x", "extra": 1}`,
+			want:      `{"extra":1,"q":"x"}`,
+		},
+		{
+			name:      "additionalProperties false is honoured",
+			tool:      "plain",
+			arguments: `{"strict": {"x": "2", "y": 1}}`,
+			problems:  []string{"strict.y: unknown field"},
+		},
+		{
+			name:      "empty arguments",
+			tool:      "plain",
+			arguments: ``,
+			want:      `{}`,
+		},
+		{
+			name:      "null arguments",
+			tool:      "plain",
+			arguments: `null`,
+			want:      `{}`,
+		},
+		{
+			name:      "tools without parameters accept any fields",
+			tool:      "schemaless",
+			arguments: `{"anything": [1,]}`,
+			want:      `{"anything":[1]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ValidateArguments(tt.tool, tt.arguments)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateArguments: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("arguments = %s, want %s", got, tt.want)
+				}
+				return
+			}
+			var argErr *ArgumentError
+			if !errors.As(err, &argErr) {
+				t.Fatalf("err = %v, want *ArgumentError", err)
+			}
+			if len(argErr.Problems) != len(tt.problems) {
+				t.Errorf("got %d problems, want %d:\n%s", len(argErr.Problems), len(tt.problems), err)
+			}
+			for _, want := range tt.problems {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not contain %q:\n%s", want, err)
+				}
+			}
+		})
+	}
+
+	if _, err := r.ValidateArguments("missing", "{}"); err == nil {
+		t.Error("ValidateArguments for an unknown tool succeeded")
+	}
+}
+
+func TestExecuteValidatesBeforeRunning(t *testing.T) {
+	r, got := newValidateRegistry(t)
+	if _, err := r.Execute(context.Background(), Env{}, "typed", `{"count": 1}`); err == nil {
+		t.Fatal("Execute with a missing required field succeeded")
+	}
+	if got.Path != "" {
+		t.Fatalf("tool ran with invalid arguments: %+v", got)
+	}
+	if _, err := r.Execute(context.Background(), Env{}, "typed", `{"path": "a.go", "count": "7"}`); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got.Path != "a.go" || got.Count != 7 || !got.Verbose || got.Mode != "fast" {
+		t.Errorf("tool received %+v", got)
+	}
+}
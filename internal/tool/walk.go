@@ -0,0 +1,184 @@
+// internal/tool/walk.go
+package tool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// walkOptions 控制 walkFiles 的遍历行为。
+type walkOptions struct {
+	includeHidden    bool // 是否包含以 '.' 开头的文件和目录
+	respectGitignore bool // 是否跳过被 .gitignore 忽略的路径
+	maxDepth         int  // 最大深度，1 表示只遍历直接子项，0 表示不限制
+}
+
+// walkFunc 在遍历到每个条目时被调用。rel 是相对于遍历起点、以 '/' 分隔的路径。
+// 返回 fs.SkipDir 可以跳过一个目录，返回 fs.SkipAll 可以提前结束遍历。
+type walkFunc func(absPath, rel string, entry fs.DirEntry) error
+
+// walkFiles 从 dir 开始按名称顺序遍历工作区。
+// .git 目录总是被跳过；符号链接不会被跟随，以免逃逸出工作区。
+// ctx 被取消时遍历会停止并返回 ctx.Err()。
+func walkFiles(ctx context.Context, ws *Workspace, dir string, opts walkOptions, fn walkFunc) error {
+	var matcher *ignoreMatcher
+	if opts.respectGitignore {
+		matcher = newIgnoreMatcher(ws.Root(), dir)
+	}
+	err := walkDir(ctx, dir, "", 0, matcher, opts, fn)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkDir(ctx context.Context, absDir, relDir string, depth int, matcher *ignoreMatcher, opts walkOptions, fn walkFunc) error {
+	entries, err := os.ReadDir(absDir)
+	if err != nil {
+		return err
+	}
+	if matcher != nil {
+		matcher = matcher.withDir(absDir)
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() && name == ".git" {
+			continue
+		}
+		if !opts.includeHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		absPath := filepath.Join(absDir, name)
+		if matcher != nil && matcher.ignored(absPath, entry.IsDir()) {
+			continue
+		}
+
+		rel := path.Join(relDir, name)
+		err := fn(absPath, rel, entry)
+		if errors.Is(err, fs.SkipDir) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && (opts.maxDepth == 0 || depth+1 < opts.maxDepth) {
+			err := walkDir(ctx, absPath, rel, depth+1, matcher, opts, fn)
+			if err != nil && !errors.Is(err, fs.ErrPermission) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// --- .gitignore support ---
+
+type ignoreRule struct {
+	baseDir  string // .gitignore 所在目录的绝对路径
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // 模式中包含 '/'，只相对 baseDir 匹配
+}
+
+// ignoreMatcher 实现了 .gitignore 的常用子集：注释、'!' 取反、
+// 以 '/' 结尾只匹配目录、包含 '/' 的模式相对于所在目录匹配，以及 '**' 通配。
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// newIgnoreMatcher 加载从工作区根目录到 dir 之间所有祖先目录中的 .gitignore。
+// dir 本身的 .gitignore 会在遍历时加载。
+func newIgnoreMatcher(root, dir string) *ignoreMatcher {
+	m := &ignoreMatcher{}
+	if !IsWithin(root, dir) {
+		return m
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return m
+	}
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		m = m.withDir(current)
+		current = filepath.Join(current, part)
+	}
+	return m
+}
+
+// withDir 返回一个追加了 dir/.gitignore 规则的新 matcher，原 matcher 保持不变。
+func (m *ignoreMatcher) withDir(dir string) *ignoreMatcher {
+	file, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return m
+	}
+	defer file.Close()
+
+	rules := append([]ignoreRule(nil), m.rules...)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{baseDir: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return &ignoreMatcher{rules: rules}
+}
+
+// ignored 判断 absPath 是否被忽略；与 git 一致，最后一条匹配的规则生效。
+func (m *ignoreMatcher) ignored(absPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.baseDir, absPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		var matched bool
+		if rule.anchored {
+			matched, _ = doublestar.Match(rule.pattern, rel)
+		} else {
+			matched, _ = doublestar.Match(rule.pattern, path.Base(rel))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,238 @@
+// internal/tool/workspace.go
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace 描述了工具被允许访问的文件系统范围。
+// 所有工具路径都相对于 root 解析，并且在解析符号链接之后
+// 必须仍然位于 root 或某个额外允许的目录之内。
+type Workspace struct {
+	root    string
+	allowed []string
+}
+
+// NewWorkspace 创建一个以 root 为根的工作区。
+// root 为空时使用当前工作目录；allowedDirs 是工作区之外额外允许访问的目录。
+func NewWorkspace(root string, allowedDirs []string) (*Workspace, error) {
+	if root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine working directory: %w", err)
+		}
+		root = cwd
+	}
+
+	resolvedRoot, err := canonicalDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace root '%s': %w", root, err)
+	}
+
+	ws := &Workspace{root: resolvedRoot}
+	for _, dir := range allowedDirs {
+		resolved, err := canonicalDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed directory '%s': %w", dir, err)
+		}
+		ws.allowed = append(ws.allowed, resolved)
+	}
+	return ws, nil
+}
+
+// Root 返回工作区根目录的绝对路径（已解析符号链接）。
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// Resolve 将工具传入的路径解析为工作区内的绝对路径。
+// 相对路径以工作区根目录为基准；符号链接会被解析，
+// 任何最终逃逸出工作区及允许目录的路径都会被拒绝。
+func (w *Workspace) Resolve(p string) (string, error) {
+	if strings.TrimSpace(p) == "" {
+		return "", errors.New("invalid path: empty")
+	}
+
+	p = expandHome(p)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(w.root, p)
+	}
+	p = filepath.Clean(p)
+
+	resolved, err := resolveSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	if !w.contains(resolved) {
+		return "", fmt.Errorf("access denied: path '%s' is outside the workspace", p)
+	}
+	return resolved, nil
+}
+
+// ResolveLink 与 Resolve 类似，但只解析父目录中的符号链接，不解析最后一个路径分量：
+// 如果 p 本身是符号链接，返回的是链接自身的路径而不是它指向的位置。
+// 删除、移动路径的工具用它来操作链接本身。
+func (w *Workspace) ResolveLink(p string) (string, error) {
+	if strings.TrimSpace(p) == "" {
+		return "", errors.New("invalid path: empty")
+	}
+
+	p = expandHome(p)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(w.root, p)
+	}
+	p = filepath.Clean(p)
+
+	parent, err := resolveSymlinks(filepath.Dir(p))
+	if err != nil {
+		return "", err
+	}
+	resolved := filepath.Join(parent, filepath.Base(p))
+	if !w.contains(resolved) {
+		return "", fmt.Errorf("access denied: path '%s' is outside the workspace", p)
+	}
+	return resolved, nil
+}
+
+// Rel 返回 path 相对于工作区根目录的路径，用于向模型展示更简洁的结果。
+// 如果 path 不在根目录下，则原样返回。
+func (w *Workspace) Rel(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (w *Workspace) contains(path string) bool {
+	if IsWithin(w.root, path) {
+		return true
+	}
+	for _, dir := range w.allowed {
+		if IsWithin(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetWorkspace 设置注册表中的工具可以访问的工作区。
+func (r *Registry) SetWorkspace(ws *Workspace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workspace = ws
+}
+
+// Workspace 返回注册表的工作区；如果尚未设置，则以当前工作目录为根创建一个。
+func (r *Registry) Workspace() (*Workspace, error) {
+	r.mu.RLock()
+	ws := r.workspace
+	r.mu.RUnlock()
+	if ws != nil {
+		return ws, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.workspace == nil {
+		created, err := NewWorkspace("", nil)
+		if err != nil {
+			return nil, err
+		}
+		r.workspace = created
+	}
+	return r.workspace, nil
+}
+
+// resolve 将工具传入的路径解析为 env 工作区内的绝对路径。
+func (e Env) resolve(p string) (string, error) {
+	if e.Workspace == nil {
+		return "", errors.New("no workspace is configured for this tool call")
+	}
+	return e.Workspace.Resolve(p)
+}
+
+// resolveLink 与 resolve 相同，但不解析最后一个路径分量，见 Workspace.ResolveLink。
+func (e Env) resolveLink(p string) (string, error) {
+	if e.Workspace == nil {
+		return "", errors.New("no workspace is configured for this tool call")
+	}
+	return e.Workspace.ResolveLink(p)
+}
+
+// --- Helper functions ---
+
+// canonicalDir 返回一个已存在目录的绝对、已解析符号链接的路径。
+func canonicalDir(dir string) (string, error) {
+	abs, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errors.New("not a directory")
+	}
+	return resolved, nil
+}
+
+// resolveSymlinks 解析路径中所有已存在部分的符号链接。
+// 对于尚不存在的路径（例如即将创建的文件），解析最长的已存在前缀，
+// 然后把剩余部分拼接回去。
+func resolveSymlinks(p string) (string, error) {
+	existing := p
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			for i := len(rest) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, rest[i])
+			}
+			return resolved, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		// 路径本身存在但无法解析，说明它是一个悬空的符号链接；
+		// 写入它会落到链接指向的位置，因此直接拒绝。
+		if _, lerr := os.Lstat(existing); lerr == nil {
+			return "", fmt.Errorf("invalid path: '%s' is a broken symlink", existing)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return p, nil
+		}
+		rest = append(rest, filepath.Base(existing))
+		existing = parent
+	}
+}
+
+// IsWithin 判断 path 是否等于 dir 或位于 dir 之下。
+func IsWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") && !strings.HasPrefix(p, `~\`) {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[1:])
+}
@@ -0,0 +1,138 @@
+// internal/tool/workspace_test.go
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestWorkspace 在临时目录中创建一个工作区和一个位于它之外的目录。
+func newTestWorkspace(t *testing.T) (ws *Workspace, outside string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "src"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err = NewWorkspace(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws, outside
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+}
+
+func TestWorkspaceResolve(t *testing.T) {
+	ws, outside := newTestWorkspace(t)
+	root := ws.Root()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644)
+	symlink(t, outside, filepath.Join(root, "escape"))
+	symlink(t, filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret-link"))
+	symlink(t, filepath.Join(root, "src"), filepath.Join(root, "src-link"))
+	symlink(t, filepath.Join(outside, "missing"), filepath.Join(root, "dangling"))
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string // 非空时应当被拒绝，错误信息包含它
+	}{
+		{path: "src/main.go", want: filepath.Join(root, "src", "main.go")},
+		{path: "./src/../src/new/file.go", want: filepath.Join(root, "src", "new", "file.go")},
+		{path: filepath.Join(root, "src"), want: filepath.Join(root, "src")},
+		{path: ".", want: root},
+		{path: "src-link/main.go", want: filepath.Join(root, "src", "main.go")},
+		{path: "", wantErr: "empty"},
+		{path: "../outside/secret.txt", wantErr: "outside the workspace"},
+		{path: filepath.Join(outside, "secret.txt"), wantErr: "outside the workspace"},
+		{path: "escape/secret.txt", wantErr: "outside the workspace"},
+		{path: "escape/new-file.txt", wantErr: "outside the workspace"},
+		{path: "escape", wantErr: "outside the workspace"},
+		{path: "secret-link", wantErr: "outside the workspace"},
+		{path: "dangling", wantErr: "broken symlink"},
+		{path: "dangling/child", wantErr: "broken symlink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ws.Resolve(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Resolve(%q) = %q, %v; want error containing %q", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceResolveLink(t *testing.T) {
+	ws, outside := newTestWorkspace(t)
+	root := ws.Root()
+	symlink(t, outside, filepath.Join(root, "escape"))
+	symlink(t, filepath.Join(outside, "missing"), filepath.Join(root, "dangling"))
+
+	// 链接本身在工作区内，即使它指向工作区之外或已经悬空
+	for _, name := range []string{"escape", "dangling"} {
+		got, err := ws.ResolveLink(name)
+		if err != nil || got != filepath.Join(root, name) {
+			t.Errorf("ResolveLink(%q) = %q, %v; want the link itself", name, got, err)
+		}
+	}
+	// 经过链接的父目录仍然会被解析和检查
+	if got, err := ws.ResolveLink("escape/file.txt"); err == nil {
+		t.Errorf("ResolveLink through an escaping link = %q, want an error", got)
+	}
+}
+
+func TestWorkspaceAllowedDirs(t *testing.T) {
+	ws, outside := newTestWorkspace(t)
+	ws, err := NewWorkspace(ws.Root(), []string{outside})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(outside, "notes.txt")
+	if got, err := ws.Resolve(want); err != nil || got != want {
+		t.Errorf("Resolve in an allowed directory = %q, %v; want %q", got, err, want)
+	}
+	if got := ws.Rel(want); got != want {
+		t.Errorf("Rel outside the root = %q, want the absolute path", got)
+	}
+	if got := ws.Rel(filepath.Join(ws.Root(), "src", "a.go")); got != "src/a.go" {
+		t.Errorf("Rel = %q, want %q", got, "src/a.go")
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	sep := string(filepath.Separator)
+	dir := sep + filepath.Join("a", "b")
+	tests := map[string]bool{
+		dir:                                 true,
+		filepath.Join(dir, "c"):             true,
+		filepath.Join(dir, "..b", "c"):      true,
+		sep + filepath.Join("a", "bc"):      false,
+		sep + "a":                           false,
+		sep + filepath.Join("a", "b", ".."): false,
+		sep + filepath.Join("x", "a", "b"):  false,
+	}
+	for path, want := range tests {
+		if got := IsWithin(dir, path); got != want {
+			t.Errorf("IsWithin(%q, %q) = %v, want %v", dir, path, got, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
@@ -35,7 +36,7 @@ func PrintWelcomeMessage() {
 	fmt.Printf("%s\n", Blue("✨ FEATURES:"))
 	fmt.Printf("  %s %s\n", BrightCyan("•"), "Intelligent code generation & refactoring")
 	fmt.Printf("  %s %s\n", BrightCyan("•"), "Interactive file system operations (read, create, edit)")
-	fmt.Printf("  %s %s\n", BrightCyan("•"), "Pluggable LLM backend (OpenAI, DeepSeek, etc.)")
+	fmt.Printf("  %s %s\n", BrightCyan("•"), "Pluggable LLM backend (OpenAI, DeepSeek, Anthropic, Gemini, local Ollama models)")
 	fmt.Println()
 
 	fmt.Printf("%s\n", Blue("🚀 HOW TO USE:"))
@@ -46,10 +47,15 @@ func PrintWelcomeMessage() {
 	fmt.Printf("     %s %s\n", Dim("e.g."), Cyan("/add ./path/to/your/file.go"))
 	fmt.Printf("  %s The AI can read and edit files by asking for permission.\n", Cyan("5. File Editing:"))
 	fmt.Printf("     %s %s\n", Dim("e.g."), "Refactor the error handling in main.go")
+	fmt.Printf("  %s Use `/undo` and `/redo` to revert or re-apply the file changes of the last turn.\n", Cyan("6. Undo Changes:"))
+	fmt.Printf("     %s\n", Dim("Changes made by run_command, plugin and MCP tools are not tracked and cannot be undone."))
 	fmt.Println()
 
 	fmt.Printf("%s\n", Blue("⚙️ COMMANDS & FLAGS:"))
 	fmt.Printf("  %s or %s %s\n", Cyan("exit"), Cyan("quit"), Dim("- End the session."))
+	fmt.Printf("  %s %s\n", Cyan("Ctrl-C"), Dim("- Interrupt the current response and any running tool."))
+	fmt.Printf("  %s %s\n", Cyan("/models"), Dim("- List the models available from the active provider (e.g. Ollama)."))
+	fmt.Printf("  %s %s\n", Cyan("/reasoning"), Dim("- Show the model's full reasoning for the last request."))
 	fmt.Printf("  %s %s\n", Cyan("--config"), Dim("- Specify a path to your config file (e.g., --config my_config.yaml)."))
 	fmt.Printf("  %s %s\n", Cyan("--help"), Dim("- Show all available command-line flags."))
 	fmt.Println()
@@ -66,9 +72,65 @@ func PrintAssistantPrefix() {
 	fmt.Printf("\n%s ", Green("🤖 Assistant>"))
 }
 
+// reasoning 是推理过程的颜色。指定前景色，使它嵌在助手的绿色输出中时仍然是暗灰色。
+var reasoning = color.New(color.FgWhite, color.Faint).SprintFunc()
+
+// PrintReasoning 打印一段完整的推理过程，例如用 /reasoning 展开被折叠的推理。
 func PrintReasoning(content string) {
-	// Simple reasoning print for now
-	fmt.Printf("%s", Dim(content))
+	fmt.Println(FormatReasoningHeader("Reasoning"))
+	fmt.Println(FormatReasoning(content))
+}
+
+// FormatReasoningHeader 返回推理过程的标题行，例如 "Thinking..." 或折叠后的摘要。
+func FormatReasoningHeader(title string) string {
+	return reasoning("💭 " + title)
+}
+
+// FormatReasoning 返回以暗色显示的推理内容。
+func FormatReasoning(content string) string {
+	return reasoning(content)
+}
+
+// PrintApprovalRequest 展示一个等待用户确认的工具调用。
+// preview 中以 '+'/'-' 开头的行会按 diff 的习惯着色。
+func PrintApprovalRequest(toolName, access, arguments, preview string) {
+	fmt.Printf("\n%s %s %s\n", Yellow("⚠ Permission required:"), Cyan(toolName), Dim("("+access+")"))
+	if preview == "" {
+		fmt.Printf("%s %s\n", Dim("Arguments:"), arguments)
+		return
+	}
+	PrintDiff(preview)
+}
+
+// PrintDiff 按行打印一段 diff 文本，新增行为绿色，删除行为红色。
+func PrintDiff(diff string) {
+	fmt.Print(FormatDiff(diff, 0))
+}
+
+// FormatDiff 返回着色后的 diff 文本，最多包含 maxLines 行，maxLines <= 0 表示不限制。
+func FormatDiff(diff string, maxLines int) string {
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	var sb strings.Builder
+	for i, line := range lines {
+		if maxLines > 0 && i == maxLines {
+			sb.WriteString(Dim(fmt.Sprintf("... (%d more diff lines)", len(lines)-maxLines)) + "\n")
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			sb.WriteString(Dim(line))
+		case strings.HasPrefix(line, "@@"):
+			sb.WriteString(Cyan(line))
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString(Green(line))
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString(Red(line))
+		default:
+			sb.WriteString(line)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
 }
 
 var (